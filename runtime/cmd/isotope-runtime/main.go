@@ -1,32 +1,78 @@
 // Command isotope-runtime loads a Protobuf ExecutionPlan and runs it.
+//
+// isotope-runtime savepoint takes a savepoint of a pipeline running with
+// -admin-addr.
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/apache/arrow-go/v18/arrow/memory"
 
-	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/admin"
+	"github.com/sandboxws/isotope/runtime/pkg/connectors"
 	"github.com/sandboxws/isotope/runtime/pkg/engine"
+	"github.com/sandboxws/isotope/runtime/pkg/metrics"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
+	"github.com/sandboxws/isotope/runtime/pkg/tracing"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: isotope-runtime <plan.pb>\n")
-		os.Exit(1)
+	if len(os.Args) > 1 && os.Args[1] == "savepoint" {
+		os.Exit(savepoint(os.Args[2:]))
+	}
+	os.Exit(run())
+}
+
+// run runs the plan named on the command line and returns the exit code.
+// Deferred calls, e.g. closing the dead-letter queue, run before it returns.
+func run() int {
+	adminAddr := flag.String("admin-addr", "", "address to serve the admin API on, e.g. \"localhost:9091\"; anyone who can reach it can swap or stop the pipeline unless -admin-token is set (default: not served)")
+	adminToken := flag.String("admin-token", "", "bearer token the admin API requires in every request's Authorization header (default: none, the API is unauthenticated)")
+	allowRemovedState := flag.Bool("allow-removed-state", false, "discard restored state of operators no longer in the plan instead of failing")
+	checkpointDir := flag.String("checkpoint-dir", "", "directory for checkpoints (default checkpoints/<pipeline>)")
+	deadLetter := flag.String("dead-letter", "", "dead-letter queue for records that fail processing: console, file:<path> or kafka://<brokers>/<topic>")
+	edgeBuffer := flag.Int("edge-buffer", 0, "batches queued per edge and downstream instance before senders block (default 16)")
+	edgeBufferBytes := flag.Int64("edge-buffer-bytes", 0, "bytes queued per edge and downstream instance before senders block (default: no byte limit)")
+	errorPolicy := flag.String("error-policy", "", "policy for processing errors: fail, skip, log or dead-letter, optionally followed by per-operator overrides, e.g. \"fail,enrich=skip\"")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics, e.g. \":9090\" (default: not served)")
+	requireAllState := flag.Bool("require-all-state", false, "fail a restore if a stateful operator has no state in the checkpoint or savepoint")
+	restoreFrom := flag.String("restore-from", "", "checkpoint, checkpoint directory or savepoint to resume from (default: latest checkpoint in -checkpoint-dir)")
+	retainedCheckpoints := flag.Int("retained-checkpoints", 0, "completed checkpoints to keep, with the shared state files they reference (default 3)")
+	savepointDir := flag.String("savepoint-dir", "", "directory for savepoints (default savepoints/<pipeline>)")
+	stateDir := flag.String("state-dir", "", "working directory of the pebble state backend (default state/<pipeline>)")
+	stateTTLTime := flag.String("state-ttl-time", "processing", "clock state TTLs are measured against: processing or event")
+	traceExporter := flag.String("trace-exporter", "", "trace batches through the DAG with OpenTelemetry, exporting spans to stdout, otlp or otlp://<host:port> (default: no tracing)")
+	traceSampleRatio := flag.Float64("trace-sample-ratio", 0.01, "fraction of source batches traced with -trace-exporter")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: isotope-runtime [flags] <plan.pb>\n")
+		fmt.Fprintf(os.Stderr, "       isotope-runtime savepoint -admin-addr <addr> <name>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		return 1
 	}
 
-	planPath := os.Args[1]
+	planPath := flag.Arg(0)
 
 	// Load and validate the plan.
 	plan, err := engine.LoadPlan(planPath)
 	if err != nil {
 		slog.Error("failed to load plan", "path", planPath, "error", err)
-		os.Exit(1)
+		return 1
 	}
 
 	slog.Info("loaded execution plan",
@@ -37,17 +83,182 @@ func main() {
 
 	// Create the engine with default allocator.
 	alloc := memory.DefaultAllocator
-	eng := engine.NewEngine(plan, alloc, defaultFactory)
+	eng := engine.NewEngine(plan, alloc, engine.NewOperator)
+	if *checkpointDir != "" {
+		eng.SetCheckpointDir(*checkpointDir)
+	}
+	if *retainedCheckpoints < 0 {
+		slog.Error("-retained-checkpoints must not be negative")
+		return 1
+	}
+	eng.SetRetainedCheckpoints(*retainedCheckpoints)
+	if *savepointDir != "" {
+		eng.SetSavepointDir(*savepointDir)
+	}
+	if *stateDir != "" {
+		eng.SetStateDir(*stateDir)
+	}
+	ttlTime, err := state.ParseTimeDomain(*stateTTLTime)
+	if err != nil {
+		slog.Error("invalid -state-ttl-time", "error", err)
+		return 1
+	}
+	eng.SetStateTTLTime(ttlTime)
+	if *restoreFrom != "" {
+		eng.SetRestoreFrom(*restoreFrom)
+	}
+	eng.SetStateMapping(engine.StateMapping{AllowRemoved: *allowRemovedState, RequireAll: *requireAllState})
+	if *edgeBuffer < 0 || *edgeBufferBytes < 0 {
+		slog.Error("-edge-buffer and -edge-buffer-bytes must not be negative")
+		return 1
+	}
+	eng.SetEdgeBuffer(engine.EdgeBuffer{Batches: *edgeBuffer, Bytes: *edgeBufferBytes})
+	if err := setErrorPolicies(eng, *errorPolicy); err != nil {
+		slog.Error("invalid -error-policy", "error", err)
+		return 1
+	}
+	if *deadLetter != "" {
+		dlq, err := connectors.NewDeadLetterQueue(*deadLetter)
+		if err != nil {
+			slog.Error("invalid -dead-letter", "error", err)
+			return 1
+		}
+		defer dlq.Close()
+		eng.SetDeadLetterQueue(dlq)
+	}
+
+	if *traceExporter != "" {
+		tp, err := tracing.NewTracerProvider(context.Background(), *traceExporter, *traceSampleRatio, plan.PipelineName)
+		if err != nil {
+			slog.Error("invalid -trace-exporter", "error", err)
+			return 1
+		}
+		defer tp.Shutdown(context.Background())
+		eng.SetTracerProvider(tp)
+	}
+	if *adminAddr != "" {
+		if *adminToken == "" {
+			slog.Warn("the admin API is unauthenticated; set -admin-token to require a token", "addr", *adminAddr)
+		}
+		server := admin.Serve(*adminAddr, eng, *adminToken)
+		defer server.Close()
+		slog.Info("serving admin API", "addr", *adminAddr)
+	}
+	if *metricsAddr != "" {
+		server := metrics.ServeMetrics(*metricsAddr)
+		defer server.Close()
+		slog.Info("serving metrics", "addr", *metricsAddr)
+	}
+
+	// Swap in the plan file again on SIGHUP.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	go reloadOnHangup(eng, planPath, hangups)
 
 	// Run with graceful shutdown.
 	if err := engine.RunWithGracefulShutdown(context.Background(), eng, 30*time.Second); err != nil {
 		slog.Error("engine failed", "error", err)
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
-// defaultFactory creates operator instances from OperatorNode descriptors.
-// This is a placeholder — real operator implementations will be registered here.
-func defaultFactory(node *pb.OperatorNode) (interface{}, error) {
-	return nil, fmt.Errorf("operator type %s not yet implemented", node.OperatorType)
+// reloadOnHangup swaps the plan at path into the engine on every signal.
+func reloadOnHangup(eng *engine.Engine, path string, signals <-chan os.Signal) {
+	for range signals {
+		plan, err := engine.LoadPlan(path)
+		if err != nil {
+			slog.Error("plan reload failed", "path", path, "error", err)
+			continue
+		}
+		diff, err := eng.Swap(plan)
+		if err != nil {
+			slog.Error("plan reload failed", "path", path, "error", err)
+			continue
+		}
+		slog.Info("plan reloaded", "path", path,
+			"added", diff.Added, "removed", diff.Removed, "reset", diff.Reset, "kept", diff.Kept)
+	}
+}
+
+// setErrorPolicies applies a comma-separated list of error policies: a bare
+// policy sets the default, operator=policy overrides it for one operator.
+func setErrorPolicies(eng *engine.Engine, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		operatorID, name, perOperator := strings.Cut(entry, "=")
+		if !perOperator {
+			name = operatorID
+		}
+		policy, err := engine.ParseErrorPolicy(name)
+		if err != nil {
+			return err
+		}
+		if perOperator {
+			eng.SetOperatorErrorPolicy(strings.TrimSpace(operatorID), policy)
+		} else {
+			eng.SetErrorPolicy(policy)
+		}
+	}
+	return nil
+}
+
+// savepoint asks a running pipeline's admin API for a savepoint and returns
+// the exit code.
+func savepoint(args []string) int {
+	flags := flag.NewFlagSet("savepoint", flag.ExitOnError)
+	adminAddr := flags.String("admin-addr", "localhost:9091", "admin API address of the running pipeline")
+	adminToken := flags.String("admin-token", "", "bearer token the admin API requires, if any")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: isotope-runtime savepoint [flags] <name>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	body, err := json.Marshal(map[string]string{"name": flags.Arg(0)})
+	if err != nil {
+		slog.Error("savepoint failed", "error", err)
+		return 1
+	}
+	addr := *adminAddr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	req, err := http.NewRequest("POST", addr+"/savepoints", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("savepoint failed", "error", err)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+*adminToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("savepoint failed", "error", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		engine.SavepointInfo
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		slog.Error("savepoint failed", "status", resp.Status, "error", err)
+		return 1
+	}
+	if resp.StatusCode != http.StatusCreated {
+		slog.Error("savepoint failed", "status", resp.Status, "error", result.Error)
+		return 1
+	}
+	fmt.Println(result.Path)
+	return 0
 }
@@ -0,0 +1,195 @@
+// Package admin serves an HTTP API for inspecting and controlling a running
+// Isotope pipeline.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/engine"
+)
+
+// maxBodyBytes bounds the size of a request body, such as a plan to swap in.
+const maxBodyBytes = 16 << 20
+
+// NewHandler returns the admin API of an engine:
+//
+//	GET  /plan                 the execution plan as JSON
+//	PUT  /plan                 swap in a new plan, as Protobuf or, with a JSON content type, as JSON
+//	GET  /chains               the operator IDs of each chain of fused operators
+//	GET  /status               state, row counts and watermark of every operator
+//	GET  /watermarks           the watermark of every operator that has one
+//	GET  /checkpoints/latest   the latest completed checkpoint
+//	POST /checkpoints          trigger a checkpoint
+//	POST /savepoints           take a savepoint named by {"name": ...} and wait for it
+//	POST /stop                 stop the pipeline gracefully
+//
+// If token is not empty, every request must carry it as a bearer token in
+// its Authorization header. Without one the API is open to anyone who can
+// reach it, including the endpoints that swap in a plan or stop the pipeline.
+func NewHandler(eng *engine.Engine, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /plan", func(w http.ResponseWriter, r *http.Request) {
+		data, err := protojson.Marshal(eng.Plan())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("PUT /plan", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, bodyErrorStatus(err), err)
+			return
+		}
+		plan := &pb.ExecutionPlan{}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			err = protojson.Unmarshal(data, plan)
+		} else {
+			plan, err = engine.DeserializePlan(data)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("plan swap requested through the admin API")
+		diff, err := eng.Swap(plan)
+		switch {
+		case errors.Is(err, engine.ErrInvalidPlan):
+			writeError(w, http.StatusBadRequest, err)
+		case err != nil:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeJSON(w, http.StatusOK, diff)
+		}
+	})
+
+	mux.HandleFunc("GET /chains", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string][][]string{"chains": eng.Chains()})
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, eng.Status())
+	})
+
+	mux.HandleFunc("GET /watermarks", func(w http.ResponseWriter, r *http.Request) {
+		watermarks := make(map[string]int64)
+		for _, op := range eng.Status().Operators {
+			if op.Watermark != nil {
+				watermarks[op.ID] = *op.Watermark
+			}
+		}
+		writeJSON(w, http.StatusOK, watermarks)
+	})
+
+	mux.HandleFunc("GET /checkpoints/latest", func(w http.ResponseWriter, r *http.Request) {
+		latest, err := eng.LatestCheckpoint()
+		switch {
+		case errors.Is(err, engine.ErrCheckpointingDisabled):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		case latest == nil:
+			writeError(w, http.StatusNotFound, errors.New("no completed checkpoint"))
+		default:
+			writeJSON(w, http.StatusOK, latest)
+		}
+	})
+
+	mux.HandleFunc("POST /checkpoints", func(w http.ResponseWriter, r *http.Request) {
+		id, err := eng.TriggerCheckpoint()
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]int64{"id": id})
+	})
+
+	mux.HandleFunc("POST /savepoints", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, bodyErrorStatus(err), err)
+			return
+		}
+		info, err := eng.TriggerSavepoint(r.Context(), req.Name)
+		switch {
+		case errors.Is(err, engine.ErrInvalidSavepoint):
+			writeError(w, http.StatusBadRequest, err)
+		case err != nil:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeJSON(w, http.StatusCreated, info)
+		}
+	})
+
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("stop requested through the admin API")
+		eng.Stop()
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "stopping"})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether a request carries token as its bearer token.
+func authorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// bodyErrorStatus returns the status answering a request whose body could
+// not be read.
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Serve starts an HTTP server on the given address serving the admin API of
+// an engine, requiring token if it is not empty.
+func Serve(addr string, eng *engine.Engine, token string) *http.Server {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: NewHandler(eng, token),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin server failed", "addr", addr, "error", err)
+		}
+	}()
+	return server
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,294 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/connectors"
+	"github.com/sandboxws/isotope/runtime/pkg/engine"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// discardSink drops every batch.
+type discardSink struct{}
+
+func (discardSink) Open(_ *operator.Context) error  { return nil }
+func (discardSink) WriteBatch(_ arrow.Record) error { return nil }
+func (discardSink) Close() error                    { return nil }
+
+// passThrough emits every batch unchanged.
+type passThrough struct{}
+
+func (passThrough) Open(_ *operator.Context) error { return nil }
+
+func (passThrough) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	batch.Retain()
+	return []arrow.Record{batch}, nil
+}
+
+func (passThrough) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (passThrough) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
+
+func (passThrough) Close() error { return nil }
+
+// TestAdminAPI runs an unbounded pipeline, inspects it, checkpoints it, takes
+// a savepoint, swaps its plan and stops it through the admin API.
+func TestAdminAPI(t *testing.T) {
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+			{Name: "event_time", ArrowType: pb.ArrowType_ARROW_TYPE_TIMESTAMP_MS},
+		},
+		Watermark: &pb.WatermarkConfig{Column: "event_time"},
+	}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "admin-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "1h", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{Id: "first", Name: "pass", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "second", Name: "pass", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "discard", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "first", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "first", ToOperator: "second", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "second", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 10000, 0), nil
+		case "sink":
+			return discardSink{}, nil
+		default:
+			return passThrough{}, nil
+		}
+	}
+
+	eng := engine.NewEngine(plan, memory.DefaultAllocator, factory)
+	eng.SetCheckpointDir(t.TempDir())
+	savepointDir := t.TempDir()
+	eng.SetSavepointDir(savepointDir)
+	server := httptest.NewServer(NewHandler(eng, ""))
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- eng.Run(context.Background()) }()
+
+	var status engine.PipelineStatus
+	waitFor(t, "the sink to receive rows", func() bool {
+		request(t, server, "GET", "/status", http.StatusOK, &status)
+		return len(status.Operators) == 4 && status.Operators[3].Rows > 0
+	})
+	for _, op := range status.Operators {
+		if op.State != engine.StateRunning {
+			t.Errorf("expected %s to be running, got %s", op.ID, op.State)
+		}
+	}
+
+	var planJSON map[string]any
+	request(t, server, "GET", "/plan", http.StatusOK, &planJSON)
+	if planJSON["pipelineName"] != "admin-test" {
+		t.Errorf("unexpected plan %v", planJSON)
+	}
+
+	var chains struct{ Chains [][]string }
+	request(t, server, "GET", "/chains", http.StatusOK, &chains)
+	if len(chains.Chains) != 1 || !slices.Equal(chains.Chains[0], []string{"first", "second"}) {
+		t.Errorf("expected first and second to be fused, got %v", chains.Chains)
+	}
+
+	var watermarks map[string]int64
+	request(t, server, "GET", "/watermarks", http.StatusOK, &watermarks)
+	if wm := watermarks["src"]; time.Since(time.UnixMilli(wm)) > time.Minute {
+		t.Errorf("expected a current source watermark, got %v", watermarks)
+	}
+
+	request(t, server, "GET", "/checkpoints/latest", http.StatusNotFound, nil)
+	var triggered struct{ ID int64 }
+	request(t, server, "POST", "/checkpoints", http.StatusAccepted, &triggered)
+	var latest engine.CheckpointInfo
+	waitFor(t, "the checkpoint to complete", func() bool {
+		resp, err := http.Get(server.URL + "/checkpoints/latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&latest) == nil
+	})
+	if latest.ID != triggered.ID || !strings.HasSuffix(latest.Path, "chk-1") {
+		t.Errorf("expected checkpoint %d, got %+v", triggered.ID, latest)
+	}
+
+	var info engine.SavepointInfo
+	send(t, server, "POST", "/savepoints", `{"name": "before-upgrade"}`, http.StatusCreated, &info)
+	if info.Name != "before-upgrade" || info.Path != filepath.Join(savepointDir, "before-upgrade") {
+		t.Errorf("unexpected savepoint %+v", info)
+	}
+	send(t, server, "POST", "/savepoints", `{"name": "before-upgrade"}`, http.StatusConflict, nil)
+	send(t, server, "POST", "/savepoints", `{"name": "a/b"}`, http.StatusBadRequest, nil)
+
+	upgraded := proto.Clone(plan).(*pb.ExecutionPlan)
+	upgraded.Operators[2].Name = "renamed"
+	data, err := protojson.Marshal(upgraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff engine.PlanDiff
+	send(t, server, "PUT", "/plan", string(data), http.StatusOK, &diff)
+	if len(diff.Kept) != 4 {
+		t.Errorf("expected every operator to keep its state, got %+v", diff)
+	}
+	waitFor(t, "the upgraded plan to run", func() bool {
+		request(t, server, "GET", "/status", http.StatusOK, &status)
+		return status.Operators[2].Name == "renamed" && status.Operators[3].State == engine.StateRunning
+	})
+	send(t, server, "PUT", "/plan", `{"pipelineName": "other"}`, http.StatusBadRequest, nil)
+
+	request(t, server, "POST", "/stop", http.StatusAccepted, nil)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected a clean stop, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not stop")
+	}
+	request(t, server, "GET", "/status", http.StatusOK, &status)
+	for _, op := range status.Operators {
+		if op.State != engine.StateFinished {
+			t.Errorf("expected %s to be finished, got %s", op.ID, op.State)
+		}
+	}
+}
+
+// TestAdminAPIGuards verifies the admin API requires its token when it has
+// one and refuses oversized request bodies.
+func TestAdminAPIGuards(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "admin-guard-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+		},
+	}
+	eng := engine.NewEngine(plan, memory.DefaultAllocator, nil)
+	server := httptest.NewServer(NewHandler(eng, "secret"))
+	defer server.Close()
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req, err := http.NewRequest("POST", server.URL+"/stop", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected status %d, got %d", auth, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{strings.Repeat(" ", maxBodyBytes+1), http.StatusRequestEntityTooLarge},
+		{`{"pipelineName": "other"}`, http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest("PUT", server.URL+"/plan", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("PUT /plan with %d bytes: expected status %d, got %d", len(tt.body), tt.status, resp.StatusCode)
+		}
+	}
+}
+
+// send sends a request with a JSON body to the admin API, checks the
+// response status and decodes the response into out, if non-nil.
+func send(t *testing.T, server *httptest.Server, method, path, body string, status int, out any) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s %s: expected status %d, got %d", method, path, body, status, resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+// request sends a request to the admin API, checks the response status and
+// decodes the response into out, if non-nil.
+func request(t *testing.T, server *httptest.Server, method, path string, status int, out any) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: expected status %d, got %d", method, path, status, resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
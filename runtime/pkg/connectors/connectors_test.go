@@ -3,6 +3,11 @@ package connectors
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -10,6 +15,7 @@ import (
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/twmb/franz-go/pkg/kgo"
 
 	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
 	"github.com/sandboxws/isotope/runtime/pkg/operator"
@@ -56,6 +62,119 @@ func TestGeneratorMaxRows(t *testing.T) {
 	}
 }
 
+func TestGeneratorRestorePosition(t *testing.T) {
+	alloc := memory.DefaultAllocator
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	gen := NewGenerator(schema, 100000, 50)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opCtx := operator.NewContext(ctx, alloc, "gen", "generator")
+	if err := gen.Open(opCtx); err != nil {
+		t.Fatal(err)
+	}
+	defer gen.Close()
+	if err := gen.RestorePosition([]byte(`{"emitted":40}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan arrow.Record, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- gen.Run(opCtx, out)
+	}()
+
+	var ids []int64
+	for batch := range out {
+		col := batch.Column(0).(*array.Int64)
+		for i := 0; i < col.Len(); i++ {
+			ids = append(ids, col.Value(i))
+		}
+		batch.Release()
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 10 || ids[0] != 40 || ids[9] != 49 {
+		t.Errorf("expected ids 40..49 after restore, got %v", ids)
+	}
+
+	position, err := gen.SnapshotPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(position) != `{"emitted":50}` {
+		t.Errorf("unexpected position after run: %s", position)
+	}
+}
+
+func TestKafkaSourceRestorePositions(t *testing.T) {
+	src := NewKafkaSource("orders", "localhost:9092", "json", nil, "latest-offset", "group")
+	// Partition 1 moved from instance 0 to instance 1 before the checkpoint.
+	err := src.RestorePositions([][]byte{
+		[]byte(`{"topic":"orders","offsets":{"0":10,"1":4}}`),
+		[]byte(`{"topic":"orders","offsets":{"1":7}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	committed := kgo.NewOffset().At(100)
+	assigned := map[string]map[int32]kgo.Offset{"orders": {0: committed, 1: committed, 2: committed}}
+	adjusted, err := src.adjustOffsets(context.Background(), assigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int32]kgo.Offset{
+		0: kgo.NewOffset().At(10).WithEpoch(-1),
+		1: kgo.NewOffset().At(7).WithEpoch(-1),
+		// No records of partition 2 were covered by the checkpoint.
+		2: kgo.NewOffset().AtStart(),
+	}
+	if !reflect.DeepEqual(adjusted["orders"], want) {
+		t.Errorf("expected offsets %v, got %v", want, adjusted["orders"])
+	}
+
+	if err := src.RestorePositions([][]byte{[]byte(`{"topic":"payments","offsets":{}}`)}); err == nil {
+		t.Error("expected a position of another topic to be refused")
+	}
+}
+
+func TestKafkaSourceSplitsPartitionsByInstance(t *testing.T) {
+	opCtx := operator.NewContext(context.Background(), memory.DefaultAllocator, "src", "kafka")
+	opCtx.Parallelism, opCtx.InstanceIndex = 3, 1
+
+	src := NewKafkaSource("orders", "localhost:9092", "json", nil, "", "")
+	if err := src.Open(opCtx); err != nil {
+		t.Fatal(err)
+	}
+	var owned []int32
+	for p := int32(0); p < 8; p++ {
+		if src.owns(p) {
+			owned = append(owned, p)
+		}
+	}
+	if want := []int32{1, 4, 7}; !reflect.DeepEqual(owned, want) {
+		t.Errorf("expected instance 1 of 3 to read partitions %v, got %v", want, owned)
+	}
+
+	grouped := NewKafkaSource("orders", "localhost:9092", "json", nil, "", "group")
+	if err := grouped.Open(opCtx); err != nil {
+		t.Fatal(err)
+	}
+	if !grouped.owns(0) {
+		t.Error("expected a consumer group to assign partitions itself")
+	}
+}
+
 func TestGeneratorSchema(t *testing.T) {
 	alloc := memory.DefaultAllocator
 
@@ -117,6 +236,71 @@ func TestGeneratorSchema(t *testing.T) {
 	}
 }
 
+func TestFileDeadLetterQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	dlq, err := NewDeadLetterQueue("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{`{"id":1`, "not json \xff"} {
+		letter := operator.DeadLetter{OperatorID: "src", Error: "decode failed", Payload: []byte(payload)}
+		if err := dlq.Send(letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dlq.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), data)
+	}
+	var letter operator.DeadLetter
+	if err := json.Unmarshal([]byte(lines[1]), &letter); err != nil {
+		t.Fatal(err)
+	}
+	// Payloads need not be valid UTF-8.
+	if letter.OperatorID != "src" || string(letter.Payload) != "not json \xff" {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+
+	if _, err := NewDeadLetterQueue("kafka://localhost:9092"); err == nil {
+		t.Error("expected an error for a kafka spec without a topic")
+	}
+}
+
+// collectedDeadLetters keeps the letters sent to it.
+type collectedDeadLetters struct{ letters []operator.DeadLetter }
+
+func (d *collectedDeadLetters) Send(letter operator.DeadLetter) error {
+	d.letters = append(d.letters, letter)
+	return nil
+}
+
+func (d *collectedDeadLetters) Close() error { return nil }
+
+func TestKafkaSourceDeadLettersFailedChunk(t *testing.T) {
+	dlq := &collectedDeadLetters{}
+	opCtx := operator.NewContext(context.Background(), memory.DefaultAllocator, "src", "kafka")
+	opCtx.DeadLetters = dlq
+
+	deadLetterChunk(opCtx, []kafkaRecordPosition{
+		{partition: 0, offset: 7, value: []byte(`{"id":1}`)},
+		{partition: 2, offset: 3, value: []byte("\xff")},
+	}, errors.New("bad batch"))
+	if len(dlq.letters) != 2 {
+		t.Fatalf("expected one letter per record, got %d", len(dlq.letters))
+	}
+	if got := dlq.letters[1]; string(got.Payload) != "\xff" || !strings.Contains(got.Error, "partition 2, offset 3") {
+		t.Errorf("unexpected dead letter: %+v", got)
+	}
+}
+
 func TestConsole(t *testing.T) {
 	alloc := memory.DefaultAllocator
 
@@ -199,3 +383,90 @@ func TestConsoleMaxRows(t *testing.T) {
 		t.Errorf("expected truncation message, got:\n%s", output)
 	}
 }
+
+// changelogBatch returns a batch of (id, name) rows with the row kinds
+// +I, -U, +U, -D.
+func changelogBatch(t *testing.T) arrow.Record {
+	t.Helper()
+	alloc := memory.DefaultAllocator
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: operator.RowKindColumn, Type: arrow.PrimitiveTypes.Int8},
+	}, nil)
+	bldr := array.NewRecordBuilder(alloc, schema)
+	defer bldr.Release()
+	bldr.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 1, 1, 2}, nil)
+	bldr.Field(1).(*array.StringBuilder).AppendValues([]string{"alice", "alice", "alicia", "bob"}, nil)
+	bldr.Field(2).(*array.Int8Builder).AppendValues([]int8{
+		int8(operator.Insert), int8(operator.UpdateBefore), int8(operator.UpdateAfter), int8(operator.Delete),
+	}, nil)
+	return bldr.NewRecord()
+}
+
+func TestConsoleRowKinds(t *testing.T) {
+	batch := changelogBatch(t)
+	defer batch.Release()
+
+	var buf bytes.Buffer
+	c := NewConsole(10)
+	c.writer = &buf
+	if err := c.WriteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| +I", "| -U", "| +U", "| -D"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output should contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestKafkaSinkRowKinds(t *testing.T) {
+	batch := changelogBatch(t)
+	defer batch.Release()
+
+	// A retract stream keeps every row and its kind.
+	sink := NewKafkaSink("users", "localhost:9092", "json", []string{"id"})
+	records, err := sink.records(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, rec := range records {
+		var value map[string]interface{}
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, value[operator.RowKindColumn].(string))
+	}
+	if got := strings.Join(kinds, " "); got != "+I -U +U -D" {
+		t.Errorf("expected every row kind, got %s", got)
+	}
+
+	// An upsert topic gets the latest values and a tombstone.
+	sink.SetUpsert(true)
+	if records, err = sink.records(batch); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, string(rec.Key)+"="+string(rec.Value))
+	}
+	want := []string{
+		`{"id":"1"}={"id":"1","name":"alice"}`,
+		`{"id":"1"}={"id":"1","name":"alicia"}`,
+		`{"id":"2"}=`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected upsert records\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if records[2].Value != nil {
+		t.Error("expected a delete to be a tombstone with a nil value")
+	}
+
+	sink = NewKafkaSink("users", "localhost:9092", "json", nil)
+	sink.SetUpsert(true)
+	if err := sink.Open(nil); err == nil || !strings.Contains(err.Error(), "key columns") {
+		t.Errorf("expected an upsert topic without key columns to be refused, got %v", err)
+	}
+}
@@ -12,7 +12,8 @@ import (
 	"github.com/sandboxws/isotope/runtime/pkg/operator"
 )
 
-// Console prints Arrow RecordBatches to stdout as formatted tables.
+// Console prints Arrow RecordBatches to stdout as formatted tables. The row
+// kind column of a changelog batch is printed as +I, -U, +U or -D.
 type Console struct {
 	maxRows int32
 	writer  io.Writer
@@ -45,7 +46,7 @@ func (c *Console) WriteBatch(batch arrow.Record) error {
 	}
 	for row := 0; row < numRows; row++ {
 		for col := 0; col < numCols; col++ {
-			val := formatValue(batch.Column(col), row)
+			val := formatCell(schema.Field(col), batch.Column(col), row)
 			if len(val) > widths[col] {
 				widths[col] = len(val)
 			}
@@ -106,13 +107,21 @@ func (c *Console) printDataRow(batch arrow.Record, widths []int, row int) {
 		if col > 0 {
 			sb.WriteString(" | ")
 		}
-		val := formatValue(batch.Column(col), row)
+		val := formatCell(batch.Schema().Field(col), batch.Column(col), row)
 		sb.WriteString(padRight(val, widths[col]))
 	}
 	sb.WriteString(" |")
 	fmt.Fprintln(c.writer, sb.String())
 }
 
+// formatCell formats a value of column f, rendering row kinds by name.
+func formatCell(f arrow.Field, arr arrow.Array, row int) string {
+	if kinds, ok := arr.(*array.Int8); ok && f.Name == operator.RowKindColumn {
+		return operator.RowKindAt(kinds, row).String()
+	}
+	return formatValue(arr, row)
+}
+
 func formatValue(arr arrow.Array, row int) string {
 	if arr.IsNull(row) {
 		return "NULL"
@@ -0,0 +1,100 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// NewDeadLetterQueue creates a dead-letter queue from a spec:
+//
+//	console                       JSON lines on stderr
+//	file:<path>                   JSON lines appended to a file
+//	kafka://<brokers>/<topic>     JSON records produced to a Kafka topic
+func NewDeadLetterQueue(spec string) (operator.DeadLetterQueue, error) {
+	switch {
+	case spec == "console":
+		return NewJSONLDeadLetters(os.Stderr, nil), nil
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("dead-letter file: %w", err)
+		}
+		return NewJSONLDeadLetters(f, f), nil
+	case strings.HasPrefix(spec, "kafka://"):
+		brokers, topic, ok := strings.Cut(strings.TrimPrefix(spec, "kafka://"), "/")
+		if !ok || brokers == "" || topic == "" {
+			return nil, fmt.Errorf("dead-letter kafka spec %q, expected kafka://<brokers>/<topic>", spec)
+		}
+		return NewKafkaDeadLetters(brokers, topic)
+	default:
+		return nil, fmt.Errorf("unknown dead-letter queue %q, expected console, file:<path> or kafka://<brokers>/<topic>", spec)
+	}
+}
+
+// JSONLDeadLetters writes dead letters as JSON lines.
+type JSONLDeadLetters struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewJSONLDeadLetters writes dead letters to w. closer, if non-nil, is closed
+// by Close.
+func NewJSONLDeadLetters(w io.Writer, closer io.Closer) *JSONLDeadLetters {
+	return &JSONLDeadLetters{enc: json.NewEncoder(w), closer: closer}
+}
+
+func (d *JSONLDeadLetters) Send(letter operator.DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.enc.Encode(letter)
+}
+
+func (d *JSONLDeadLetters) Close() error {
+	if d.closer != nil {
+		return d.closer.Close()
+	}
+	return nil
+}
+
+// KafkaDeadLetters produces dead letters to a Kafka topic, keyed by operator ID.
+type KafkaDeadLetters struct {
+	client *kgo.Client
+}
+
+// NewKafkaDeadLetters creates a dead-letter queue producing to topic.
+func NewKafkaDeadLetters(bootstrapServers, topic string) (*KafkaDeadLetters, error) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(strings.Split(bootstrapServers, ",")...),
+		kgo.DefaultProduceTopic(topic),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dead-letter kafka: create client: %w", err)
+	}
+	return &KafkaDeadLetters{client: client}, nil
+}
+
+// Send produces the letter synchronously, so a letter is never lost silently.
+func (d *KafkaDeadLetters) Send(letter operator.DeadLetter) error {
+	value, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	rec := &kgo.Record{Key: []byte(letter.OperatorID), Value: value}
+	return d.client.ProduceSync(context.Background(), rec).FirstErr()
+}
+
+func (d *KafkaDeadLetters) Close() error {
+	d.client.Close()
+	return nil
+}
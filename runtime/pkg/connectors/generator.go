@@ -2,6 +2,7 @@
 package connectors
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -16,11 +17,17 @@ import (
 const defaultBatchSize = 1024
 
 // Generator produces synthetic Arrow RecordBatches at a configurable rate.
+// When run with parallelism > 1, each instance generates an interleaved slice
+// of the sequence (instance i emits i, i+p, i+2p, ...) and an equal share of
+// the rate and row limit, so the instances together match a single generator.
 type Generator struct {
 	schema        *pb.Schema
 	rowsPerSecond int64
 	maxRows       int64
 	alloc         memory.Allocator
+	instance      int64
+	parallelism   int64
+	emitted       int64 // rows of this instance's sequence sent so far
 }
 
 // NewGenerator creates a Generator source.
@@ -29,18 +36,24 @@ func NewGenerator(schema *pb.Schema, rowsPerSecond, maxRows int64) *Generator {
 		schema:        schema,
 		rowsPerSecond: rowsPerSecond,
 		maxRows:       maxRows,
+		parallelism:   1,
 	}
 }
 
 func (g *Generator) Open(ctx *operator.Context) error {
 	g.alloc = ctx.Alloc
+	g.instance = int64(ctx.InstanceIndex)
+	g.parallelism = int64(ctx.Parallelism)
+	if g.parallelism < 1 {
+		g.parallelism = 1
+	}
 	return nil
 }
 
 func (g *Generator) Run(ctx *operator.Context, out chan<- arrow.Record) error {
 	defer close(out)
 
-	arrowSchema, err := protoSchemaToArrow(g.schema)
+	arrowSchema, err := ProtoSchemaToArrow(g.schema)
 	if err != nil {
 		return fmt.Errorf("generator: build schema: %w", err)
 	}
@@ -49,6 +62,19 @@ func (g *Generator) Run(ctx *operator.Context, out chan<- arrow.Record) error {
 	if rps <= 0 {
 		rps = 1000
 	}
+	rps /= g.parallelism
+	if rps < 1 {
+		rps = 1
+	}
+
+	// This instance's share of maxRows: rows whose sequence number ≡ instance (mod p).
+	maxRows := g.maxRows
+	if maxRows > 0 {
+		maxRows = (g.maxRows - g.instance + g.parallelism - 1) / g.parallelism
+		if maxRows <= 0 {
+			return nil
+		}
+	}
 
 	batchSize := defaultBatchSize
 	if int64(batchSize) > rps {
@@ -59,17 +85,16 @@ func (g *Generator) Run(ctx *operator.Context, out chan<- arrow.Record) error {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	var totalEmitted int64
-	var seq int64
-
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case t := <-ctx.Checkpoints:
+			t.Ack()
 		case <-ticker.C:
 			remaining := int64(batchSize)
-			if g.maxRows > 0 {
-				left := g.maxRows - totalEmitted
+			if maxRows > 0 {
+				left := maxRows - g.emitted
 				if left <= 0 {
 					return nil
 				}
@@ -78,27 +103,58 @@ func (g *Generator) Run(ctx *operator.Context, out chan<- arrow.Record) error {
 				}
 			}
 
-			batch := g.generateBatch(arrowSchema, seq, int(remaining))
-			select {
-			case out <- batch:
-				totalEmitted += remaining
-				seq += remaining
-				ctx.Metrics.BatchesProcessed.Add(1)
-				ctx.Metrics.RowsProcessed.Add(remaining)
-			case <-ctx.Done():
-				batch.Release()
+			batch := g.generateBatch(arrowSchema, g.emitted, int(remaining))
+			if !sendBatch(ctx, out, batch) {
 				return nil
 			}
+			g.emitted += remaining
+			ctx.Metrics.AddBatch(remaining)
 
-			if g.maxRows > 0 && totalEmitted >= g.maxRows {
+			if maxRows > 0 && g.emitted >= maxRows {
 				return nil
 			}
 		}
 	}
 }
 
+// generatorPosition is the checkpointed read position of a Generator instance.
+type generatorPosition struct {
+	Emitted int64 `json:"emitted"`
+}
+
+// SnapshotPosition records how far into its sequence this instance has got.
+func (g *Generator) SnapshotPosition() ([]byte, error) {
+	return json.Marshal(generatorPosition{Emitted: g.emitted})
+}
+
+// RestorePosition makes Run continue the sequence where a checkpoint left off.
+func (g *Generator) RestorePosition(position []byte) error {
+	var pos generatorPosition
+	if err := json.Unmarshal(position, &pos); err != nil {
+		return fmt.Errorf("generator: restore position: %w", err)
+	}
+	g.emitted = pos.Emitted
+	return nil
+}
+
 func (g *Generator) Close() error { return nil }
 
+// sendBatch sends batch on out, acking any checkpoint trigger that arrives
+// while it waits. It returns false, releasing batch, if ctx is done first.
+func sendBatch(ctx *operator.Context, out chan<- arrow.Record, batch arrow.Record) bool {
+	for {
+		select {
+		case out <- batch:
+			return true
+		case t := <-ctx.Checkpoints:
+			t.Ack()
+		case <-ctx.Done():
+			batch.Release()
+			return false
+		}
+	}
+}
+
 func (g *Generator) generateBatch(schema *arrow.Schema, startSeq int64, numRows int) arrow.Record {
 	builders := make([]array.Builder, schema.NumFields())
 	for i := 0; i < schema.NumFields(); i++ {
@@ -108,7 +164,7 @@ func (g *Generator) generateBatch(schema *arrow.Schema, startSeq int64, numRows
 	now := time.Now().UnixMilli()
 
 	for row := 0; row < numRows; row++ {
-		seq := startSeq + int64(row)
+		seq := (startSeq+int64(row))*g.parallelism + g.instance
 		for i := 0; i < schema.NumFields(); i++ {
 			f := schema.Field(i)
 			switch f.Type.ID() {
@@ -143,15 +199,15 @@ func (g *Generator) generateBatch(schema *arrow.Schema, startSeq int64, numRows
 	return rec
 }
 
-// protoSchemaToArrow converts a protobuf Schema to an Arrow schema.
-func protoSchemaToArrow(s *pb.Schema) (*arrow.Schema, error) {
+// ProtoSchemaToArrow converts a protobuf Schema to an Arrow schema.
+func ProtoSchemaToArrow(s *pb.Schema) (*arrow.Schema, error) {
 	if s == nil {
 		return nil, fmt.Errorf("nil schema")
 	}
 
 	fields := make([]arrow.Field, len(s.Fields))
 	for i, f := range s.Fields {
-		dt, err := protoTypeToArrow(f.ArrowType)
+		dt, err := ProtoTypeToArrow(f.ArrowType)
 		if err != nil {
 			return nil, fmt.Errorf("field %q: %w", f.Name, err)
 		}
@@ -160,7 +216,8 @@ func protoSchemaToArrow(s *pb.Schema) (*arrow.Schema, error) {
 	return arrow.NewSchema(fields, nil), nil
 }
 
-func protoTypeToArrow(t pb.ArrowType) (arrow.DataType, error) {
+// ProtoTypeToArrow maps a protobuf ArrowType to the corresponding Arrow data type.
+func ProtoTypeToArrow(t pb.ArrowType) (arrow.DataType, error) {
 	switch t {
 	case pb.ArrowType_ARROW_TYPE_INT8:
 		return arrow.PrimitiveTypes.Int8, nil
@@ -12,11 +12,17 @@ import (
 )
 
 // KafkaSink serializes Arrow RecordBatches and produces them to a Kafka topic.
+//
+// Rows of a changelog batch carry their row kind in the __op field. On an
+// upsert topic they do not: inserts and updates are produced as the latest
+// value of their key, deletes as tombstones, and retractions of updated rows
+// are skipped, as the update that follows replaces them.
 type KafkaSink struct {
 	topic            string
 	bootstrapServers string
 	format           string
 	keyBy            []string
+	upsert           bool
 	client           *kgo.Client
 }
 
@@ -30,7 +36,13 @@ func NewKafkaSink(topic, bootstrapServers, format string, keyBy []string) *Kafka
 	}
 }
 
+// SetUpsert makes the sink write an upsert topic, keyed by the key columns.
+func (k *KafkaSink) SetUpsert(upsert bool) { k.upsert = upsert }
+
 func (k *KafkaSink) Open(_ *operator.Context) error {
+	if k.upsert && len(k.keyBy) == 0 {
+		return fmt.Errorf("kafka sink: upsert topic %s needs key columns", k.topic)
+	}
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers(k.bootstrapServers),
 		kgo.DefaultProduceTopic(k.topic),
@@ -43,10 +55,37 @@ func (k *KafkaSink) Open(_ *operator.Context) error {
 }
 
 func (k *KafkaSink) WriteBatch(batch arrow.Record) error {
+	records, err := k.records(batch)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		k.client.Produce(context.Background(), rec, nil)
+	}
+
+	// Flush to ensure delivery.
+	if err := k.client.Flush(context.Background()); err != nil {
+		return fmt.Errorf("kafka sink: flush: %w", err)
+	}
+	return nil
+}
+
+// records serializes the rows of a batch into Kafka records.
+func (k *KafkaSink) records(batch arrow.Record) ([]*kgo.Record, error) {
 	numRows := int(batch.NumRows())
 	schema := batch.Schema()
+	kinds, err := operator.RowKinds(batch)
+	if err != nil {
+		return nil, fmt.Errorf("kafka sink: %w", err)
+	}
 
+	records := make([]*kgo.Record, 0, numRows)
 	for row := 0; row < numRows; row++ {
+		kind := operator.RowKindAt(kinds, row)
+		if k.upsert && kind == operator.UpdateBefore {
+			continue
+		}
+
 		// Build JSON record.
 		record := make(map[string]interface{}, schema.NumFields())
 		for col := 0; col < schema.NumFields(); col++ {
@@ -55,17 +94,21 @@ func (k *KafkaSink) WriteBatch(batch arrow.Record) error {
 			if arr.IsNull(row) {
 				record[f.Name] = nil
 			} else {
-				record[f.Name] = extractJSONValue(arr, row)
+				record[f.Name] = extractJSONValue(f, arr, row)
 			}
 		}
 
-		value, err := json.Marshal(record)
-		if err != nil {
-			return fmt.Errorf("kafka sink: marshal row %d: %w", row, err)
+		rec := &kgo.Record{}
+		if k.upsert {
+			delete(record, operator.RowKindColumn)
 		}
-
-		rec := &kgo.Record{
-			Value: value,
+		// A delete on an upsert topic is a tombstone: a key without a value.
+		if !k.upsert || kind != operator.Delete {
+			value, err := json.Marshal(record)
+			if err != nil {
+				return nil, fmt.Errorf("kafka sink: marshal row %d: %w", row, err)
+			}
+			rec.Value = value
 		}
 
 		// Set key for partitioning.
@@ -79,15 +122,9 @@ func (k *KafkaSink) WriteBatch(batch arrow.Record) error {
 			keyBytes, _ := json.Marshal(keyParts)
 			rec.Key = keyBytes
 		}
-
-		k.client.Produce(context.Background(), rec, nil)
+		records = append(records, rec)
 	}
-
-	// Flush to ensure delivery.
-	if err := k.client.Flush(context.Background()); err != nil {
-		return fmt.Errorf("kafka sink: flush: %w", err)
-	}
-	return nil
+	return records, nil
 }
 
 func (k *KafkaSink) Close() error {
@@ -97,6 +134,6 @@ func (k *KafkaSink) Close() error {
 	return nil
 }
 
-func extractJSONValue(arr arrow.Array, row int) interface{} {
-	return formatValue(arr, row)
+func extractJSONValue(f arrow.Field, arr arrow.Array, row int) interface{} {
+	return formatCell(f, arr, row)
 }
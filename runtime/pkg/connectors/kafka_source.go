@@ -3,7 +3,10 @@ package connectors
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
@@ -15,6 +18,8 @@ import (
 )
 
 // KafkaSource consumes records from a Kafka topic and produces Arrow RecordBatches.
+// Parallel instances split the topic's partitions: through the consumer group
+// if there is one, else by partition number.
 type KafkaSource struct {
 	topic            string
 	bootstrapServers string
@@ -23,8 +28,27 @@ type KafkaSource struct {
 	startupMode      string
 	consumerGroup    string
 	alloc            memory.Allocator
+
+	// Without a consumer group, instance index of parallelism reads the
+	// partitions p with p % parallelism == index.
+	index       int
+	parallelism int
+
+	// offsets holds the next offset to read per partition, counting only
+	// records that have been sent downstream. Run updates it; mu guards it
+	// against the consumer group assigning partitions concurrently.
+	mu      sync.Mutex
+	offsets map[int32]int64
+	// restored is set when the source resumes from a checkpoint. Partitions
+	// it has no offset for then start at their beginning: they held no
+	// records the checkpoint covers.
+	restored bool
 }
 
+// kafkaPollTimeout bounds each poll so that checkpoint triggers and shutdown
+// are noticed while the topic is idle.
+const kafkaPollTimeout = time.Second
+
 // NewKafkaSource creates a Kafka source connector.
 func NewKafkaSource(topic, bootstrapServers, format string, schema *pb.Schema, startupMode, consumerGroup string) *KafkaSource {
 	return &KafkaSource{
@@ -34,39 +58,31 @@ func NewKafkaSource(topic, bootstrapServers, format string, schema *pb.Schema, s
 		schema:           schema,
 		startupMode:      startupMode,
 		consumerGroup:    consumerGroup,
+		offsets:          make(map[int32]int64),
 	}
 }
 
 func (k *KafkaSource) Open(ctx *operator.Context) error {
 	k.alloc = ctx.Alloc
+	k.index, k.parallelism = ctx.InstanceIndex, max(ctx.Parallelism, 1)
 	return nil
 }
 
+// owns reports whether this instance reads a partition. A consumer group
+// assigns partitions itself.
+func (k *KafkaSource) owns(partition int32) bool {
+	return k.consumerGroup != "" || int(partition)%k.parallelism == k.index
+}
+
 func (k *KafkaSource) Run(ctx *operator.Context, out chan<- arrow.Record) error {
 	defer close(out)
 
-	arrowSchema, err := protoSchemaToArrow(k.schema)
+	arrowSchema, err := ProtoSchemaToArrow(k.schema)
 	if err != nil {
 		return fmt.Errorf("kafka source: build schema: %w", err)
 	}
 
-	opts := []kgo.Opt{
-		kgo.SeedBrokers(k.bootstrapServers),
-		kgo.ConsumeTopics(k.topic),
-	}
-
-	if k.consumerGroup != "" {
-		opts = append(opts, kgo.ConsumerGroup(k.consumerGroup))
-	}
-
-	switch k.startupMode {
-	case "earliest-offset", "earliest":
-		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
-	case "latest-offset", "latest":
-		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()))
-	default:
-		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
-	}
+	opts := append([]kgo.Opt{kgo.SeedBrokers(k.bootstrapServers)}, k.consumeOpts()...)
 
 	client, err := kgo.NewClient(opts...)
 	if err != nil {
@@ -76,57 +92,190 @@ func (k *KafkaSource) Run(ctx *operator.Context, out chan<- arrow.Record) error
 
 	batchSize := defaultBatchSize
 	var buffer []map[string]interface{}
+	var positions []kafkaRecordPosition // source position and value of each buffered row
+	positioned := make(map[int32]bool)  // partitions fetched from so far
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case t := <-ctx.Checkpoints:
+			t.Ack()
 		default:
 		}
 
-		fetches := client.PollFetches(context.Background())
+		pollCtx, cancel := context.WithTimeout(ctx.Ctx, kafkaPollTimeout)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
 		if errs := fetches.Errors(); len(errs) > 0 {
 			for _, e := range errs {
+				if errors.Is(e.Err, context.DeadlineExceeded) || errors.Is(e.Err, context.Canceled) {
+					continue
+				}
 				ctx.Logger.Error("kafka fetch error", "topic", e.Topic, "partition", e.Partition, "error", e.Err)
 			}
 			continue
 		}
 
-		fetches.EachRecord(func(rec *kgo.Record) {
-			switch k.format {
-			case "json":
-				var row map[string]interface{}
-				if err := json.Unmarshal(rec.Value, &row); err != nil {
-					ctx.Logger.Error("kafka json decode error", "error", err)
-					return
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			if len(p.Records) == 0 {
+				return
+			}
+			if !k.owns(p.Partition) {
+				// Another instance reads it; stop fetching it here.
+				if !positioned[p.Partition] {
+					client.PauseFetchPartitions(map[string][]int32{k.topic: {p.Partition}})
+					positioned[p.Partition] = true
+				}
+				return
+			}
+			// Records before the offset already sent downstream are skipped:
+			// a direct consumer starts a restored partition at its reset
+			// offset and is moved to the restored one only once it sees it.
+			next, ok := k.offsets[p.Partition]
+			seek := ok && k.consumerGroup == "" && !positioned[p.Partition] && p.Records[0].Offset < next
+			positioned[p.Partition] = true
+			if seek {
+				// The partition is fetched again from next, records of this
+				// fetch included.
+				client.SetOffsets(map[string]map[int32]kgo.EpochOffset{k.topic: {p.Partition: {Epoch: -1, Offset: next}}})
+				return
+			}
+			for _, rec := range p.Records {
+				if ok && rec.Offset < next {
+					continue
+				}
+				switch k.format {
+				case "json":
+					var row map[string]interface{}
+					if err := json.Unmarshal(rec.Value, &row); err != nil {
+						ctx.DeadLetter(rec.Value, fmt.Errorf("kafka json decode (partition %d, offset %d): %w", rec.Partition, rec.Offset, err))
+						continue
+					}
+					buffer = append(buffer, row)
+					positions = append(positions, kafkaRecordPosition{partition: rec.Partition, offset: rec.Offset, value: rec.Value})
+				default:
+					ctx.DeadLetter(rec.Value, fmt.Errorf("kafka source: unsupported format %q", k.format))
 				}
-				buffer = append(buffer, row)
-			default:
-				ctx.Logger.Error("unsupported format", "format", k.format)
 			}
 		})
 
 		// Emit batches.
 		for len(buffer) >= batchSize {
 			chunk := buffer[:batchSize]
+			chunkPositions := positions[:batchSize]
 			buffer = buffer[batchSize:]
+			positions = positions[batchSize:]
 
 			batch, err := jsonRowsToRecord(k.alloc, arrowSchema, chunk)
 			if err != nil {
-				ctx.Logger.Error("kafka build batch error", "error", err)
-				continue
+				deadLetterChunk(ctx, chunkPositions, err)
+			} else if !sendBatch(ctx, out, batch) {
+				return nil
+			}
+			k.mu.Lock()
+			for _, pos := range chunkPositions {
+				k.offsets[pos.partition] = pos.offset + 1
+			}
+			k.mu.Unlock()
+			if batch != nil {
+				ctx.Metrics.AddBatch(int64(batchSize))
 			}
+		}
+	}
+}
 
-			select {
-			case out <- batch:
-				ctx.Metrics.BatchesProcessed.Add(1)
-				ctx.Metrics.RowsProcessed.Add(int64(batchSize))
-			case <-ctx.Done():
-				batch.Release()
-				return nil
+// kafkaRecordPosition locates one consumed record within the topic.
+type kafkaRecordPosition struct {
+	partition int32
+	offset    int64
+	value     []byte // kept to dead-letter the record if its batch fails
+}
+
+// deadLetterChunk hands every record of a chunk that could not be built into
+// a batch to the dead-letter queue, one letter per record.
+func deadLetterChunk(ctx *operator.Context, records []kafkaRecordPosition, err error) {
+	for _, rec := range records {
+		ctx.DeadLetter(rec.value, fmt.Errorf("kafka build batch (partition %d, offset %d): %w", rec.partition, rec.offset, err))
+	}
+}
+
+// kafkaPosition is the checkpointed read position of a KafkaSource instance.
+type kafkaPosition struct {
+	Topic   string          `json:"topic"`
+	Offsets map[int32]int64 `json:"offsets"` // next offset to read per partition
+}
+
+// SnapshotPosition records, per partition, the offset after the last record
+// sent downstream. Rows still buffered toward the next batch are not counted.
+func (k *KafkaSource) SnapshotPosition() ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return json.Marshal(kafkaPosition{Topic: k.topic, Offsets: k.offsets})
+}
+
+// RestorePosition makes Run resume each partition at its checkpointed offset.
+func (k *KafkaSource) RestorePosition(position []byte) error {
+	return k.RestorePositions([][]byte{position})
+}
+
+// RestorePositions makes Run resume every partition any instance recorded at
+// its checkpointed offset, as a consumer group may assign it to any instance.
+// Where instances disagree, the furthest offset wins: a partition moves on
+// from the instance that last read it.
+func (k *KafkaSource) RestorePositions(positions [][]byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, position := range positions {
+		var pos kafkaPosition
+		if err := json.Unmarshal(position, &pos); err != nil {
+			return fmt.Errorf("kafka source: restore position: %w", err)
+		}
+		if pos.Topic != k.topic {
+			return fmt.Errorf("kafka source: checkpoint is for topic %q, not %q", pos.Topic, k.topic)
+		}
+		for partition, offset := range pos.Offsets {
+			if prev, ok := k.offsets[partition]; !ok || offset > prev {
+				k.offsets[partition] = offset
 			}
 		}
 	}
+	k.restored = true
+	return nil
+}
+
+// consumeOpts returns the client options selecting what to consume: every
+// partition of the topic, starting at the offset restored for it. In a
+// consumer group, assigned partitions start there instead of at their
+// committed offsets; a direct consumer is moved there in Run. Partitions
+// without an offset start per the startup mode, or at their beginning after
+// a restore.
+func (k *KafkaSource) consumeOpts() []kgo.Opt {
+	reset := kgo.NewOffset().AtStart()
+	if !k.restored && (k.startupMode == "latest-offset" || k.startupMode == "latest") {
+		reset = kgo.NewOffset().AtEnd()
+	}
+	opts := []kgo.Opt{kgo.ConsumeTopics(k.topic), kgo.ConsumeResetOffset(reset)}
+	if k.consumerGroup == "" {
+		return opts
+	}
+	return append(opts, kgo.ConsumerGroup(k.consumerGroup), kgo.AdjustFetchOffsetsFn(k.adjustOffsets))
+}
+
+// adjustOffsets moves the partitions a consumer group assigns from their
+// committed offsets to those the source has sent downstream up to.
+func (k *KafkaSource) adjustOffsets(_ context.Context, assigned map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for partition := range assigned[k.topic] {
+		if offset, ok := k.offsets[partition]; ok {
+			// A negative epoch skips data loss detection against the restored offset.
+			assigned[k.topic][partition] = kgo.NewOffset().At(offset).WithEpoch(-1)
+		} else if k.restored {
+			assigned[k.topic][partition] = kgo.NewOffset().AtStart()
+		}
+	}
+	return assigned, nil
 }
 
 func (k *KafkaSource) Close() error { return nil }
@@ -62,20 +62,10 @@ func (m *MicroBatchOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, e
 	return nil, nil
 }
 
-func (m *MicroBatchOperator) ProcessWatermark(_ operator.Watermark) error {
-	// Flush on watermark.
-	if len(m.buffer) > 0 {
-		results, err := m.flush()
-		if err != nil {
-			return err
-		}
-		// In a watermark context, we'd need to emit these results.
-		// For now, release them (the engine should handle this via ProcessBatch).
-		for _, r := range results {
-			r.Release()
-		}
-	}
-	return nil
+// ProcessWatermark flushes any buffered batches so results are not held back
+// once event time has moved past them.
+func (m *MicroBatchOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return m.flush()
 }
 
 func (m *MicroBatchOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error {
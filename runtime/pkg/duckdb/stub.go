@@ -56,6 +56,6 @@ func (m *MicroBatchOperator) ProcessBatch(_ arrow.Record) ([]arrow.Record, error
 	return nil, ErrDuckDBNotAvailable
 }
 
-func (m *MicroBatchOperator) ProcessWatermark(_ operator.Watermark) error          { return nil }
-func (m *MicroBatchOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (m *MicroBatchOperator) Close() error                                        { return nil }
+func (m *MicroBatchOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (m *MicroBatchOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (m *MicroBatchOperator) Close() error                                                  { return nil }
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sandboxws/isotope/runtime/pkg/metrics"
+)
+
+// budgetedChannelBuffer is the channel capacity of an edge bounded by bytes
+// rather than batches, large enough that the byte budget binds first.
+const budgetedChannelBuffer = 1024
+
+// EdgeBuffer bounds what may queue on an edge toward each downstream instance
+// before senders block.
+type EdgeBuffer struct {
+	// Batches is the channel capacity in batches. Zero means 16, or, with a
+	// byte budget, a capacity large enough for the budget to bind instead.
+	Batches int
+	// Bytes, if positive, blocks senders while this many bytes of batches are
+	// queued. A single larger batch is still let through on an empty queue.
+	Bytes int64
+}
+
+// SetEdgeBuffer sets the buffer of every edge without one of its own.
+func (e *Engine) SetEdgeBuffer(buf EdgeBuffer) {
+	e.edgeBuffer = buf
+}
+
+// SetEdgeBufferFor sets the buffer of the edge between two operators.
+func (e *Engine) SetEdgeBufferFor(from, to string, buf EdgeBuffer) {
+	if e.edgeBuffers == nil {
+		e.edgeBuffers = make(map[[2]string]EdgeBuffer)
+	}
+	e.edgeBuffers[[2]string{from, to}] = buf
+}
+
+// bufferFor returns the buffer of the edge between two operators.
+func (e *Engine) bufferFor(from, to string) EdgeBuffer {
+	buf, ok := e.edgeBuffers[[2]string{from, to}]
+	if !ok {
+		buf = e.edgeBuffer
+	}
+	if buf.Batches <= 0 {
+		buf.Batches = defaultChannelBuffer
+		if buf.Bytes > 0 {
+			buf.Batches = budgetedChannelBuffer
+		}
+	}
+	return buf
+}
+
+// edgeMetrics holds the backpressure metrics of one edge, resolved once so
+// that sending a batch does not look up label values.
+type edgeMetrics struct {
+	depth   prometheus.Gauge
+	rows    prometheus.Gauge
+	bytes   prometheus.Gauge
+	blocked prometheus.Observer
+}
+
+func newEdgeMetrics(from, to string) *edgeMetrics {
+	return &edgeMetrics{
+		depth:   metrics.EdgeQueueDepth.WithLabelValues(from, to),
+		rows:    metrics.EdgeRowsInFlight.WithLabelValues(from, to),
+		bytes:   metrics.EdgeBytesInFlight.WithLabelValues(from, to),
+		blocked: metrics.EdgeSendBlocked.WithLabelValues(from, to),
+	}
+}
+
+// byteBudget limits the bytes queued toward one downstream instance.
+type byteBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes fit in the budget and reports whether it had to wait.
+func (b *byteBudget) acquire(n int64) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waited := false
+	for b.used > 0 && b.used+n > b.limit {
+		waited = true
+		b.cond.Wait()
+	}
+	b.used += n
+	return waited
+}
+
+func (b *byteBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// deliver queues a batch element for downstream instance i, blocking while
+// the channel is full or the byte budget is spent, and records how long that took.
+func (ec *edgeChannels) deliver(i int, el element) {
+	el.edge, el.receiver = ec, i
+	el.size = recordSize(el.batch)
+	ec.metrics.depth.Inc()
+	ec.metrics.rows.Add(float64(el.batch.NumRows()))
+	ec.metrics.bytes.Add(float64(el.size))
+
+	start := time.Now()
+	blocked := ec.budgets != nil && ec.budgets[i].acquire(el.size)
+	select {
+	case ec.chs[i] <- el:
+	default:
+		blocked = true
+		ec.chs[i] <- el
+	}
+	// Only sends that waited are observed, so the histogram describes
+	// backpressure rather than being swamped by sends that went straight in.
+	if blocked {
+		ec.metrics.blocked.Observe(time.Since(start).Seconds())
+	}
+}
+
+// received accounts for a batch element taken off its channel. Elements not
+// sent through deliver, e.g. in tests, carry no edge.
+func (el element) received() {
+	ec := el.edge
+	if ec == nil {
+		return
+	}
+	ec.metrics.depth.Dec()
+	ec.metrics.rows.Sub(float64(el.batch.NumRows()))
+	ec.metrics.bytes.Sub(float64(el.size))
+	if ec.budgets != nil {
+		ec.budgets[el.receiver].release(el.size)
+	}
+}
+
+// recordSize returns the bytes held by a batch's buffers. Slices of a shared
+// buffer count the whole buffer.
+func recordSize(rec arrow.Record) int64 {
+	var n int64
+	for _, col := range rec.Columns() {
+		n += dataSize(col.Data())
+	}
+	return n
+}
+
+func dataSize(data arrow.ArrayData) int64 {
+	var n int64
+	for _, buf := range data.Buffers() {
+		if buf != nil {
+			n += int64(buf.Len())
+		}
+	}
+	for _, child := range data.Children() {
+		n += dataSize(child)
+	}
+	if dict, ok := data.Dictionary().(*array.Data); ok && dict != nil {
+		n += dataSize(dict)
+	}
+	return n
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/connectors"
+	"github.com/sandboxws/isotope/runtime/pkg/duckdb"
+	"github.com/sandboxws/isotope/runtime/pkg/operators"
+)
+
+// Built-in factories for the operators and connectors shipped with the runtime.
+func init() {
+	// Sources
+	Register(pb.OperatorType_OPERATOR_TYPE_KAFKA_SOURCE, newKafkaSource)
+	Register(pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, newGeneratorSource)
+	// Sinks
+	Register(pb.OperatorType_OPERATOR_TYPE_KAFKA_SINK, newKafkaSink)
+	Register(pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, newConsoleSink)
+	// Stateless transforms
+	Register(pb.OperatorType_OPERATOR_TYPE_FILTER, newFilter)
+	Register(pb.OperatorType_OPERATOR_TYPE_MAP, newMap)
+	Register(pb.OperatorType_OPERATOR_TYPE_FLAT_MAP, newFlatMap)
+	Register(pb.OperatorType_OPERATOR_TYPE_RENAME, newRename)
+	Register(pb.OperatorType_OPERATOR_TYPE_DROP, newDrop)
+	Register(pb.OperatorType_OPERATOR_TYPE_CAST, newCast)
+	Register(pb.OperatorType_OPERATOR_TYPE_UNION, newUnion)
+	Register(pb.OperatorType_OPERATOR_TYPE_ROUTE, newRoute)
+	// Stateful transforms
+	Register(pb.OperatorType_OPERATOR_TYPE_AGGREGATE, newAggregate)
+	// Escape hatches
+	Register(pb.OperatorType_OPERATOR_TYPE_RAW_SQL, newRawSQL)
+}
+
+// missingConfig reports a node whose oneof config does not match its operator type.
+func missingConfig(node *pb.OperatorNode, want string) error {
+	return fmt.Errorf("operator %s (%s): missing %s config", node.Id, node.OperatorType, want)
+}
+
+// ── Sources ─────────────────────────────────────────────────────────
+
+func newKafkaSource(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetKafkaSource()
+	if cfg == nil {
+		return nil, missingConfig(node, "kafka_source")
+	}
+	schema := cfg.Schema
+	if schema == nil {
+		schema = node.OutputSchema
+	}
+	return connectors.NewKafkaSource(cfg.Topic, cfg.BootstrapServers, cfg.Format, schema,
+		cfg.StartupMode, cfg.ConsumerGroup), nil
+}
+
+func newGeneratorSource(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetGeneratorSource()
+	if cfg == nil {
+		return nil, missingConfig(node, "generator_source")
+	}
+	schema := cfg.Schema
+	if schema == nil {
+		schema = node.OutputSchema
+	}
+	return connectors.NewGenerator(schema, cfg.RowsPerSecond, cfg.MaxRows), nil
+}
+
+// ── Sinks ───────────────────────────────────────────────────────────
+
+func newKafkaSink(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetKafkaSink()
+	if cfg == nil {
+		return nil, missingConfig(node, "kafka_sink")
+	}
+	sink := connectors.NewKafkaSink(cfg.Topic, cfg.BootstrapServers, cfg.Format, cfg.KeyBy)
+	// An upsert changelog goes to a compacted topic as values and tombstones.
+	sink.SetUpsert(node.ChangelogMode == pb.ChangelogMode_CHANGELOG_MODE_UPSERT)
+	return sink, nil
+}
+
+func newConsoleSink(node *pb.OperatorNode) (interface{}, error) {
+	// ConsoleSinkConfig only carries optional settings, so an absent config means defaults.
+	return connectors.NewConsole(node.GetConsoleSink().GetMaxRows()), nil
+}
+
+// ── Stateless transforms ────────────────────────────────────────────
+
+func newFilter(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetFilter()
+	if cfg == nil {
+		return nil, missingConfig(node, "filter")
+	}
+	return operators.NewFilter(cfg.ConditionSql), nil
+}
+
+func newMap(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetMap()
+	if cfg == nil {
+		return nil, missingConfig(node, "map")
+	}
+	return operators.NewMap(cfg.Columns), nil
+}
+
+func newFlatMap(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetFlatMap()
+	if cfg == nil {
+		return nil, missingConfig(node, "flat_map")
+	}
+	return operators.NewFlatMap(cfg.UnnestColumn), nil
+}
+
+func newRename(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetRename()
+	if cfg == nil {
+		return nil, missingConfig(node, "rename")
+	}
+	return operators.NewRename(cfg.Columns), nil
+}
+
+func newDrop(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetDrop()
+	if cfg == nil {
+		return nil, missingConfig(node, "drop")
+	}
+	return operators.NewDrop(cfg.Columns), nil
+}
+
+func newCast(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetCast()
+	if cfg == nil {
+		return nil, missingConfig(node, "cast")
+	}
+
+	// Sort column names so the cast order is deterministic.
+	names := make([]string, 0, len(cfg.Columns))
+	for name := range cfg.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]operators.CastColumn, 0, len(names))
+	for _, name := range names {
+		dt, err := connectors.ProtoTypeToArrow(cfg.Columns[name].GetArrowType())
+		if err != nil {
+			return nil, fmt.Errorf("operator %s: cast column %q: %w", node.Id, name, err)
+		}
+		columns = append(columns, operators.CastColumn{Name: name, TargetType: dt})
+	}
+	return operators.NewCast(columns), nil
+}
+
+func newUnion(_ *pb.OperatorNode) (interface{}, error) {
+	return operators.NewUnion(), nil
+}
+
+// newRoute builds a Route whose branches name their target operators. The
+// engine supplies the branch channels; unmatched rows go to default_operator.
+func newRoute(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetRoute()
+	if cfg == nil {
+		return nil, missingConfig(node, "route")
+	}
+	branches := make([]operators.RouteBranch, len(cfg.Branches))
+	for i, b := range cfg.Branches {
+		branches[i] = operators.RouteBranch{ConditionSQL: b.ConditionSql, Target: b.TargetOperator}
+	}
+	return operators.NewRoute(branches), nil
+}
+
+// ── Stateful transforms ─────────────────────────────────────────────
+
+// newAggregate builds an Aggregate emitting changes per the node's changelog
+// mode. An unspecified mode retracts updated results, which every consumer
+// can apply.
+func newAggregate(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetAggregate()
+	if cfg == nil {
+		return nil, missingConfig(node, "aggregate")
+	}
+	// The validator refuses an append-only changelog.
+	mode := operators.EmitRetract
+	if node.ChangelogMode == pb.ChangelogMode_CHANGELOG_MODE_UPSERT {
+		mode = operators.EmitUpsert
+	}
+	agg, err := operators.NewAggregate(cfg.GroupBy, cfg.Select, mode)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %w", node.Id, err)
+	}
+	return agg, nil
+}
+
+// ── Escape hatches ──────────────────────────────────────────────────
+
+func newRawSQL(node *pb.OperatorNode) (interface{}, error) {
+	cfg := node.GetRawSql()
+	if cfg == nil {
+		return nil, missingConfig(node, "raw_sql")
+	}
+	return duckdb.NewMicroBatchOperator(cfg.Sql, 0), nil
+}
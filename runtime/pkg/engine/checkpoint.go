@@ -0,0 +1,674 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
+)
+
+const (
+	checkpointModeExactlyOnce = "exactly-once"
+	checkpointModeAtLeastOnce = "at-least-once"
+
+	// checkpointTimeout aborts a checkpoint that has not completed in time,
+	// e.g. because a source never acknowledged its trigger.
+	checkpointTimeout = 10 * time.Minute
+
+	// defaultRetainedCheckpoints is the number of completed checkpoints kept
+	// on disk unless the engine is told otherwise.
+	defaultRetainedCheckpoints = 3
+
+	manifestFile = "manifest.json"
+	positionFile = "position"
+
+	// sharedStateDir holds the state files incremental snapshots share across
+	// the checkpoints of a checkpoint directory.
+	sharedStateDir = "shared"
+)
+
+// checkpointCoordinator drives Chandy-Lamport checkpoints: it periodically
+// injects barriers at every running source, collects an acknowledgement from
+// every task once the barrier has passed through it, and records completed
+// checkpoints in a manifest. At most one checkpoint is in flight at a time.
+//
+// Keyed state is snapshotted incrementally: files that do not change once
+// written are kept once in a shared directory and referenced by every
+// checkpoint that includes them. The manifest lists each checkpoint's
+// references, and a shared file is deleted once no retained checkpoint
+// references it.
+//
+// A nil coordinator means checkpointing is disabled; its methods are no-ops.
+type checkpointCoordinator struct {
+	pipeline    string
+	dir         string
+	interval    time.Duration
+	exactlyOnce bool
+	retained    int
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	tasks   []*checkpointTask
+	lastID  int64
+	pending *pendingCheckpoint
+	ranges  map[string]*rangeBoundaries // of the RANGE edges, by edge
+}
+
+// checkpointTask is one goroutine of the running DAG: a source, a sink, a
+// standalone operator instance, or one instance of a fused chain.
+type checkpointTask struct {
+	id      int
+	running bool
+
+	// inject receives the IDs of checkpoints a source task must start.
+	inject chan int64
+
+	// final is the position of a source that has finished, written into every
+	// later checkpoint.
+	final    []byte
+	finalDir string
+}
+
+type pendingCheckpoint struct {
+	id        int64
+	dir       string // where instances snapshot into
+	started   time.Time
+	remaining map[int]bool // tasks that have yet to acknowledge
+
+	request *checkpointRequest // nil for a periodic checkpoint
+	resume  chan struct{}      // closed to resume sources drained for it
+}
+
+// checkpointRequest asks for a checkpoint outside the interval and to be told
+// its outcome on done, which is buffered.
+type checkpointRequest struct {
+	// savepoint, if set, names a savepoint snapshotted into dir instead of a
+	// checkpoint directory.
+	savepoint string
+	dir       string
+
+	// drain stops sources from emitting past the barrier, so that once the
+	// checkpoint completes nothing after it is in flight.
+	drain bool
+
+	done chan error
+}
+
+// checkpointManifest lists the completed checkpoints in a checkpoint directory,
+// oldest first.
+type checkpointManifest struct {
+	Pipeline    string             `json:"pipeline"`
+	Checkpoints []checkpointRecord `json:"checkpoints"`
+}
+
+type checkpointRecord struct {
+	ID          int64     `json:"id"`
+	Path        string    `json:"path"` // relative to the checkpoint directory
+	Mode        string    `json:"mode"`
+	CompletedAt time.Time `json:"completed_at"`
+	// Shared lists the shared state files the checkpoint references, relative
+	// to the checkpoint directory.
+	Shared []string `json:"shared,omitempty"`
+}
+
+// newCheckpointCoordinator returns a coordinator that keeps the last retained
+// checkpoints of the plan in dir, or nil if the plan does not enable
+// checkpointing.
+func newCheckpointCoordinator(plan *pb.ExecutionPlan, dir string, retained int, logger *slog.Logger) (*checkpointCoordinator, error) {
+	cfg := plan.Checkpoint
+	if cfg == nil || cfg.Interval == "" {
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint interval: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create checkpoint directory: %w", err)
+	}
+
+	// Continue numbering after any checkpoints from earlier runs, including
+	// incomplete ones, so their leftover files are never reused.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint directory: %w", err)
+	}
+	var lastID int64
+	for _, entry := range entries {
+		if id, ok := parseCheckpointDirName(entry.Name()); ok {
+			lastID = max(lastID, id)
+		}
+	}
+
+	return &checkpointCoordinator{
+		pipeline:    plan.PipelineName,
+		dir:         dir,
+		interval:    interval,
+		exactlyOnce: cfg.Mode != checkpointModeAtLeastOnce,
+		retained:    retained,
+		logger:      logger.With("component", "checkpoint"),
+		lastID:      lastID,
+	}, nil
+}
+
+// aligned reports whether multi-input operators must align barriers.
+func (c *checkpointCoordinator) aligned() bool {
+	return c != nil && c.exactlyOnce
+}
+
+// addTask registers a task that must acknowledge every checkpoint while it runs.
+// Source tasks get a channel on which checkpoints to start are delivered.
+func (c *checkpointCoordinator) addTask(source bool) *checkpointTask {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	task := &checkpointTask{id: len(c.tasks), running: true}
+	if source {
+		task.inject = make(chan int64, 1)
+	}
+	c.tasks = append(c.tasks, task)
+	return task
+}
+
+// trackRanges has every checkpoint store the boundaries of the RANGE edges.
+func (c *checkpointCoordinator) trackRanges(ranges map[string]*rangeBoundaries) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ranges = ranges
+}
+
+// injections returns the channel on which a source task receives checkpoint
+// IDs. It is nil, and so never ready, when checkpointing is disabled.
+func (t *checkpointTask) injections() <-chan int64 {
+	if t == nil {
+		return nil
+	}
+	return t.inject
+}
+
+// run triggers a checkpoint every interval until ctx is done.
+func (c *checkpointCoordinator) run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.trigger(); err != nil {
+				c.logger.Debug("checkpoint skipped", "reason", err)
+			}
+		}
+	}
+}
+
+// trigger starts a new checkpoint, unless one is still in flight, and
+// returns its ID.
+func (c *checkpointCoordinator) trigger() (int64, error) {
+	return c.start(nil)
+}
+
+// start starts a checkpoint unless one is still in flight, and returns its ID.
+func (c *checkpointCoordinator) start(req *checkpointRequest) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending != nil {
+		if time.Since(c.pending.started) < checkpointTimeout {
+			return 0, fmt.Errorf("checkpoint %d is still in progress", c.pending.id)
+		}
+		c.abort(fmt.Errorf("timed out after %s", checkpointTimeout))
+	}
+
+	remaining := make(map[int]bool)
+	var sources []*checkpointTask
+	for _, task := range c.tasks {
+		if !task.running {
+			continue
+		}
+		remaining[task.id] = true
+		if task.inject != nil {
+			sources = append(sources, task)
+		}
+	}
+	// Barriers only enter the DAG at sources; once they have all finished
+	// there is nothing left to checkpoint.
+	if len(sources) == 0 {
+		return 0, errors.New("no running sources")
+	}
+
+	c.lastID++
+	c.pending = &pendingCheckpoint{
+		id:        c.lastID,
+		dir:       filepath.Join(c.dir, checkpointDirName(c.lastID)),
+		started:   time.Now(),
+		remaining: remaining,
+		request:   req,
+	}
+	if req != nil && req.savepoint != "" {
+		c.pending.dir = req.dir
+	}
+	if req != nil && req.drain {
+		c.pending.resume = make(chan struct{})
+	}
+	c.logger.Debug("checkpoint triggered", "checkpoint", c.lastID, "dir", c.pending.dir)
+	for _, task := range sources {
+		// A source still acknowledging an aborted checkpoint has yet to pick
+		// up the next; it gets this one in its place. Only the coordinator
+		// sends, under c.mu, so the send never blocks.
+		select {
+		case <-task.inject:
+		default:
+		}
+		task.inject <- c.lastID
+	}
+	return c.lastID, nil
+}
+
+// instanceDir returns the directory an operator instance snapshots into for a
+// checkpoint, creating it if needed.
+func (c *checkpointCoordinator) instanceDir(checkpointID int64, inst *operatorInstance) (string, error) {
+	dir := filepath.Join(c.snapshotDir(checkpointID), instanceDirName(inst))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create snapshot directory: %w", err)
+	}
+	return dir, nil
+}
+
+// snapshotDir returns the directory of a checkpoint or savepoint. A checkpoint
+// no longer pending has been aborted; what is still written for it goes to
+// its checkpoint directory, which the retention sweep removes.
+func (c *checkpointCoordinator) snapshotDir(checkpointID int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil && c.pending.id == checkpointID {
+		return c.pending.dir
+	}
+	return filepath.Join(c.dir, checkpointDirName(checkpointID))
+}
+
+// sharedDir returns the directory the keyed state of a checkpoint shares
+// files through, or "" for a savepoint, which must stand on its own.
+func (c *checkpointCoordinator) sharedDir(checkpointID int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil && c.pending.id == checkpointID && c.pending.request != nil && c.pending.request.savepoint != "" {
+		return ""
+	}
+	return filepath.Join(c.dir, sharedStateDir)
+}
+
+// drained returns, if checkpointID drains sources, a channel closed once they
+// may resume because the checkpoint was abandoned. It returns nil otherwise.
+func (c *checkpointCoordinator) drained(checkpointID int64) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil || c.pending.id != checkpointID || c.pending.resume == nil {
+		return nil
+	}
+	return c.pending.resume
+}
+
+// writePosition stores a source instance's read position in a checkpoint.
+func (c *checkpointCoordinator) writePosition(checkpointID int64, inst *operatorInstance, position []byte) error {
+	dir, err := c.instanceDir(checkpointID, inst)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, positionFile), position, 0o644); err != nil {
+		return fmt.Errorf("write source position: %w", err)
+	}
+	return nil
+}
+
+// ack records that task has completed its part of a checkpoint. A non-nil
+// err declines the checkpoint, which aborts it.
+func (c *checkpointCoordinator) ack(task *checkpointTask, checkpointID int64, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil || c.pending.id != checkpointID {
+		// Late acknowledgement of an aborted checkpoint.
+		return
+	}
+	if err != nil {
+		c.abort(fmt.Errorf("task %d declined: %w", task.id, err))
+		return
+	}
+	delete(c.pending.remaining, task.id)
+	if len(c.pending.remaining) == 0 {
+		c.complete()
+	}
+}
+
+// finish records that task has stopped. A checkpoint still waiting for it can
+// no longer complete. A finished source passes its final position so later
+// checkpoints still record it.
+func (c *checkpointCoordinator) finish(task *checkpointTask, inst *operatorInstance, position []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	task.running = false
+	if position != nil {
+		task.final = position
+		task.finalDir = instanceDirName(inst)
+	}
+	if c.pending != nil && c.pending.remaining[task.id] {
+		c.abort(fmt.Errorf("task %d finished before acknowledging", task.id))
+	}
+}
+
+// abort gives up on the pending checkpoint. Its directory is removed by the
+// next retention sweep, or here for a savepoint: snapshots still arriving
+// for it go to the checkpoint directory instead. Callers hold c.mu.
+func (c *checkpointCoordinator) abort(reason error) {
+	c.logger.Warn("checkpoint aborted", "checkpoint", c.pending.id, "reason", reason)
+	if c.pending.resume != nil {
+		close(c.pending.resume)
+	}
+	if req := c.pending.request; req != nil {
+		if req.savepoint != "" {
+			os.RemoveAll(req.dir)
+		}
+		req.done <- fmt.Errorf("checkpoint %d aborted: %w", c.pending.id, reason)
+	}
+	c.pending = nil
+}
+
+// complete records the pending checkpoint in the manifest, or completes the
+// pending savepoint, and tells its requester. Callers hold c.mu.
+func (c *checkpointCoordinator) complete() {
+	id, dir, req := c.pending.id, c.pending.dir, c.pending.request
+	c.pending = nil
+
+	err := c.writeFinalPositions(dir)
+	if err == nil {
+		err = writeRanges(dir, c.ranges)
+	}
+	switch {
+	case err != nil:
+		c.logger.Error("checkpoint failed", "checkpoint", id, "error", err)
+	case req != nil && req.savepoint != "":
+		// Savepoints are owned by the user: they are not listed in the
+		// manifest, restored from automatically or swept.
+		err = c.writeSavepoint(id, req)
+	default:
+		err = c.record(id)
+	}
+	if req != nil {
+		req.done <- err
+	}
+}
+
+// record lists a completed checkpoint in the manifest and removes those it
+// no longer retains. Callers hold c.mu.
+func (c *checkpointCoordinator) record(id int64) error {
+	name := checkpointDirName(id)
+	var shared []string
+
+	manifest, err := readManifest(c.dir)
+	if err == nil {
+		shared, err = c.sharedFiles(name)
+	}
+	if err != nil {
+		c.logger.Error("checkpoint failed", "checkpoint", id, "error", err)
+		return err
+	}
+	manifest.Pipeline = c.pipeline
+	mode := checkpointModeAtLeastOnce
+	if c.exactlyOnce {
+		mode = checkpointModeExactlyOnce
+	}
+	manifest.Checkpoints = append(manifest.Checkpoints, checkpointRecord{
+		ID:          id,
+		Path:        name,
+		Mode:        mode,
+		CompletedAt: time.Now().UTC(),
+		Shared:      shared,
+	})
+	if n := len(manifest.Checkpoints); n > c.retained {
+		manifest.Checkpoints = manifest.Checkpoints[n-c.retained:]
+	}
+	if err := writeManifest(c.dir, manifest); err != nil {
+		c.logger.Error("checkpoint failed", "checkpoint", id, "error", err)
+		return err
+	}
+	c.logger.Info("checkpoint completed", "checkpoint", id)
+	c.sweep(manifest)
+	return nil
+}
+
+// writeFinalPositions copies the positions of finished sources into the
+// checkpoint in snapshotDir. A source that finished after acknowledging the
+// checkpoint keeps the position it wrote then, which matches downstream
+// state.
+func (c *checkpointCoordinator) writeFinalPositions(snapshotDir string) error {
+	for _, task := range c.tasks {
+		if task.final == nil {
+			continue
+		}
+		dir := filepath.Join(snapshotDir, task.finalDir)
+		if _, err := os.Stat(filepath.Join(dir, positionFile)); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, positionFile), task.final, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedFiles returns the shared state files the keyed state snapshots in a
+// checkpoint directory reference, relative to c.dir.
+func (c *checkpointCoordinator) sharedFiles(name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	for _, entry := range entries {
+		dir := filepath.Join(c.dir, name, entry.Name(), keyedStateDir)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		paths, err := state.SharedFiles(dir)
+		if err != nil {
+			return nil, fmt.Errorf("list shared state files of %s: %w", entry.Name(), err)
+		}
+		for _, path := range paths {
+			rel, err := filepath.Rel(c.dir, path)
+			if err != nil {
+				return nil, err
+			}
+			shared = append(shared, filepath.ToSlash(rel))
+		}
+	}
+	return shared, nil
+}
+
+// sweep removes checkpoint directories that the manifest no longer lists,
+// i.e. expired and aborted checkpoints older than the latest completed one,
+// and the shared state files none of the listed checkpoints reference.
+// Callers hold c.mu, so no snapshot is adding shared files meanwhile.
+func (c *checkpointCoordinator) sweep(manifest *checkpointManifest) {
+	keep := make(map[string]bool, len(manifest.Checkpoints))
+	for _, cp := range manifest.Checkpoints {
+		keep[cp.Path] = true
+	}
+	latest := manifest.Checkpoints[len(manifest.Checkpoints)-1].ID
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		c.logger.Warn("checkpoint cleanup failed", "error", err)
+		return
+	}
+	for _, entry := range entries {
+		id, ok := parseCheckpointDirName(entry.Name())
+		if !ok || !entry.IsDir() || keep[entry.Name()] || id > latest {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, entry.Name())); err != nil {
+			c.logger.Warn("checkpoint cleanup failed", "path", entry.Name(), "error", err)
+		}
+	}
+	c.sweepShared(manifest)
+}
+
+// sweepShared removes shared state files with no references left: those of
+// expired checkpoints and orphans written by aborted ones.
+func (c *checkpointCoordinator) sweepShared(manifest *checkpointManifest) {
+	refs := make(map[string]int)
+	for _, cp := range manifest.Checkpoints {
+		for _, path := range cp.Shared {
+			refs[path]++
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(c.dir, sharedStateDir))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Warn("checkpoint cleanup failed", "error", err)
+		}
+		return
+	}
+	removed := 0
+	for _, entry := range entries {
+		path := sharedStateDir + "/" + entry.Name()
+		if refs[path] > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, sharedStateDir, entry.Name())); err != nil {
+			c.logger.Warn("checkpoint cleanup failed", "path", path, "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		c.logger.Debug("removed unreferenced shared state files", "files", removed, "referenced", len(refs))
+	}
+}
+
+func checkpointDirName(id int64) string {
+	return fmt.Sprintf("chk-%d", id)
+}
+
+func parseCheckpointDirName(name string) (int64, bool) {
+	rest, ok := strings.CutPrefix(name, "chk-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(rest, 10, 64)
+	return id, err == nil
+}
+
+func instanceDirName(inst *operatorInstance) string {
+	return fmt.Sprintf("%s-%d", inst.node.Id, inst.index)
+}
+
+// instanceDirOperator returns the operator ID of an instance directory name.
+func instanceDirOperator(name string) (string, bool) {
+	i := strings.LastIndexByte(name, '-')
+	if i <= 0 {
+		return "", false
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// latestCheckpoint returns the path of the latest completed checkpoint listed
+// in dir's manifest, or "" if there is none.
+func latestCheckpoint(dir string) (string, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(manifest.Checkpoints) == 0 {
+		return "", nil
+	}
+	return filepath.Join(dir, manifest.Checkpoints[len(manifest.Checkpoints)-1].Path), nil
+}
+
+// resolveCheckpoint returns the checkpoint to restore from path: the latest
+// completed checkpoint if path holds a manifest, else path itself.
+func resolveCheckpoint(path string) (string, error) {
+	if _, err := os.Stat(filepath.Join(path, manifestFile)); err == nil {
+		latest, err := latestCheckpoint(path)
+		if err != nil {
+			return "", err
+		}
+		if latest == "" {
+			return "", fmt.Errorf("no completed checkpoints in %s", path)
+		}
+		return latest, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a checkpoint directory", path)
+	}
+	return path, nil
+}
+
+// readManifest loads the manifest in dir. A missing manifest is empty.
+func readManifest(dir string) (*checkpointManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return &checkpointManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint manifest: %w", err)
+	}
+	manifest := &checkpointManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("parse checkpoint manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeManifest replaces the manifest in dir atomically, so a crash never
+// leaves a partially written manifest behind.
+func writeManifest(dir string, manifest *checkpointManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode checkpoint manifest: %w", err)
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write checkpoint manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("write checkpoint manifest: %w", err)
+	}
+	return nil
+}
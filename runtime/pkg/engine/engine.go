@@ -6,17 +6,42 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 
 	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/metrics"
 	"github.com/sandboxws/isotope/runtime/pkg/operator"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
 )
 
 const defaultChannelBuffer = 16
 
+// gcSampleInterval is how often GC pauses are sampled into metrics.GCPauseSummary.
+const gcSampleInterval = 10 * time.Second
+
+// defaultCheckpointRoot holds one checkpoint directory per pipeline unless
+// SetCheckpointDir is called.
+const defaultCheckpointRoot = "checkpoints"
+
+// defaultStateRoot holds the working directories of on-disk state backends,
+// one per pipeline, unless SetStateDir is called.
+const defaultStateRoot = "state"
+
+// keyedStateDir holds an instance's keyed state within its snapshot directory.
+const keyedStateDir = "state"
+
 // OperatorFactory creates an Operator (or Source/Sink) from an OperatorNode descriptor.
 type OperatorFactory func(node *pb.OperatorNode) (interface{}, error)
 
@@ -27,38 +52,199 @@ type Engine struct {
 	factory OperatorFactory
 	logger  *slog.Logger
 
-	// Runtime state.
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	checkpointDir string
+	retained      int
+	savepointDir  string
+	stateDir      string
+	stateTTLTime  state.TimeDomain
+	restoreFrom   string
+	stateMapping  StateMapping
+	deadLetters   operator.DeadLetterQueue
+	edgeBuffer    EdgeBuffer
+	edgeBuffers   map[[2]string]EdgeBuffer
+	tracer        trace.Tracer
+
+	// Runtime state. stateMu guards what is read or written from outside Run:
+	// plan, cancel, checkpoints, instances and swap.
+	stateMu     sync.Mutex
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	checkpoints *checkpointCoordinator
+	instances   map[string][]*operatorInstance // by operator ID, for Status
+	swap        *planSwap                      // requested by Swap, applied by Run
+	restoreDir  string                         // checkpoint being restored, if any
+	restored    map[string]bool                // operators with state in restoreDir
+
+	// Error policies for processing errors, by operator ID.
+	defaultPolicy ErrorPolicy
+	policies      map[string]ErrorPolicy
+
+	// openSinks holds the sinks of a batch-mode run, which are closed in
+	// topological order once the DAG has drained.
+	sinkMu    sync.Mutex
+	openSinks []*operatorInstance
+
+	// failure is the first fatal error of the current run, which cancels it
+	// through cancelRun.
+	failMu    sync.Mutex
+	failure   *OperatorError
+	cancelRun context.CancelFunc
 }
 
 // NewEngine creates a new execution engine for the given plan.
+// A nil factory builds operators from the registry (see Register).
 func NewEngine(plan *pb.ExecutionPlan, alloc memory.Allocator, factory OperatorFactory) *Engine {
+	if factory == nil {
+		factory = NewOperator
+	}
 	return &Engine{
 		plan:    plan,
 		alloc:   alloc,
 		factory: factory,
 		logger:  slog.Default().With("pipeline", plan.PipelineName),
+		tracer:  otel.Tracer(tracerName),
 	}
 }
 
-// operatorInstance holds an instantiated operator with its metadata.
+// SetCheckpointDir sets the directory checkpoints are written to when the plan
+// enables checkpointing. It defaults to checkpoints/<pipeline name>.
+func (e *Engine) SetCheckpointDir(dir string) {
+	e.checkpointDir = dir
+}
+
+// SetRetainedCheckpoints sets how many completed checkpoints are kept, by
+// default 3. Older ones, and the shared state files only they reference, are
+// removed as new ones complete.
+func (e *Engine) SetRetainedCheckpoints(n int) {
+	e.retained = n
+}
+
+// SetStateDir sets the working directory of on-disk state backends. It
+// defaults to state/<pipeline name>. Its contents are discarded on every run:
+// state survives restarts through checkpoints.
+func (e *Engine) SetStateDir(dir string) {
+	e.stateDir = dir
+}
+
+// SetStateTTLTime sets the clock state TTLs are measured against: wall-clock
+// time by default, or event time, in which case entries expire as each
+// instance's watermark advances.
+func (e *Engine) SetStateTTLTime(domain state.TimeDomain) {
+	e.stateTTLTime = domain
+}
+
+// SetRestoreFrom makes Run resume from a checkpoint: dir is either a single
+// checkpoint or a checkpoint directory, in which case its latest completed
+// checkpoint is used. Without it, Run resumes from the latest completed
+// checkpoint in the checkpoint directory, if the plan enables checkpointing.
+func (e *Engine) SetRestoreFrom(dir string) {
+	e.restoreFrom = dir
+}
+
+// SetDeadLetterQueue sets where operators send the records they cannot
+// process, including the rows of batches failed under ErrorPolicyDeadLetter.
+// The engine does not close it.
+func (e *Engine) SetDeadLetterQueue(q operator.DeadLetterQueue) {
+	e.deadLetters = q
+}
+
+// operatorInstance holds one parallel instance of an operator with its metadata.
 type operatorInstance struct {
 	node     *pb.OperatorNode
+	index    int         // parallel instance index (0-based)
 	impl     interface{} // operator.Operator, operator.Source, or operator.Sink
-	inputChs []chan arrow.Record
-	outputCh chan arrow.Record
+	inputChs []chan element
+	outputs  []*output // one per downstream edge
+
+	// inputSenders holds the number of upstream instances writing to each input channel.
+	inputSenders []int
+
+	// routes holds the side outputs of a MultiOutputOperator, keyed by target operator ID.
+	routes map[string]*routedOutput
+
+	// opCtx is the context the instance was opened with.
+	opCtx *operator.Context
+
+	// watermark is the last watermark the instance processed, in milliseconds
+	// since epoch, or noWatermark.
+	watermark atomic.Int64
+
+	// trace is the span of the last element the instance processed, carried
+	// by the batches it emits; see endTrace.
+	trace trace.SpanContext
+
+	state instanceState
+}
+
+// routedOutput collects the batches a MultiOutputOperator addresses to one
+// downstream operator and forwards them along the edges to that operator.
+type routedOutput struct {
+	ch      chan arrow.Record
+	outputs []*output
 }
 
 // Run builds the DAG, wires channels, and starts all operators.
 // Blocks until ctx is cancelled or all operators complete.
+//
+// When an operator fails, the whole DAG is torn down and, as the plan's
+// restart strategy allows, built again from the latest checkpoint. Run
+// returns the failure, an *OperatorError, once no further restart is allowed.
+// The DAG is likewise rebuilt, with the new plan, after a Swap.
 func (e *Engine) Run(ctx context.Context) error {
-	ctx, e.cancel = context.WithCancel(ctx)
-	defer e.cancel()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.stateMu.Lock()
+	e.cancel = cancel
+	e.stateMu.Unlock()
 
 	if err := ValidatePlan(e.plan); err != nil {
 		return fmt.Errorf("invalid plan: %w", err)
 	}
+	restarts, err := newRestartStrategy(e.plan.Restart)
+	if err != nil {
+		return err
+	}
+	metrics.SampleGCPauses(gcSampleInterval)
+
+	for restart := 0; ; restart++ {
+		err := e.runOnce(ctx, restart > 0)
+		if swap := e.takeSwap(); swap != nil && ctx.Err() == nil {
+			if err := e.applySwap(swap); err != nil {
+				return err
+			}
+			if restarts, err = newRestartStrategy(e.plan.Restart); err != nil {
+				return err
+			}
+			continue
+		}
+		failure, ok := err.(*OperatorError)
+		if !ok {
+			return err
+		}
+		delay, ok := restarts.next(time.Now())
+		if !ok {
+			return err
+		}
+
+		metrics.Restarts.WithLabelValues(e.plan.PipelineName, failure.OperatorID, string(failure.Phase)).Inc()
+		e.logger.Warn("restarting pipeline", "restart", restart+1, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runOnce builds and runs the DAG once. It returns the first fatal operator
+// error, if any, after every instance has stopped.
+func (e *Engine) runOnce(ctx context.Context, restarted bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.failMu.Lock()
+	e.failure, e.cancelRun = nil, cancel
+	e.failMu.Unlock()
+	e.openSinks = nil
 
 	// Build the adjacency lists.
 	adj := buildAdjacency(e.plan)
@@ -66,16 +252,77 @@ func (e *Engine) Run(ctx context.Context) error {
 	// Identify chains of FORWARD-connected operators for fusion.
 	chains := identifyChains(e.plan, adj)
 
-	// Create operator instances.
-	instances := make(map[string]*operatorInstance)
+	checkpointDir := e.checkpointDir
+	if checkpointDir == "" {
+		checkpointDir = filepath.Join(defaultCheckpointRoot, e.plan.PipelineName)
+	}
+	retained := e.retained
+	if retained <= 0 {
+		retained = defaultRetainedCheckpoints
+	}
+	checkpoints, err := newCheckpointCoordinator(e.plan, checkpointDir, retained, e.logger)
+	if err != nil {
+		return err
+	}
+	e.stateMu.Lock()
+	e.checkpoints = checkpoints
+	e.stateMu.Unlock()
+
+	// Find the checkpoint to resume from, if any. After a failure, checkpoints
+	// taken since the pipeline started win over the one it started from.
+	e.restoreDir = ""
+	if restarted && checkpoints != nil {
+		e.restoreDir, err = latestCheckpoint(checkpointDir)
+	}
+	if err == nil && e.restoreDir == "" {
+		switch {
+		case e.restoreFrom != "":
+			e.restoreDir, err = resolveCheckpoint(e.restoreFrom)
+		case checkpoints != nil:
+			e.restoreDir, err = latestCheckpoint(checkpointDir)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	// Create one operator instance per parallel subtask.
+	instances := make(map[string][]*operatorInstance)
 	for _, op := range e.plan.Operators {
-		impl, err := e.factory(op)
-		if err != nil {
-			return fmt.Errorf("create operator %s (%s): %w", op.Id, op.Name, err)
+		parallelism := operatorParallelism(e.plan, op)
+		for i := 0; i < parallelism; i++ {
+			impl, err := e.factory(op)
+			if err != nil {
+				return fmt.Errorf("create operator %s (%s): %w", op.Id, op.Name, err)
+			}
+			inst := &operatorInstance{
+				node:  op,
+				index: i,
+				impl:  impl,
+			}
+			inst.watermark.Store(noWatermark)
+			instances[op.Id] = append(instances[op.Id], inst)
 		}
-		instances[op.Id] = &operatorInstance{
-			node: op,
-			impl: impl,
+	}
+
+	e.restored = nil
+	if e.restoreDir != "" {
+		e.logger.Info("restoring from checkpoint", "path", e.restoreDir)
+		if e.restored, err = e.mapState(instances); err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+	}
+	ranges, err := restoreRanges(e.plan, e.restoreDir)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	checkpoints.trackRanges(ranges)
+
+	// Give operators with named outputs a side channel per target.
+	for _, insts := range instances {
+		for _, inst := range insts {
+			if mo, ok := inst.impl.(operator.MultiOutputOperator); ok {
+				wireRoutes(inst, mo)
+			}
 		}
 	}
 
@@ -86,18 +333,44 @@ func (e *Engine) Run(ctx context.Context) error {
 			continue
 		}
 
-		ch := make(chan arrow.Record, defaultChannelBuffer)
-		instances[edge.FromOperator].outputCh = ch
-		instances[edge.ToOperator].inputChs = append(instances[edge.ToOperator].inputChs, ch)
+		from := instances[edge.FromOperator]
+		to := instances[edge.ToOperator]
+
+		// One channel per downstream instance, shared by every upstream instance.
+		channels := newEdgeChannels(len(to), len(from), e.bufferFor(edge.FromOperator, edge.ToOperator),
+			newEdgeMetrics(edge.FromOperator, edge.ToOperator))
+		for i, inst := range to {
+			inst.inputChs = append(inst.inputChs, channels.chs[i])
+			inst.inputSenders = append(inst.inputSenders, len(from))
+		}
+		partitioners := newPartitioners(edge, len(from), e.alloc, ranges[rangeEdgeName(edge)])
+		for i, inst := range from {
+			out := &output{
+				channels:    channels,
+				partitioner: partitioners[i],
+				sender:      i,
+			}
+			if route, ok := inst.routes[edge.ToOperator]; ok {
+				route.outputs = append(route.outputs, out)
+			} else {
+				inst.outputs = append(inst.outputs, out)
+			}
+		}
 	}
 
 	// Start operators.
 	for _, chain := range chains {
-		if len(chain) > 1 {
-			// Fused chain: run all chained operators in a single goroutine.
-			e.startChain(ctx, chain, instances)
-		} else {
-			e.startSingle(ctx, chain[0], instances)
+		for i := range instances[chain[0]] {
+			chainInsts := make([]*operatorInstance, len(chain))
+			for j, id := range chain {
+				chainInsts[j] = instances[id][i]
+			}
+			if len(chain) > 1 {
+				// Fused chain: run all chained operators in a single goroutine.
+				e.startChain(ctx, chainInsts)
+			} else {
+				e.startSingle(ctx, chainInsts[0])
+			}
 		}
 	}
 
@@ -110,115 +383,615 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 	for _, op := range e.plan.Operators {
 		if !inChain[op.Id] {
-			e.startSingle(ctx, op.Id, instances)
+			for _, inst := range instances[op.Id] {
+				e.startSingle(ctx, inst)
+			}
 		}
 	}
 
+	e.stateMu.Lock()
+	e.instances = instances
+	e.stateMu.Unlock()
+
+	go e.checkpoints.run(ctx)
+	go e.reportWatermarkLag(ctx, instances)
+
 	// Wait for all goroutines to finish.
 	e.wg.Wait()
+	e.updateWatermarkLag(instances, time.Now())
+	e.closeSinks(ctx, topologicalOrder(e.plan, adj))
+
+	e.failMu.Lock()
+	defer e.failMu.Unlock()
+	if e.failure != nil {
+		return e.failure
+	}
 	return nil
 }
 
+// batchMode reports whether the plan runs in batch mode: its sources are
+// bounded and the pipeline finishes once they are exhausted.
+func (e *Engine) batchMode() bool {
+	return e.plan.Mode == pb.PipelineMode_PIPELINE_MODE_BATCH
+}
+
+// closeSinks closes the sinks of a batch-mode run in topological order, after
+// every operator has finished, so that a sink is only closed once everything
+// upstream of it is done.
+func (e *Engine) closeSinks(ctx context.Context, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	sort.SliceStable(e.openSinks, func(i, j int) bool {
+		a, b := e.openSinks[i], e.openSinks[j]
+		if rank[a.node.Id] != rank[b.node.Id] {
+			return rank[a.node.Id] < rank[b.node.Id]
+		}
+		return a.index < b.index
+	})
+	for _, inst := range e.openSinks {
+		e.closeOperator(ctx, inst, inst.impl.(operator.Sink).Close)
+	}
+	e.openSinks = nil
+}
+
 // Stop triggers a graceful shutdown.
 func (e *Engine) Stop() {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
 	if e.cancel != nil {
 		e.cancel()
 	}
 }
 
-// startSingle starts a single operator in its own goroutine.
-func (e *Engine) startSingle(ctx context.Context, opID string, instances map[string]*operatorInstance) {
-	inst := instances[opID]
+// newOperatorContext creates the operator context for one parallel instance.
+func (e *Engine) newOperatorContext(ctx context.Context, inst *operatorInstance) *operator.Context {
 	opCtx := operator.NewContext(ctx, e.alloc, inst.node.Id, inst.node.Name)
+	opCtx.Parallelism = operatorParallelism(e.plan, inst.node)
+	opCtx.InstanceIndex = inst.index
+	opCtx.Logger = opCtx.Logger.With("instance", inst.index)
+	opCtx.DeadLetters = e.deadLetters
+	opCtx.State = e.newStateStore(inst)
+	inst.opCtx = opCtx
+	return opCtx
+}
+
+// newStateStore returns the keyed state of an instance, in the backend the
+// plan's state config names, expiring entries after the operator's state TTL.
+func (e *Engine) newStateStore(inst *operatorInstance) *state.Store {
+	backend := e.plan.State.GetBackend()
+	root := e.stateDir
+	if root == "" {
+		root = filepath.Join(defaultStateRoot, e.plan.PipelineName)
+	}
+	dir := filepath.Join(root, instanceDirName(inst))
+	store := state.NewStore(backend, func() (state.Backend, error) {
+		return state.Open(backend, dir)
+	})
+	// The plan was validated, so the TTL parses.
+	if ttl, _ := stateTTL(e.plan, inst.node); ttl > 0 {
+		expired := metrics.StateExpiredEntries.WithLabelValues(inst.node.Id, inst.node.Name)
+		store.SetTTL(state.TTL{
+			Duration: ttl,
+			Domain:   e.stateTTLTime,
+			Expired:  func(n int) { expired.Add(float64(n)) },
+		})
+	}
+	return store
+}
+
+// stateTTL returns how long an operator keeps state entries: its hash join
+// state_ttl if it has one, else the plan's state ttl. Zero keeps them forever.
+func stateTTL(plan *pb.ExecutionPlan, node *pb.OperatorNode) (time.Duration, error) {
+	ttl := plan.State.GetTtl()
+	if joinTTL := node.GetHashJoin().GetStateTtl(); joinTTL != "" {
+		ttl = joinTTL
+	}
+	if ttl == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("invalid state ttl %q: %w", ttl, err)
+	}
+	if d < time.Millisecond {
+		// Expiry times are kept in milliseconds.
+		return 0, fmt.Errorf("state ttl must be at least 1ms, got %s", ttl)
+	}
+	return d, nil
+}
+
+// restore loads an instance's source position or operator state from the
+// checkpoint being restored. Operators new to the plan start empty unless the
+// state mapping requires all state; mapState has refused a checkpoint whose
+// state was snapshotted at a different parallelism, unless it belongs to a
+// partitioned source.
+func (e *Engine) restore(inst *operatorInstance) error {
+	if e.restoreDir == "" {
+		return nil
+	}
+	dir := filepath.Join(e.restoreDir, instanceDirName(inst))
+
+	if !e.restored[inst.node.Id] {
+		switch inst.impl.(type) {
+		case operator.CheckpointedSource, operator.RestorableOperator:
+			if e.stateMapping.RequireAll {
+				return fmt.Errorf("no state for operator %s in %s", inst.node.Id, e.restoreDir)
+			}
+			if inst.index == 0 {
+				e.logger.Info("operator has no state to restore, starting empty", "operator", inst.node.Id)
+			}
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, keyedStateDir)); err == nil {
+		if err := inst.opCtx.State.Restore(filepath.Join(dir, keyedStateDir)); err != nil {
+			return fmt.Errorf("restore keyed state: %w", err)
+		}
+	}
+
+	switch impl := inst.impl.(type) {
+	case operator.PartitionedSource:
+		positions, err := e.restoredPositions(inst.node.Id)
+		if err != nil {
+			return err
+		}
+		return impl.RestorePositions(positions)
+
+	case operator.CheckpointedSource:
+		position, err := os.ReadFile(filepath.Join(dir, positionFile))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read source position: %w", err)
+		}
+		return impl.RestorePosition(position)
+
+	case operator.RestorableOperator:
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		}
+		return impl.RestoreState(dir)
+	}
+	return nil
+}
+
+// restoredPositions returns the source positions every instance of an
+// operator recorded in the checkpoint being restored, in instance order.
+func (e *Engine) restoredPositions(id string) ([][]byte, error) {
+	entries, err := os.ReadDir(e.restoreDir)
+	if err != nil {
+		return nil, err
+	}
+	type indexed struct {
+		index    int
+		position []byte
+	}
+	var found []indexed
+	for _, entry := range entries {
+		if op, ok := instanceDirOperator(entry.Name()); !ok || op != id {
+			continue
+		}
+		position, err := os.ReadFile(filepath.Join(e.restoreDir, entry.Name(), positionFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read source position: %w", err)
+		}
+		index, _ := strconv.Atoi(entry.Name()[len(id)+1:])
+		found = append(found, indexed{index, position})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+	positions := make([][]byte, len(found))
+	for i, f := range found {
+		positions[i] = f.position
+	}
+	return positions, nil
+}
+
+// emit sends a batch to every downstream edge of the instance. Each output
+// holds its own reference, so the batch is retained once per consumer and
+// the caller's reference is released here.
+func (e *Engine) emit(ctx context.Context, inst *operatorInstance, batch arrow.Record) {
+	e.emitTo(ctx, inst, inst.outputs, batch)
+}
+
+// emitTo is emit to the given outputs. A batch an output fails to partition
+// is handled by the instance's error policy like any processing error.
+func (e *Engine) emitTo(ctx context.Context, inst *operatorInstance, outputs []*output, batch arrow.Record) {
+	for _, out := range outputs {
+		batch.Retain()
+		if err := out.send(batch, inst.trace); err != nil {
+			e.processError(ctx, inst, fmt.Errorf("partition: %w", err), batch, nil)
+		}
+	}
+	batch.Release()
+}
+
+// emitWatermark forwards a watermark along every downstream edge of the
+// instance, including the edges fed by named outputs.
+func (e *Engine) emitWatermark(inst *operatorInstance, wm operator.Watermark) {
+	inst.observeWatermark(wm)
+	forEachOutput(inst, func(out *output) { out.sendWatermark(wm) })
+}
+
+// emitBarrier forwards a checkpoint barrier along every downstream edge of the instance.
+func (e *Engine) emitBarrier(inst *operatorInstance, checkpointID int64) {
+	forEachOutput(inst, func(out *output) { out.sendBarrier(checkpointID) })
+}
+
+// processBarrier handles an aligned checkpoint barrier for a task: each
+// operator in chain snapshots its state in order, the barrier is forwarded
+// downstream of the last one, and the checkpoint is acknowledged.
+func (e *Engine) processBarrier(task *checkpointTask, checkpointID int64, chain []*operatorInstance) {
+	var err error
+	for _, inst := range chain {
+		op, ok := inst.impl.(operator.Operator)
+		if !ok {
+			// Sinks write through and hold no state.
+			continue
+		}
+		var dir string
+		if dir, err = e.checkpoints.instanceDir(checkpointID, inst); err == nil {
+			err = op.ProcessCheckpointBarrier(operator.CheckpointBarrier{CheckpointID: checkpointID, Dir: dir})
+		}
+		if err == nil {
+			err = e.snapshotState(inst, checkpointID, filepath.Join(dir, keyedStateDir))
+		}
+		if err != nil {
+			err = fmt.Errorf("operator %s: %w", inst.node.Id, err)
+			e.logger.Error("checkpoint snapshot failed", "operator", inst.node.Id, "checkpoint", checkpointID, "error", err)
+			break
+		}
+	}
+	e.emitBarrier(chain[len(chain)-1], checkpointID)
+	e.checkpoints.ack(task, checkpointID, err)
+}
+
+// snapshotState snapshots an instance's keyed state into dir: incrementally
+// for a checkpoint, in full for a savepoint.
+func (e *Engine) snapshotState(inst *operatorInstance, checkpointID int64, dir string) error {
+	if shared := e.checkpoints.sharedDir(checkpointID); shared != "" {
+		return inst.opCtx.State.SnapshotIncremental(dir, shared)
+	}
+	return inst.opCtx.State.Snapshot(dir)
+}
+
+// emitRoutes forwards the batches a MultiOutputOperator sent to its side
+// channels during the last call. Draining synchronously keeps routed batches
+// in order with the operator's other output.
+func (e *Engine) emitRoutes(ctx context.Context, inst *operatorInstance) {
+	for _, route := range inst.routes {
+		for drained := false; !drained; {
+			select {
+			case batch := <-route.ch:
+				e.emitTo(ctx, inst, route.outputs, batch)
+			default:
+				drained = true
+			}
+		}
+	}
+}
+
+// closeOutputs signals every downstream edge that the instance will send no more batches.
+func closeOutputs(inst *operatorInstance) {
+	forEachOutput(inst, (*output).close)
+}
+
+// forEachOutput calls fn for every downstream edge of the instance, including
+// the edges fed by named outputs.
+func forEachOutput(inst *operatorInstance, fn func(out *output)) {
+	for _, out := range inst.outputs {
+		fn(out)
+	}
+	for _, route := range inst.routes {
+		for _, out := range route.outputs {
+			fn(out)
+		}
+	}
+}
+
+// wireRoutes creates the side channels of a MultiOutputOperator. Each channel
+// can hold one batch per target entry, which is the most an operator may send
+// on it in a single call.
+func wireRoutes(inst *operatorInstance, mo operator.MultiOutputOperator) {
+	targets := mo.OutputTargets()
+	inst.routes = make(map[string]*routedOutput, len(targets))
+	for _, target := range targets {
+		if _, ok := inst.routes[target]; ok {
+			continue
+		}
+		route := &routedOutput{ch: make(chan arrow.Record, len(targets))}
+		inst.routes[target] = route
+		mo.SetOutput(target, route.ch)
+	}
+}
+
+// startSingle starts a single operator instance in its own goroutine.
+func (e *Engine) startSingle(ctx context.Context, inst *operatorInstance) {
+	opID := inst.node.Id
+	opCtx := e.newOperatorContext(ctx, inst)
 
 	switch impl := inst.impl.(type) {
 	case operator.Source:
-		// Sources need an output channel.
-		if inst.outputCh == nil {
-			inst.outputCh = make(chan arrow.Record, defaultChannelBuffer)
+		// Sources write to a private channel that is drained into the partitioned output.
+		srcCh := make(chan arrow.Record, defaultChannelBuffer)
+		task := e.checkpoints.addTask(true)
+		checkpointed, _ := impl.(operator.CheckpointedSource)
+		var triggers chan *operator.CheckpointTrigger
+		if task != nil && checkpointed != nil {
+			triggers = make(chan *operator.CheckpointTrigger, 1)
+			opCtx.Checkpoints = triggers
 		}
+
 		e.wg.Add(1)
 		go func() {
 			defer e.wg.Done()
+			defer inst.state.finish()
+			defer closeOutputs(inst)
+			var final []byte
+			defer func() { e.checkpoints.finish(task, inst, final) }()
 			if err := impl.Open(opCtx); err != nil {
-				e.logger.Error("source open failed", "operator", opID, "error", err)
+				e.fail(ctx, inst, PhaseOpen, err)
 				return
 			}
-			defer impl.Close()
-			if err := impl.Run(opCtx, inst.outputCh); err != nil {
-				e.logger.Error("source run failed", "operator", opID, "error", err)
+			inst.state.store(StateOpened)
+			defer e.closeOperator(ctx, inst, impl.Close)
+			if err := e.restore(inst); err != nil {
+				e.fail(ctx, inst, PhaseRestore, err)
+				return
+			}
+			inst.state.store(StateRunning)
+
+			watermarks, err := newWatermarkGenerator(inst.node)
+			if err != nil {
+				e.fail(ctx, inst, PhaseOpen, err)
+				return
+			}
+			emit := func(batch arrow.Record) {
+				var wm operator.Watermark
+				advanced := false
+				if watermarks != nil {
+					wm, advanced, err = watermarks.observe(batch)
+					if err != nil {
+						e.processError(ctx, inst, fmt.Errorf("watermark: %w", err), nil, nil)
+					}
+				}
+				rows := batch.NumRows()
+				span := e.traceSource(inst, batch)
+				e.emit(ctx, inst, batch)
+				inst.endTrace(span, rows, nil)
+				if advanced {
+					e.emitWatermark(inst, wm)
+				}
+			}
+
+			go func() {
+				if err := impl.Run(opCtx, srcCh); err != nil {
+					e.fail(ctx, inst, PhaseProcess, err)
+				}
+			}()
+
+			// pending is the trigger a checkpointed source has yet to acknowledge.
+			var pending *operator.CheckpointTrigger
+			// paused is set after the barrier of a checkpoint draining the
+			// pipeline, and closed if that checkpoint is abandoned.
+			var paused <-chan struct{}
+			for {
+				batches, injections, done := srcCh, task.injections(), (<-chan struct{})(nil)
+				var acked <-chan struct{}
+				if pending != nil {
+					// A checkpoint started after the pending one was aborted
+					// waits in its channel until the source acknowledges it.
+					acked, injections = pending.Acked(), nil
+				}
+				if paused != nil {
+					// Nothing past the barrier may enter the DAG; the source
+					// resumes from its position when the pipeline restarts.
+					batches, injections, done = nil, nil, ctx.Done()
+				}
+
+				select {
+				case <-paused:
+					paused = nil
+
+				case <-done:
+					for batch := range srcCh {
+						batch.Release()
+					}
+					return
+
+				case batch, ok := <-batches:
+					if !ok {
+						if triggers != nil {
+							if final, err = checkpointed.SnapshotPosition(); err != nil {
+								e.logger.Error("source position failed", "operator", opID, "error", err)
+							}
+						}
+						// A bounded source that ran to completion ends event time,
+						// flushing windows and buffers downstream.
+						if e.batchMode() && ctx.Err() == nil {
+							e.emitWatermark(inst, operator.Watermark{Timestamp: math.MaxInt64})
+						}
+						return
+					}
+					emit(batch)
+
+				case id := <-injections:
+					if triggers == nil {
+						// Without a position to record, the barrier can go anywhere between batches.
+						e.emitBarrier(inst, id)
+						paused = e.checkpoints.drained(id)
+						e.checkpoints.ack(task, id, nil)
+					} else {
+						pending = operator.NewCheckpointTrigger(id)
+						triggers <- pending
+					}
+
+				case <-acked:
+					// The source is blocked in Ack, so the batches already in the
+					// channel are exactly those sent before the barrier.
+					for n := len(srcCh); n > 0; n-- {
+						emit(<-srcCh)
+					}
+					position, err := checkpointed.SnapshotPosition()
+					if err == nil {
+						err = e.checkpoints.writePosition(pending.CheckpointID, inst, position)
+					}
+					if err != nil {
+						e.logger.Error("source position failed", "operator", opID, "error", err)
+					}
+					e.emitBarrier(inst, pending.CheckpointID)
+					paused = e.checkpoints.drained(pending.CheckpointID)
+					e.checkpoints.ack(task, pending.CheckpointID, err)
+					pending.Release()
+					pending = nil
+				}
 			}
 		}()
 
 	case operator.Sink:
+		task := e.checkpoints.addTask(false)
+		lag := newEventTimeLag(e.plan, inst.node)
 		e.wg.Add(1)
 		go func() {
 			defer e.wg.Done()
+			defer inst.state.finish()
+			defer e.checkpoints.finish(task, inst, nil)
 			if err := impl.Open(opCtx); err != nil {
-				e.logger.Error("sink open failed", "operator", opID, "error", err)
+				e.fail(ctx, inst, PhaseOpen, err)
+				drainInputs(inst)
 				return
 			}
-			defer impl.Close()
-			for _, inCh := range inst.inputChs {
-				for batch := range inCh {
-					if err := impl.WriteBatch(batch); err != nil {
-						e.logger.Error("sink write failed", "operator", opID, "error", err)
-					}
-					batch.Release()
+			inst.state.store(StateRunning)
+			if e.batchMode() {
+				e.sinkMu.Lock()
+				e.openSinks = append(e.openSinks, inst)
+				e.sinkMu.Unlock()
+			} else {
+				defer e.closeOperator(ctx, inst, impl.Close)
+			}
+			inputs := newInputReader(inst.inputChs, inst.inputSenders, e.checkpoints.aligned())
+			for {
+				_, el, ok := inputs.next()
+				if !ok {
+					return
+				}
+				switch el.kind {
+				case barrierElement:
+					e.processBarrier(task, el.checkpoint, []*operatorInstance{inst})
+				case watermarkElement:
+					inst.observeWatermark(el.watermark)
+				}
+				if el.kind != batchElement {
+					continue
+				}
+				var policy ErrorPolicy
+				span := e.traceBatch(inst, el.span, el.batch.NumRows())
+				err := writeBatch(impl, opCtx.Metrics, el.batch)
+				inst.endTrace(span, 0, err)
+				if err != nil {
+					policy, _ = e.processError(ctx, inst, err, el.batch, nil)
+				} else {
+					lag.observe(el.batch, time.Now())
+				}
+				el.batch.Release()
+				if policy == ErrorPolicyFail {
+					drainInputs(inst)
+					return
 				}
 			}
 		}()
 
 	case operator.Operator:
+		task := e.checkpoints.addTask(false)
 		e.wg.Add(1)
 		go func() {
 			defer e.wg.Done()
+			defer inst.state.finish()
+			defer closeOutputs(inst)
+			defer e.checkpoints.finish(task, inst, nil)
 			if err := impl.Open(opCtx); err != nil {
-				e.logger.Error("operator open failed", "operator", opID, "error", err)
+				e.fail(ctx, inst, PhaseOpen, err)
+				drainInputs(inst)
 				return
 			}
-			defer impl.Close()
-			if inst.outputCh != nil {
-				defer close(inst.outputCh)
+			inst.state.store(StateOpened)
+			defer e.closeOperator(ctx, inst, impl.Close)
+			if err := e.restore(inst); err != nil {
+				e.fail(ctx, inst, PhaseRestore, err)
+				drainInputs(inst)
+				return
 			}
+			inst.state.store(StateRunning)
 
-			for _, inCh := range inst.inputChs {
-				for batch := range inCh {
-					outputs, err := impl.ProcessBatch(batch)
-					batch.Release()
-					if err != nil {
-						e.logger.Error("process batch failed", "operator", opID, "error", err)
-						continue
-					}
-					for _, out := range outputs {
-						if inst.outputCh != nil {
-							inst.outputCh <- out
-						} else {
-							out.Release()
-						}
-					}
+			inputs := newInputReader(inst.inputChs, inst.inputSenders, e.checkpoints.aligned())
+			for {
+				input, el, ok := inputs.next()
+				if !ok {
+					return
+				}
+				if el.kind == barrierElement {
+					e.processBarrier(task, el.checkpoint, []*operatorInstance{inst})
+					continue
+				}
+
+				var outputs []arrow.Record
+				var err error
+				var span trace.Span
+				switch el.kind {
+				case endElement:
+					outputs, err = endInput(impl, input)
+				case watermarkElement:
+					outputs, err = impl.ProcessWatermark(el.watermark)
+				default:
+					span = e.traceBatch(inst, el.span, el.batch.NumRows())
+					outputs, err = processBatch(impl, opCtx.Metrics, input, el.batch)
+				}
+				inst.endTrace(span, totalRows(outputs), err)
+				e.emitRoutes(ctx, inst)
+				var policy ErrorPolicy
+				if err != nil {
+					policy, outputs = e.processError(ctx, inst, err, el.batch, outputs)
+				}
+				if el.batch != nil {
+					el.batch.Release()
+				}
+				if policy == ErrorPolicyFail {
+					drainInputs(inst)
+					return
+				}
+				for _, out := range outputs {
+					e.emit(ctx, inst, out)
+				}
+				if el.kind == watermarkElement {
+					e.emitWatermark(inst, el.watermark)
 				}
 			}
 		}()
 	}
 }
 
-// startChain runs a fused chain of FORWARD-connected operators in a single goroutine.
-func (e *Engine) startChain(ctx context.Context, chain []string, instances map[string]*operatorInstance) {
+// startChain runs one parallel instance of a fused chain of FORWARD-connected
+// operators in a single goroutine.
+func (e *Engine) startChain(ctx context.Context, chain []*operatorInstance) {
 	if len(chain) == 0 {
 		return
 	}
 
 	// Collect all operators in the chain.
 	ops := make([]operator.Operator, 0, len(chain))
-	for _, id := range chain {
-		inst := instances[id]
+	for _, inst := range chain {
 		op, ok := inst.impl.(operator.Operator)
 		if !ok {
 			// Sources and sinks cannot be in the middle of a chain.
-			e.logger.Warn("non-operator in chain, falling back to individual start", "operator", id)
-			for _, cid := range chain {
-				e.startSingle(ctx, cid, instances)
+			e.logger.Warn("non-operator in chain, falling back to individual start", "operator", inst.node.Id)
+			for _, c := range chain {
+				e.startSingle(ctx, c)
 			}
 			return
 		}
@@ -226,64 +999,153 @@ func (e *Engine) startChain(ctx context.Context, chain []string, instances map[s
 	}
 
 	// The chain's input comes from the first operator's input channels.
-	firstInst := instances[chain[0]]
-	// The chain's output goes to the last operator's output channel.
-	lastInst := instances[chain[len(chain)-1]]
+	firstInst := chain[0]
+	// The chain's output goes to the last operator's output.
+	lastInst := chain[len(chain)-1]
 
+	opCtxs := make([]*operator.Context, len(chain))
+	for i, inst := range chain {
+		opCtxs[i] = e.newOperatorContext(ctx, inst)
+	}
+
+	task := e.checkpoints.addTask(false)
 	e.wg.Add(1)
 	go func() {
 		defer e.wg.Done()
+		defer func() {
+			for _, inst := range chain {
+				inst.state.finish()
+			}
+		}()
+		defer closeOutputs(lastInst)
+		defer e.checkpoints.finish(task, firstInst, nil)
 
 		// Open all operators in the chain.
-		for i, id := range chain {
-			opCtx := operator.NewContext(ctx, e.alloc, id, instances[id].node.Name)
-			if err := ops[i].Open(opCtx); err != nil {
-				e.logger.Error("chain operator open failed", "operator", id, "error", err)
+		for i, inst := range chain {
+			if err := ops[i].Open(opCtxs[i]); err != nil {
+				e.fail(ctx, inst, PhaseOpen, err)
+				drainInputs(firstInst)
 				return
 			}
+			inst.state.store(StateOpened)
 		}
 		defer func() {
-			for _, op := range ops {
-				op.Close()
+			for i, op := range ops {
+				e.closeOperator(ctx, chain[i], op.Close)
 			}
 		}()
-
-		if lastInst.outputCh != nil {
-			defer close(lastInst.outputCh)
+		for _, inst := range chain {
+			if err := e.restore(inst); err != nil {
+				e.fail(ctx, inst, PhaseRestore, err)
+				drainInputs(firstInst)
+				return
+			}
+		}
+		for _, inst := range chain {
+			inst.state.store(StateRunning)
 		}
 
 		// Process batches through the chain.
-		for _, inCh := range firstInst.inputChs {
-			for batch := range inCh {
-				// Pipeline the batch through each operator in sequence.
-				batches := []arrow.Record{batch}
-				for _, op := range ops {
-					var nextBatches []arrow.Record
-					for _, b := range batches {
-						outputs, err := op.ProcessBatch(b)
-						b.Release()
-						if err != nil {
-							e.logger.Error("chain process batch failed", "error", err)
-							continue
-						}
-						nextBatches = append(nextBatches, outputs...)
+		inputs := newInputReader(firstInst.inputChs, firstInst.inputSenders, e.checkpoints.aligned())
+		for {
+			input, el, ok := inputs.next()
+			if !ok {
+				return
+			}
+			if el.kind == barrierElement {
+				e.processBarrier(task, el.checkpoint, chain)
+				continue
+			}
+
+			// Only the head of the chain has multiple inputs.
+			var batches []arrow.Record
+			var err error
+			var span trace.Span
+			switch el.kind {
+			case endElement:
+				batches, err = endInput(ops[0], input)
+			case watermarkElement:
+				batches, err = ops[0].ProcessWatermark(el.watermark)
+				firstInst.observeWatermark(el.watermark)
+			default:
+				span = e.traceBatch(firstInst, el.span, el.batch.NumRows())
+				batches, err = processBatch(ops[0], firstInst.opCtx.Metrics, input, el.batch)
+			}
+			firstInst.endTrace(span, totalRows(batches), err)
+			failed := false
+			if err != nil {
+				var policy ErrorPolicy
+				policy, batches = e.processError(ctx, firstInst, err, el.batch, batches)
+				failed = policy == ErrorPolicyFail
+			}
+			if el.batch != nil {
+				el.batch.Release()
+			}
+
+			// Pipeline the head's output through the rest of the chain in sequence.
+			for i, op := range ops[1:] {
+				inst := chain[i+1]
+				// The span of the operator covers every batch the previous one emitted.
+				span := e.traceBatch(inst, chain[i].trace, totalRows(batches))
+				var spanErr error
+				handle := func(input arrow.Record, outputs []arrow.Record, err error) []arrow.Record {
+					if err != nil {
+						spanErr = err
+						var policy ErrorPolicy
+						policy, outputs = e.processError(ctx, inst, err, input, outputs)
+						failed = failed || policy == ErrorPolicyFail
 					}
-					batches = nextBatches
+					return outputs
 				}
 
-				// Emit final results.
-				for _, out := range batches {
-					if lastInst.outputCh != nil {
-						lastInst.outputCh <- out
-					} else {
-						out.Release()
+				var nextBatches []arrow.Record
+				for _, b := range batches {
+					if failed {
+						b.Release()
+						continue
 					}
+					outputs, err := processBatch(op, inst.opCtx.Metrics, 0, b)
+					nextBatches = append(nextBatches, handle(b, outputs, err)...)
+					b.Release()
 				}
+				// Each operator sees the watermark after the batches it released.
+				if el.kind == watermarkElement && !failed {
+					outputs, err := op.ProcessWatermark(el.watermark)
+					nextBatches = append(nextBatches, handle(nil, outputs, err)...)
+					inst.observeWatermark(el.watermark)
+				}
+				inst.endTrace(span, totalRows(nextBatches), spanErr)
+				batches = nextBatches
+			}
+			if failed {
+				releaseAll(batches)
+				drainInputs(firstInst)
+				return
+			}
+
+			// Emit final results.
+			for _, out := range batches {
+				e.emit(ctx, lastInst, out)
+			}
+			if el.kind == watermarkElement {
+				e.emitWatermark(lastInst, el.watermark)
 			}
 		}
 	}()
 }
 
+// operatorParallelism returns the number of parallel instances to run for an
+// operator: its own parallelism if set, else the plan default, else 1.
+func operatorParallelism(plan *pb.ExecutionPlan, node *pb.OperatorNode) int {
+	if node.Parallelism > 0 {
+		return int(node.Parallelism)
+	}
+	if plan.DefaultParallelism > 0 {
+		return int(plan.DefaultParallelism)
+	}
+	return 1
+}
+
 // adjacency represents the DAG adjacency lists.
 type adjacency struct {
 	downstream map[string][]edgeInfo
@@ -309,12 +1171,43 @@ func buildAdjacency(plan *pb.ExecutionPlan) adjacency {
 	return adj
 }
 
+// topologicalOrder returns the operator IDs of the plan so that every operator
+// comes after all of its upstream operators. Ties follow plan and edge order.
+func topologicalOrder(plan *pb.ExecutionPlan, adj adjacency) []string {
+	pending := make(map[string]int, len(plan.Operators))
+	var queue []string
+	for _, op := range plan.Operators {
+		pending[op.Id] = len(adj.upstream[op.Id])
+		if pending[op.Id] == 0 {
+			queue = append(queue, op.Id)
+		}
+	}
+
+	order := make([]string, 0, len(plan.Operators))
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		order = append(order, id)
+		for _, down := range adj.downstream[id] {
+			if pending[down.operatorID]--; pending[down.operatorID] == 0 {
+				queue = append(queue, down.operatorID)
+			}
+		}
+	}
+	return order
+}
+
 // identifyChains finds sequences of operators connected by FORWARD edges
 // where each operator has exactly one downstream and one upstream (linear chain).
 func identifyChains(plan *pb.ExecutionPlan, adj adjacency) [][]string {
 	var chains [][]string
 	visited := make(map[string]bool)
 
+	nodes := make(map[string]*pb.OperatorNode, len(plan.Operators))
+	for _, op := range plan.Operators {
+		nodes[op.Id] = op
+	}
+
 	// Find chain starts: operators that have upstream edges and a single FORWARD downstream.
 	// Exclude sources (no upstream) and sinks (no downstream) from chain heads.
 	for _, op := range plan.Operators {
@@ -324,7 +1217,7 @@ func identifyChains(plan *pb.ExecutionPlan, adj adjacency) [][]string {
 
 		// Sources have no upstream edges — don't start chains from them.
 		ups := adj.upstream[op.Id]
-		if len(ups) == 0 {
+		if len(ups) == 0 || !chainable(op) {
 			continue
 		}
 
@@ -345,7 +1238,8 @@ func identifyChains(plan *pb.ExecutionPlan, adj adjacency) [][]string {
 
 			// Must have exactly one FORWARD upstream and at least one downstream
 			// (exclude sinks which have no downstream edges).
-			if len(ups) != 1 || ups[0].shuffle != pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD || len(downs) == 0 {
+			if len(ups) != 1 || ups[0].shuffle != pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD || len(downs) == 0 ||
+				!chainable(nodes[current]) {
 				break
 			}
 
@@ -367,6 +1261,12 @@ func identifyChains(plan *pb.ExecutionPlan, adj adjacency) [][]string {
 	return chains
 }
 
+// chainable reports whether an operator may be fused into a chain. Route sends
+// rows to specific downstream operators, which needs its own output wiring.
+func chainable(node *pb.OperatorNode) bool {
+	return node.OperatorType != pb.OperatorType_OPERATOR_TYPE_ROUTE
+}
+
 // isChainedEdge checks if two operators are adjacent within the same chain.
 func isChainedEdge(chains [][]string, from, to string) bool {
 	for _, chain := range chains {
@@ -4,19 +4,38 @@ package engine
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 
 	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
 	"github.com/sandboxws/isotope/runtime/pkg/connectors"
 	"github.com/sandboxws/isotope/runtime/pkg/operator"
 	"github.com/sandboxws/isotope/runtime/pkg/operators"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
 )
 
 // TestE2EGeneratorFilterMapConsole runs a full pipeline:
@@ -313,6 +332,520 @@ func (s *collectingSink) ReleaseAll() {
 	s.batches = nil
 }
 
+// countingSink counts the rows of batches containing a column and calls
+// onTarget once the count reaches target.
+type countingSink struct {
+	column   string
+	target   int64
+	onTarget func()
+	count    int64
+}
+
+func (s *countingSink) Open(_ *operator.Context) error { return nil }
+
+func (s *countingSink) WriteBatch(batch arrow.Record) error {
+	if len(batch.Schema().FieldIndices(s.column)) == 0 {
+		return nil
+	}
+	s.count += batch.NumRows()
+	if s.count >= s.target {
+		s.onTarget()
+	}
+	return nil
+}
+
+func (s *countingSink) Close() error { return nil }
+
+// inputTrackingOperator is a two-input pass-through that records rows and
+// end-of-input per input.
+type inputTrackingOperator struct {
+	rows  [2]int64
+	ended [2]bool
+}
+
+func (o *inputTrackingOperator) Open(_ *operator.Context) error { return nil }
+
+func (o *inputTrackingOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	return o.ProcessBatchFrom(0, batch)
+}
+
+func (o *inputTrackingOperator) ProcessBatchFrom(input int, batch arrow.Record) ([]arrow.Record, error) {
+	o.rows[input] += batch.NumRows()
+	batch.Retain()
+	return []arrow.Record{batch}, nil
+}
+
+func (o *inputTrackingOperator) EndInput(input int) ([]arrow.Record, error) {
+	o.ended[input] = true
+	return nil, nil
+}
+
+func (o *inputTrackingOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *inputTrackingOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error {
+	return nil
+}
+
+func (o *inputTrackingOperator) Close() error { return nil }
+
+// watermarkBufferOperator holds batches until the next watermark and records
+// every watermark it sees.
+type watermarkBufferOperator struct {
+	buffered   []arrow.Record
+	watermarks []int64
+}
+
+func (o *watermarkBufferOperator) Open(_ *operator.Context) error { return nil }
+
+func (o *watermarkBufferOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	batch.Retain()
+	o.buffered = append(o.buffered, batch)
+	return nil, nil
+}
+
+func (o *watermarkBufferOperator) ProcessWatermark(wm operator.Watermark) ([]arrow.Record, error) {
+	o.watermarks = append(o.watermarks, wm.Timestamp)
+	out := o.buffered
+	o.buffered = nil
+	return out, nil
+}
+
+func (o *watermarkBufferOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error {
+	return nil
+}
+
+func (o *watermarkBufferOperator) Close() error {
+	for _, b := range o.buffered {
+		b.Release()
+	}
+	o.buffered = nil
+	return nil
+}
+
+// rowCountingOperator passes batches through and snapshots the number of rows
+// it has seen at every checkpoint barrier.
+type rowCountingOperator struct {
+	rows      int64
+	snapshots int
+}
+
+func (o *rowCountingOperator) Open(_ *operator.Context) error { return nil }
+
+func (o *rowCountingOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	o.rows += batch.NumRows()
+	batch.Retain()
+	return []arrow.Record{batch}, nil
+}
+
+func (o *rowCountingOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *rowCountingOperator) ProcessCheckpointBarrier(barrier operator.CheckpointBarrier) error {
+	o.snapshots++
+	return os.WriteFile(filepath.Join(barrier.Dir, "rows"), []byte(strconv.FormatInt(o.rows, 10)), 0o644)
+}
+
+func (o *rowCountingOperator) Close() error { return nil }
+
+// runningCountOperator is a restorable operator that appends to every row the
+// number of rows it has seen so far, including that row.
+type runningCountOperator struct {
+	alloc memory.Allocator
+	seen  int64
+}
+
+func (o *runningCountOperator) Open(ctx *operator.Context) error {
+	o.alloc = ctx.Alloc
+	return nil
+}
+
+func (o *runningCountOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	ids := batch.Column(0).(*array.Int64)
+	seen := make([]int64, ids.Len())
+	for i := range seen {
+		o.seen++
+		seen[i] = o.seen
+	}
+
+	idBldr := array.NewInt64Builder(o.alloc)
+	defer idBldr.Release()
+	idBldr.AppendValues(ids.Int64Values(), nil)
+	seenBldr := array.NewInt64Builder(o.alloc)
+	defer seenBldr.Release()
+	seenBldr.AppendValues(seen, nil)
+	idArr, seenArr := idBldr.NewArray(), seenBldr.NewArray()
+	defer idArr.Release()
+	defer seenArr.Release()
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "seen", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	return []arrow.Record{array.NewRecord(schema, []arrow.Array{idArr, seenArr}, int64(len(seen)))}, nil
+}
+
+func (o *runningCountOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *runningCountOperator) ProcessCheckpointBarrier(barrier operator.CheckpointBarrier) error {
+	return os.WriteFile(filepath.Join(barrier.Dir, "seen"), []byte(strconv.FormatInt(o.seen, 10)), 0o644)
+}
+
+func (o *runningCountOperator) RestoreState(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "seen"))
+	if err != nil {
+		return err
+	}
+	o.seen, err = strconv.ParseInt(string(data), 10, 64)
+	return err
+}
+
+func (o *runningCountOperator) Close() error { return nil }
+
+// keyedCountOperator appends to every row the number of rows with the same
+// id modulo 10 it has seen so far, kept in keyed state.
+type keyedCountOperator struct {
+	ctx   *operator.Context
+	count *state.Value[int64]
+}
+
+func (o *keyedCountOperator) Open(ctx *operator.Context) error {
+	o.ctx = ctx
+	o.count = state.NewValue(ctx.State, "count", state.Int64)
+	return nil
+}
+
+func (o *keyedCountOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	ids := batch.Column(0).(*array.Int64)
+	counts := make([]int64, ids.Len())
+	for i := range counts {
+		o.ctx.State.SetCurrentKey([]byte{byte(ids.Value(i) % 10)})
+		n, _, err := o.count.Get()
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = n + 1
+		if err := o.count.Set(counts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	countArr := makeInt64Batch(o.ctx.Alloc, "seen", counts)
+	defer countArr.Release()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "seen", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	return []arrow.Record{array.NewRecord(schema, []arrow.Array{ids, countArr.Column(0)}, int64(len(counts)))}, nil
+}
+
+func (o *keyedCountOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *keyedCountOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
+
+func (o *keyedCountOperator) Close() error { return nil }
+
+// seenSink records the seen value written for every id.
+type seenSink struct {
+	seen      map[int64][]int64
+	afterRows int64
+	onRows    func()
+	rows      int64
+}
+
+func (s *seenSink) Open(_ *operator.Context) error { return nil }
+
+func (s *seenSink) WriteBatch(batch arrow.Record) error {
+	ids := batch.Column(0).(*array.Int64)
+	seen := batch.Column(1).(*array.Int64)
+	for i := 0; i < ids.Len(); i++ {
+		s.seen[ids.Value(i)] = append(s.seen[ids.Value(i)], seen.Value(i))
+	}
+	s.rows += batch.NumRows()
+	if s.onRows != nil && s.rows >= s.afterRows {
+		s.onRows()
+	}
+	return nil
+}
+
+func (s *seenSink) Close() error { return nil }
+
+// failingOpenOperator is a pass-through whose Open fails while *failures is
+// positive, counting down on every attempt.
+type failingOpenOperator struct {
+	failures *atomic.Int32
+}
+
+func (o *failingOpenOperator) Open(_ *operator.Context) error {
+	if o.failures.Add(-1) >= 0 {
+		return fmt.Errorf("injected open failure")
+	}
+	return nil
+}
+
+func (o *failingOpenOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	batch.Retain()
+	return []arrow.Record{batch}, nil
+}
+
+func (o *failingOpenOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *failingOpenOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error {
+	return nil
+}
+
+func (o *failingOpenOperator) Close() error { return nil }
+
+// errInjected is the cause of the failures injected by test operators.
+var errInjected = errors.New("injected process failure")
+
+// failingBatchOperator passes batches through but fails every batch whose
+// first id is a multiple of every. It returns the batch alongside the error.
+type failingBatchOperator struct {
+	every         int64
+	failedRows    int64
+	failedBatches int64
+}
+
+func (o *failingBatchOperator) Open(_ *operator.Context) error { return nil }
+
+func (o *failingBatchOperator) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	batch.Retain()
+	if batch.Column(0).(*array.Int64).Value(0)%o.every == 0 {
+		o.failedRows += batch.NumRows()
+		o.failedBatches++
+		return []arrow.Record{batch}, errInjected
+	}
+	return []arrow.Record{batch}, nil
+}
+
+func (o *failingBatchOperator) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) {
+	return nil, nil
+}
+
+func (o *failingBatchOperator) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error {
+	return nil
+}
+
+func (o *failingBatchOperator) Close() error { return nil }
+
+// collectingDeadLetters stores the dead letters it receives.
+type collectingDeadLetters struct {
+	mu      sync.Mutex
+	letters []operator.DeadLetter
+}
+
+func (q *collectingDeadLetters) Send(letter operator.DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.letters = append(q.letters, letter)
+	return nil
+}
+
+func (q *collectingDeadLetters) Close() error { return nil }
+
+// closeOrderSink counts rows and, on Close, records its name and row count in
+// a log shared with other sinks.
+type closeOrderSink struct {
+	name string
+	rows int64
+	mu   *sync.Mutex
+	log  *[]string
+}
+
+func (s *closeOrderSink) Open(_ *operator.Context) error { return nil }
+
+func (s *closeOrderSink) WriteBatch(batch arrow.Record) error {
+	s.rows += batch.NumRows()
+	return nil
+}
+
+func (s *closeOrderSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.log = append(*s.log, fmt.Sprintf("%s:%d", s.name, s.rows))
+	return nil
+}
+
+// slowSink sleeps on every batch.
+type slowSink struct {
+	delay time.Duration
+}
+
+func (s *slowSink) Open(_ *operator.Context) error { return nil }
+
+func (s *slowSink) WriteBatch(_ arrow.Record) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func (s *slowSink) Close() error { return nil }
+
+// partitionedSource is a partitioned source reading ids from partitions
+// numbered 0 to partitions-1, each holding rows consecutive ids. Instance i
+// of n reads the partitions p with p % n == i, a few rows per batch.
+type partitionedSource struct {
+	partitions int32
+	rows       int64
+	ctx        *operator.Context
+	offsets    map[int32]int64 // next row to read per partition
+}
+
+func (s *partitionedSource) Open(ctx *operator.Context) error {
+	s.ctx = ctx
+	s.offsets = make(map[int32]int64)
+	return nil
+}
+
+func (s *partitionedSource) Run(ctx *operator.Context, out chan<- arrow.Record) error {
+	defer close(out)
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var next []int64
+		for p := int32(ctx.InstanceIndex); p < s.partitions; p += int32(ctx.Parallelism) {
+			for offset := s.offsets[p]; offset < s.rows && len(next) < 10; offset++ {
+				next = append(next, int64(p)*s.rows+offset)
+			}
+			if len(next) > 0 {
+				select {
+				case <-ctx.Done():
+					return nil
+				case t := <-ctx.Checkpoints:
+					t.Ack()
+					continue
+				case <-ticker.C:
+				}
+				batch := makeInt64Batch(ctx.Alloc, "id", next)
+				select {
+				case out <- batch:
+				case <-ctx.Done():
+					batch.Release()
+					return nil
+				}
+				s.offsets[p] += int64(len(next))
+				next = next[:0]
+			}
+		}
+		if len(next) == 0 && s.exhausted(ctx) {
+			return nil
+		}
+	}
+}
+
+// exhausted reports whether the instance has read all its partitions.
+func (s *partitionedSource) exhausted(ctx *operator.Context) bool {
+	for p := int32(ctx.InstanceIndex); p < s.partitions; p += int32(ctx.Parallelism) {
+		if s.offsets[p] < s.rows {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *partitionedSource) SnapshotPosition() ([]byte, error) {
+	return json.Marshal(s.offsets)
+}
+
+func (s *partitionedSource) RestorePosition(position []byte) error {
+	return s.RestorePositions([][]byte{position})
+}
+
+func (s *partitionedSource) RestorePositions(positions [][]byte) error {
+	for _, position := range positions {
+		var offsets map[int32]int64
+		if err := json.Unmarshal(position, &offsets); err != nil {
+			return err
+		}
+		for p, offset := range offsets {
+			s.offsets[p] = max(s.offsets[p], offset)
+		}
+	}
+	return nil
+}
+
+func (s *partitionedSource) Close() error { return nil }
+
+// gatedSource is a checkpointed source sending one row every millisecond
+// that acknowledges checkpoints only once release is closed.
+type gatedSource struct {
+	release chan struct{}
+	sent    int64
+}
+
+func (s *gatedSource) Open(_ *operator.Context) error { return nil }
+
+func (s *gatedSource) Run(ctx *operator.Context, out chan<- arrow.Record) error {
+	defer close(out)
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-ctx.Checkpoints:
+			select {
+			case <-s.release:
+			case <-ctx.Done():
+				return nil
+			}
+			t.Ack()
+		case <-ticker.C:
+			batch := makeInt64Batch(ctx.Alloc, "id", []int64{s.sent})
+			select {
+			case out <- batch:
+				s.sent++
+			case <-ctx.Done():
+				batch.Release()
+				return nil
+			}
+		}
+	}
+}
+
+func (s *gatedSource) SnapshotPosition() ([]byte, error) {
+	return []byte(strconv.FormatInt(s.sent, 10)), nil
+}
+
+func (s *gatedSource) RestorePosition(position []byte) error {
+	var err error
+	s.sent, err = strconv.ParseInt(string(position), 10, 64)
+	return err
+}
+
+func (s *gatedSource) Close() error { return nil }
+
+// idSink counts how often every id was written and calls onRows once rows
+// reach afterRows.
+type idSink struct {
+	ids       map[int64]int
+	afterRows int
+	onRows    func()
+}
+
+func (s *idSink) Open(_ *operator.Context) error { return nil }
+
+func (s *idSink) WriteBatch(batch arrow.Record) error {
+	ids := batch.Column(0).(*array.Int64)
+	for i := 0; i < ids.Len(); i++ {
+		s.ids[ids.Value(i)]++
+	}
+	if s.onRows != nil && len(s.ids) >= s.afterRows {
+		s.onRows()
+	}
+	return nil
+}
+
+func (s *idSink) Close() error { return nil }
+
 // TestE2EGeneratorToCollectingSink verifies data flows through to a collecting sink.
 func TestE2EGeneratorToCollectingSink(t *testing.T) {
 	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
@@ -440,11 +973,2861 @@ func TestE2EFilterReducesRows(t *testing.T) {
 	}
 }
 
-// ── helpers ─────────────────────────────────────────────────────────
+// TestRegistryBuildsBuiltins verifies that plan configs resolve to the built-in operators.
+func TestRegistryBuildsBuiltins(t *testing.T) {
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
 
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+	tests := []struct {
+		node *pb.OperatorNode
+		want interface{}
+	}{
+		{
+			node: &pb.OperatorNode{Id: "src", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{Schema: schema, MaxRows: 10}}},
+			want: &connectors.Generator{},
+		},
+		{
+			node: &pb.OperatorNode{Id: "f", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER,
+				Config: &pb.OperatorNode_Filter{Filter: &pb.FilterConfig{ConditionSql: "id > 1"}}},
+			want: &operators.Filter{},
+		},
+		{
+			node: &pb.OperatorNode{Id: "c", OperatorType: pb.OperatorType_OPERATOR_TYPE_CAST,
+				Config: &pb.OperatorNode_Cast{Cast: &pb.CastConfig{Columns: map[string]*pb.SchemaField{
+					"id": {Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_STRING},
+				}}}},
+			want: &operators.Cast{},
+		},
+		{
+			node: &pb.OperatorNode{Id: "sink", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			want: &connectors.Console{},
+		},
 	}
-	return s[:maxLen] + "..."
+
+	for _, tt := range tests {
+		got, err := NewOperator(tt.node)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.node.OperatorType, err)
+		}
+		if gotType, wantType := fmt.Sprintf("%T", got), fmt.Sprintf("%T", tt.want); gotType != wantType {
+			t.Errorf("%s: expected %s, got %s", tt.node.OperatorType, wantType, gotType)
+		}
+	}
+}
+
+// TestRegistryRejectsMissingConfig verifies that a node without its oneof config fails to build.
+func TestRegistryRejectsMissingConfig(t *testing.T) {
+	_, err := NewOperator(&pb.OperatorNode{Id: "f", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER})
+	if err == nil || !strings.Contains(err.Error(), "missing filter config") {
+		t.Errorf("expected missing config error, got: %v", err)
+	}
+
+	_, err = NewOperator(&pb.OperatorNode{Id: "m", OperatorType: pb.OperatorType_OPERATOR_TYPE_MATCH_RECOGNIZE})
+	if err == nil || !strings.Contains(err.Error(), "no factory registered") {
+		t.Errorf("expected unregistered type error, got: %v", err)
+	}
+}
+
+// TestE2ERegistryPlan runs a plan built entirely from configs through the default factory.
+func TestE2ERegistryPlan(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "registry-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{RowsPerSecond: 100000, MaxRows: 100}}},
+			{Id: "filter", Name: "filter", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, InputSchema: schema, OutputSchema: schema,
+				Config: &pb.OperatorNode_Filter{Filter: &pb.FilterConfig{ConditionSql: "id >= 90"}}},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "filter", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "filter", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	// Use the registry for everything except the sink, so the output can be inspected.
+	collector := &collectingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.OperatorType == pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK {
+			return collector, nil
+		}
+		return NewOperator(node)
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.ReleaseAll()
+
+	if total := collector.TotalRows(); total != 10 {
+		t.Errorf("expected 10 rows, got %d", total)
+	}
+}
+
+// TestHashPartitionerKeepsKeysTogether verifies that rows with equal keys land in the same part.
+func TestHashPartitionerKeepsKeysTogether(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	keys := []string{"a", "b", "c", "a", "d", "b", "e", "a", "f", "c"}
+	bldr := array.NewStringBuilder(alloc)
+	bldr.AppendValues(keys, nil)
+	arr := bldr.NewArray()
+	bldr.Release()
+	batch := array.NewRecord(arrow.NewSchema([]arrow.Field{{Name: "key", Type: arrow.BinaryTypes.String}}, nil),
+		[]arrow.Array{arr}, int64(len(keys)))
+	arr.Release()
+	defer batch.Release()
+
+	edge := &pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"key"}}
+	parts, err := newPartitioners(edge, 1, alloc, nil)[0].partition(batch, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := make(map[string]int)
+	var total int64
+	for i, part := range parts {
+		if part == nil {
+			continue
+		}
+		total += part.NumRows()
+		col := part.Column(0).(*array.String)
+		for row := 0; row < col.Len(); row++ {
+			if prev, ok := owner[col.Value(row)]; ok && prev != i {
+				t.Errorf("key %q sent to parts %d and %d", col.Value(row), prev, i)
+			}
+			owner[col.Value(row)] = i
+		}
+		part.Release()
+	}
+	if total != int64(len(keys)) {
+		t.Errorf("expected %d rows across parts, got %d", len(keys), total)
+	}
+}
+
+// TestE2EHashPartitionedParallelism runs a parallel source into a parallel keyed sink
+// and verifies that every row reaches the instance owning its key.
+func TestE2EHashPartitionedParallelism(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	const sinkParallelism = 3
+	plan := &pb.ExecutionPlan{
+		PipelineName:       "hash-test",
+		DefaultParallelism: 2,
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{Id: "filter", Name: "filter", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, InputSchema: schema, OutputSchema: schema},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: sinkParallelism},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "filter", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "filter", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"id"}},
+		},
+	}
+
+	var sinks []*collectingSink
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.OperatorType {
+		case pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE:
+			return connectors.NewGenerator(schema, 100000, 100), nil
+		case pb.OperatorType_OPERATOR_TYPE_FILTER:
+			return operators.NewFilter("id >= 0"), nil
+		default:
+			sink := &collectingSink{}
+			sinks = append(sinks, sink)
+			return sink, nil
+		}
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sinks) != sinkParallelism {
+		t.Fatalf("expected %d sink instances, got %d", sinkParallelism, len(sinks))
+	}
+
+	h := newPartitioners(plan.Edges[1], 1, alloc, nil)[0].(*hashPartitioner)
+	seen := make(map[int64]bool)
+	for i, sink := range sinks {
+		for _, batch := range sink.batches {
+			ids := batch.Column(0).(*array.Int64)
+			for row := 0; row < ids.Len(); row++ {
+				if seen[ids.Value(row)] {
+					t.Errorf("id %d delivered twice", ids.Value(row))
+				}
+				seen[ids.Value(row)] = true
+				if want := int(h.hashRow([]arrow.Array{ids}, row) % sinkParallelism); want != i {
+					t.Errorf("id %d reached instance %d, expected %d", ids.Value(row), i, want)
+				}
+			}
+		}
+		sink.ReleaseAll()
+	}
+	if len(seen) != 100 {
+		t.Errorf("expected 100 distinct ids, got %d", len(seen))
+	}
+}
+
+// TestE2EAggregateUpserts runs a parallel GROUP BY behind a hash shuffle and
+// checks that the latest upsert of every group holds its final result.
+func TestE2EAggregateUpserts(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+			{Name: "even", ArrowType: pb.ArrowType_ARROW_TYPE_BOOLEAN},
+		},
+	}
+	plan := &pb.ExecutionPlan{
+		PipelineName:       "aggregate-test",
+		DefaultParallelism: 2,
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{
+				Id: "agg", Name: "totals", OperatorType: pb.OperatorType_OPERATOR_TYPE_AGGREGATE,
+				ChangelogMode: pb.ChangelogMode_CHANGELOG_MODE_UPSERT,
+				Config: &pb.OperatorNode_Aggregate{Aggregate: &pb.AggregateConfig{
+					GroupBy: []string{"even"},
+					Select:  map[string]string{"n": "COUNT(*)", "total": "SUM(id)"},
+				}},
+			},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 1},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "agg", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"even"}},
+			{FromOperator: "agg", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+
+	sink := &collectingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 100000, totalRows), nil
+		case "sink":
+			return sink, nil
+		default:
+			return NewOperator(node)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := NewEngine(plan, alloc, factory).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer sink.ReleaseAll()
+
+	type result struct{ n, total int64 }
+	latest := make(map[bool]result)
+	for _, batch := range sink.batches {
+		even := batch.Column(0).(*array.Boolean)
+		n := batch.Column(1).(*array.Int64)
+		total := batch.Column(2).(*array.Int64)
+		kinds := batch.Column(3).(*array.Int8)
+		for row := 0; row < int(batch.NumRows()); row++ {
+			kind := operator.RowKind(kinds.Value(row))
+			if _, ok := latest[even.Value(row)]; ok == (kind == operator.Insert) {
+				t.Errorf("group even=%v: unexpected %s", even.Value(row), kind)
+			}
+			latest[even.Value(row)] = result{n.Value(row), total.Value(row)}
+		}
+	}
+	// Ids run from 0 to totalRows-1.
+	want := map[bool]result{
+		true:  {totalRows / 2, (totalRows / 2) * (totalRows - 2) / 2},
+		false: {totalRows / 2, (totalRows / 2) * totalRows / 2},
+	}
+	if !reflect.DeepEqual(latest, want) {
+		t.Errorf("expected final results %v, got %v", want, latest)
+	}
+}
+
+// TestE2EValidatorRejectsUnpartitionedAggregate verifies that a parallel
+// aggregate needs a HASH edge on its group_by columns.
+func TestE2EValidatorRejectsUnpartitionedAggregate(t *testing.T) {
+	tests := []struct {
+		edge *pb.Edge
+		want string
+	}{
+		{&pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN}, "requires a HASH shuffle"},
+		{&pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"user", "id"}}, `partition key "id"`},
+		{&pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"user"}}, ""},
+	}
+	for _, tt := range tests {
+		tt.edge.FromOperator, tt.edge.ToOperator = "src", "agg"
+		plan := &pb.ExecutionPlan{
+			PipelineName: "aggregate-validate-test",
+			Operators: []*pb.OperatorNode{
+				{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+				{Id: "agg", Name: "totals", OperatorType: pb.OperatorType_OPERATOR_TYPE_AGGREGATE, Parallelism: 2,
+					Config: &pb.OperatorNode_Aggregate{Aggregate: &pb.AggregateConfig{
+						GroupBy: []string{"user", "region"},
+						Select:  map[string]string{"n": "COUNT(*)"},
+					}}},
+			},
+			Edges: []*pb.Edge{tt.edge},
+		}
+		err := ValidatePlan(plan)
+		if tt.want == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", tt.edge.PartitionKeys, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%v: expected an error containing %q, got %v", tt.edge.PartitionKeys, tt.want, err)
+		}
+	}
+}
+
+// TestE2EValidatorRejectsAppendOnlyAggregate verifies that an aggregate
+// cannot emit its updates as an append-only changelog.
+func TestE2EValidatorRejectsAppendOnlyAggregate(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "aggregate-append-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "agg", Name: "totals", OperatorType: pb.OperatorType_OPERATOR_TYPE_AGGREGATE,
+				ChangelogMode: pb.ChangelogMode_CHANGELOG_MODE_APPEND_ONLY,
+				Config: &pb.OperatorNode_Aggregate{Aggregate: &pb.AggregateConfig{
+					GroupBy: []string{"user"},
+					Select:  map[string]string{"n": "COUNT(*)"},
+				}}},
+		},
+		Edges: []*pb.Edge{{FromOperator: "src", ToOperator: "agg", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD}},
+	}
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "append-only changelog") {
+		t.Errorf("expected an append-only aggregate to be rejected, got %v", err)
+	}
+
+	plan.Operators[1].ChangelogMode = pb.ChangelogMode_CHANGELOG_MODE_RETRACT
+	if err := ValidatePlan(plan); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestE2EValidatorRejectsForwardParallelismMismatch verifies that FORWARD edges need equal parallelism.
+func TestE2EValidatorRejectsForwardParallelismMismatch(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "mismatch-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "a", Name: "a", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, Parallelism: 2},
+			{Id: "b", Name: "b", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, Parallelism: 3},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "a", ToOperator: "b", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "equal parallelism") {
+		t.Errorf("expected parallelism mismatch error, got: %v", err)
+	}
+}
+
+// TestE2EBroadcastDistribution verifies that a BROADCAST edge delivers every row to every instance.
+func TestE2EBroadcastDistribution(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "broadcast-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 3},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_BROADCAST},
+		},
+	}
+
+	var sinks []*collectingSink
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.OperatorType == pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE {
+			return connectors.NewGenerator(schema, 100000, 100), nil
+		}
+		sink := &collectingSink{}
+		sinks = append(sinks, sink)
+		return sink, nil
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, sink := range sinks {
+		if total := sink.TotalRows(); total != 100 {
+			t.Errorf("instance %d: expected 100 rows, got %d", i, total)
+		}
+		sink.ReleaseAll()
+	}
+}
+
+// TestRoundRobinDistribution verifies that ROUND_ROBIN spreads batches evenly across instances.
+func TestRoundRobinDistribution(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	batch := makeInt64Batch(alloc, "id", []int64{1, 2, 3, 4, 5})
+	defer batch.Release()
+
+	edge := &pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN}
+	p := newPartitioners(edge, 1, alloc, nil)[0]
+
+	rows := make([]int64, 3)
+	for i := 0; i < 9; i++ {
+		parts, err := p.partition(batch, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, part := range parts {
+			if part != nil {
+				rows[j] += part.NumRows()
+				part.Release()
+			}
+		}
+	}
+
+	for i, n := range rows {
+		if n != 15 {
+			t.Errorf("instance %d: expected 15 rows, got %d", i, n)
+		}
+	}
+}
+
+// TestRangeDistribution verifies that RANGE assigns contiguous, ordered key ranges to instances.
+func TestRangeDistribution(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	// Keys 0..99 in shuffled order.
+	ids := make([]int64, 100)
+	for i := range ids {
+		ids[i] = int64((i * 37) % 100)
+	}
+	batch := makeInt64Batch(alloc, "id", ids)
+	defer batch.Release()
+
+	edge := &pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE, PartitionKeys: []string{"id"}}
+	partitioners := newPartitioners(edge, 2, alloc, nil)
+
+	parts, err := partitioners[0].partition(batch, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevMax := int64(-1)
+	for i, part := range parts {
+		if part == nil {
+			t.Fatalf("instance %d received no rows", i)
+		}
+		if part.NumRows() != 25 {
+			t.Errorf("instance %d: expected 25 rows, got %d", i, part.NumRows())
+		}
+		col := part.Column(0).(*array.Int64)
+		minV, maxV := col.Value(0), col.Value(0)
+		for row := 1; row < col.Len(); row++ {
+			minV = min(minV, col.Value(row))
+			maxV = max(maxV, col.Value(row))
+		}
+		if minV <= prevMax {
+			t.Errorf("instance %d range [%d, %d] overlaps previous max %d", i, minV, maxV, prevMax)
+		}
+		prevMax = maxV
+		part.Release()
+	}
+
+	// A second sender of the same edge must use the same boundaries.
+	probe := makeInt64Batch(alloc, "id", []int64{30})
+	defer probe.Release()
+	parts, err = partitioners[1].partition(probe, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts[1] == nil {
+		t.Error("expected key 30 to reach instance 1 from the second sender")
+	}
+	for _, part := range parts {
+		if part != nil {
+			part.Release()
+		}
+	}
+}
+
+// TestPartitionKeyTypes verifies unsigned keys keep their order across a
+// RANGE edge and that a key column of an unsupported type is an error
+// rather than sending every row to one instance.
+func TestPartitionKeyTypes(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	ids := []uint64{1 << 63, 1, 1<<63 + 5, 2}
+	bldr := array.NewUint64Builder(alloc)
+	bldr.AppendValues(ids, nil)
+	arr := bldr.NewArray()
+	bldr.Release()
+	batch := array.NewRecord(arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Uint64}}, nil),
+		[]arrow.Array{arr}, int64(len(ids)))
+	arr.Release()
+	defer batch.Release()
+
+	edge := &pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE, PartitionKeys: []string{"id"}}
+	parts, err := newPartitioners(edge, 1, alloc, nil)[0].partition(batch, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]uint64{{1, 2}, {1 << 63, 1<<63 + 5}} {
+		if parts[i] == nil {
+			t.Fatalf("instance %d received no rows", i)
+		}
+		got := parts[i].Column(0).(*array.Uint64).Uint64Values()
+		if !slices.Equal(got, want) {
+			t.Errorf("instance %d: expected %v, got %v", i, want, got)
+		}
+		parts[i].Release()
+	}
+
+	decBldr := array.NewDecimal128Builder(alloc, &arrow.Decimal128Type{Precision: 10, Scale: 2})
+	decBldr.AppendValues([]decimal128.Num{decimal128.FromI64(1), decimal128.FromI64(2)}, nil)
+	dec := decBldr.NewArray()
+	decBldr.Release()
+	decimals := array.NewRecord(arrow.NewSchema([]arrow.Field{{Name: "id", Type: dec.DataType()}}, nil),
+		[]arrow.Array{dec}, 2)
+	dec.Release()
+	defer decimals.Release()
+	for _, shuffle := range []pb.ShuffleStrategy{pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE} {
+		edge := &pb.Edge{Shuffle: shuffle, PartitionKeys: []string{"id"}}
+		if _, err := newPartitioners(edge, 1, alloc, nil)[0].partition(decimals, 2); err == nil ||
+			!strings.Contains(err.Error(), "unsupported type") {
+			t.Errorf("%s: expected a decimal key to be rejected, got %v", shuffle, err)
+		}
+	}
+}
+
+// TestRangeBoundariesSurviveCheckpoints stores sampled range boundaries in a
+// snapshot and restores them, unless the edge or its key column's type
+// changed.
+func TestRangeBoundariesSurviveCheckpoints(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "range-restore-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "sink", Name: "sink", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 3},
+		},
+		Edges: []*pb.Edge{{FromOperator: "src", ToOperator: "sink",
+			Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE, PartitionKeys: []string{"id", "name"}}},
+	}
+	name := rangeEdgeName(plan.Edges[0])
+	bounds := [][]interface{}{{int64(1 << 60), nil}, {int64(1<<60 + 1), "b"}}
+
+	dir := t.TempDir()
+	ranges, err := restoreRanges(plan, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges[name].bounds = bounds
+	if err := writeRanges(dir, ranges); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := restoreRanges(plan, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored[name].sampled(); !reflect.DeepEqual(got, bounds) {
+		t.Errorf("expected boundaries %v, got %v", bounds, got)
+	}
+
+	plan.Operators[1].Parallelism = 4
+	if restored, err = restoreRanges(plan, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored[name].sampled(); got != nil {
+		t.Errorf("expected a new parallelism to sample boundaries afresh, got %v", got)
+	}
+
+	// Boundaries of another type than the key column are sampled afresh.
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+	batch := makeInt64Batch(alloc, "id", []int64{5, 1, 3, 2, 4, 0})
+	defer batch.Release()
+	edge := &pb.Edge{Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE, PartitionKeys: []string{"id"}}
+	stale := &rangeBoundaries{keys: edge.PartitionKeys, bounds: [][]interface{}{{"a"}, {"b"}}}
+	parts, err := newPartitioners(edge, 1, alloc, stale)[0].partition(batch, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range parts {
+		if part == nil || part.NumRows() != 2 {
+			t.Errorf("expected resampled boundaries to split 6 rows evenly, got %v", parts)
+		}
+		if part != nil {
+			part.Release()
+		}
+	}
+	if got, want := stale.sampled(), [][]interface{}{{int64(2)}, {int64(4)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected boundaries %v, got %v", want, got)
+	}
+}
+
+// TestE2EFanOutToMultipleConsumers verifies that an operator with two downstream
+// edges delivers every batch to both consumers.
+func TestE2EFanOutToMultipleConsumers(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "fanout-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{Id: "filter", Name: "filter", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, InputSchema: schema, OutputSchema: schema},
+			{Id: "filtered", Name: "filtered", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			{Id: "archive", Name: "archive", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "filter", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "src", ToOperator: "archive", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "filter", ToOperator: "filtered", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	sinks := map[string]*collectingSink{"filtered": {}, "archive": {}}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.OperatorType {
+		case pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE:
+			return connectors.NewGenerator(schema, 100000, 100), nil
+		case pb.OperatorType_OPERATOR_TYPE_FILTER:
+			return operators.NewFilter("id < 50"), nil
+		default:
+			return sinks[node.Id], nil
+		}
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer sinks["filtered"].ReleaseAll()
+	defer sinks["archive"].ReleaseAll()
+
+	if total := sinks["filtered"].TotalRows(); total != 50 {
+		t.Errorf("filtered: expected 50 rows, got %d", total)
+	}
+	if total := sinks["archive"].TotalRows(); total != 100 {
+		t.Errorf("archive: expected 100 rows, got %d", total)
+	}
+}
+
+// TestE2EUnionReadsLiveInputsConcurrently verifies that a Union fed by an
+// unbounded input still receives batches from its other input.
+func TestE2EUnionReadsLiveInputsConcurrently(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	liveSchema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "a", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	boundedSchema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "b", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "union-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "live", Name: "live", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "bounded", Name: "bounded", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "union", Name: "union", OperatorType: pb.OperatorType_OPERATOR_TYPE_UNION},
+			{Id: "sink", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "live", ToOperator: "union", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "bounded", ToOperator: "union", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "union", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Stop the pipeline once every bounded row has made it through the union.
+	sink := &countingSink{column: "b", target: 100, onTarget: cancel}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "live":
+			return connectors.NewGenerator(liveSchema, 1000, 0), nil
+		case "bounded":
+			return connectors.NewGenerator(boundedSchema, 100000, 100), nil
+		case "union":
+			return operators.NewUnion(), nil
+		default:
+			return sink, nil
+		}
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatal("union stalled on the unbounded input")
+	}
+	if sink.count != 100 {
+		t.Errorf("expected 100 rows from the bounded input, got %d", sink.count)
+	}
+}
+
+// TestE2EMultiInputOperatorSeesInputIndex verifies that two-input operators are told
+// which input each batch came from and when each input ends.
+func TestE2EMultiInputOperatorSeesInputIndex(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "multi-input-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "left", Name: "left", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "right", Name: "right", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "join", Name: "join", OperatorType: pb.OperatorType_OPERATOR_TYPE_HASH_JOIN},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "left", ToOperator: "join", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "right", ToOperator: "join", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "join", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	join := &inputTrackingOperator{}
+	collector := &collectingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "left":
+			return connectors.NewGenerator(schema, 100000, 30), nil
+		case "right":
+			return connectors.NewGenerator(schema, 100000, 70), nil
+		case "join":
+			return join, nil
+		default:
+			return collector, nil
+		}
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.ReleaseAll()
+
+	if join.rows[0] != 30 || join.rows[1] != 70 {
+		t.Errorf("expected 30 rows on input 0 and 70 on input 1, got %v", join.rows)
+	}
+	if !join.ended[0] || !join.ended[1] {
+		t.Errorf("expected both inputs to end, got %v", join.ended)
+	}
+}
+
+// TestE2ERouteToNamedOperators verifies that Route sends matched rows to each
+// branch target and unmatched rows to the default operator.
+func TestE2ERouteToNamedOperators(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+		},
+	}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "route-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{RowsPerSecond: 100000, MaxRows: 100}}},
+			{Id: "route", Name: "route", OperatorType: pb.OperatorType_OPERATOR_TYPE_ROUTE,
+				Config: &pb.OperatorNode_Route{Route: &pb.RouteConfig{
+					Branches: []*pb.RouteBranch{
+						{ConditionSql: "id < 20", TargetOperator: "low"},
+						{ConditionSql: "id >= 80", TargetOperator: "high"},
+					},
+					DefaultOperator: "mid",
+				}}},
+			{Id: "low", Name: "low", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			{Id: "high", Name: "high", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			{Id: "mid", Name: "mid", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "route", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "route", ToOperator: "low", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "route", ToOperator: "high", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "route", ToOperator: "mid", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	sinks := map[string]*collectingSink{"low": {}, "high": {}, "mid": {}}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if sink, ok := sinks[node.Id]; ok {
+			return sink, nil
+		}
+		return NewOperator(node)
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"low": 20, "high": 20, "mid": 60}
+	for id, sink := range sinks {
+		if total := sink.TotalRows(); total != want[id] {
+			t.Errorf("%s: expected %d rows, got %d", id, want[id], total)
+		}
+		sink.ReleaseAll()
+	}
+}
+
+// TestE2EValidatorRejectsRouteTargetWithoutEdge verifies that route targets must be downstream edges.
+func TestE2EValidatorRejectsRouteTargetWithoutEdge(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "route-validate-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "route", Name: "route", OperatorType: pb.OperatorType_OPERATOR_TYPE_ROUTE,
+				Config: &pb.OperatorNode_Route{Route: &pb.RouteConfig{
+					Branches: []*pb.RouteBranch{{ConditionSql: "id > 1", TargetOperator: "elsewhere"}},
+				}}},
+			{Id: "sink", Name: "sink", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			{Id: "elsewhere", Name: "elsewhere", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "route", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "not a downstream edge") {
+		t.Errorf("expected route target error, got: %v", err)
+	}
+}
+
+// TestE2EValidatorRejectsRouteDefaultAsBranchTarget verifies that the default
+// operator of a route cannot also be a branch target.
+func TestE2EValidatorRejectsRouteDefaultAsBranchTarget(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "route-validate-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "route", Name: "route", OperatorType: pb.OperatorType_OPERATOR_TYPE_ROUTE,
+				Config: &pb.OperatorNode_Route{Route: &pb.RouteConfig{
+					Branches:        []*pb.RouteBranch{{ConditionSql: "id > 1", TargetOperator: "sink"}},
+					DefaultOperator: "sink",
+				}}},
+			{Id: "sink", Name: "sink", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "route", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "also a branch target") {
+		t.Errorf("expected default operator error, got: %v", err)
+	}
+}
+
+func TestParseWatermark(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{expr: "", want: 0},
+		{expr: "ts", want: 0},
+		{expr: "ts - INTERVAL '5' SECOND", want: 5 * time.Second},
+		{expr: "ts - interval '250' millisecond", want: 250 * time.Millisecond},
+		{expr: "TS - INTERVAL '1.5' MINUTES", want: 90 * time.Second},
+		{expr: "other - INTERVAL '5' SECOND", wantErr: true},
+		{expr: "ts - INTERVAL '5' FORTNIGHT", wantErr: true},
+		{expr: "ts + INTERVAL '5' SECOND", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWatermark(&pb.WatermarkConfig{Column: "ts", Expression: tt.expr})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error, got %s", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+		} else if got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+}
+
+// TestInputReaderWatermarkIsMinimum verifies that the combined watermark only
+// advances once every sender of every open input has passed it.
+func TestInputReaderWatermarkIsMinimum(t *testing.T) {
+	a := make(chan element, 8)
+	b := make(chan element, 8)
+	reader := newInputReader([]chan element{a, b}, []int{2, 1}, false)
+
+	wm := func(ts int64, sender int) element {
+		return element{kind: watermarkElement, watermark: operator.Watermark{Timestamp: ts}, sender: sender}
+	}
+	a <- wm(10, 0)
+	a <- wm(20, 1)
+	b <- wm(15, 0)
+
+	_, el, ok := reader.next()
+	if !ok || el.kind != watermarkElement || el.watermark.Timestamp != 10 {
+		t.Fatalf("expected watermark 10, got kind %d at %d", el.kind, el.watermark.Timestamp)
+	}
+
+	// Sender 0 of input a catches up; input b now holds the watermark at 15.
+	a <- wm(30, 0)
+	_, el, _ = reader.next()
+	if el.kind != watermarkElement || el.watermark.Timestamp != 15 {
+		t.Fatalf("expected watermark 15, got kind %d at %d", el.kind, el.watermark.Timestamp)
+	}
+
+	// Once input b ends it no longer holds the watermark back.
+	close(b)
+	input, el, _ := reader.next()
+	if el.kind != endElement || input != 1 {
+		t.Fatalf("expected end of input 1, got kind %d on input %d", el.kind, input)
+	}
+	_, el, _ = reader.next()
+	if el.kind != watermarkElement || el.watermark.Timestamp != 20 {
+		t.Fatalf("expected watermark 20, got kind %d at %d", el.kind, el.watermark.Timestamp)
+	}
+}
+
+// TestE2EWatermarksReleaseBufferedOutput runs two generator instances with a
+// watermark on id into a buffering operator that only emits on watermarks.
+func TestE2EWatermarksReleaseBufferedOutput(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields:    []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}},
+		Watermark: &pb.WatermarkConfig{Column: "id", Expression: "id - INTERVAL '10' MILLISECOND"},
+	}
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "watermark-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, Parallelism: 2,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{
+					Schema: schema, RowsPerSecond: 100000, MaxRows: 100,
+				}}},
+			{Id: "buffer", Name: "buffer", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP, Parallelism: 1},
+			{Id: "filter", Name: "filter", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER, Parallelism: 1,
+				Config: &pb.OperatorNode_Filter{Filter: &pb.FilterConfig{ConditionSql: "id >= 0"}}},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 1},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "buffer", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "buffer", ToOperator: "filter", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "filter", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	buffer := &watermarkBufferOperator{}
+	collector := &collectingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "buffer":
+			return buffer, nil
+		case "sink":
+			return collector, nil
+		default:
+			return NewOperator(node)
+		}
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.ReleaseAll()
+
+	// Instance 0 emits even ids up to 98 and instance 1 odd ids up to 99. Once
+	// one finishes, the other alone sets the watermark, so the final watermark
+	// is 98 - 10 or 99 - 10 depending on which finishes last.
+	if n := len(buffer.watermarks); n == 0 || (buffer.watermarks[n-1] != 88 && buffer.watermarks[n-1] != 89) {
+		t.Fatalf("expected final watermark 88 or 89, got %v", buffer.watermarks)
+	}
+	for i := 1; i < len(buffer.watermarks); i++ {
+		if buffer.watermarks[i] <= buffer.watermarks[i-1] {
+			t.Fatalf("watermarks not increasing: %v", buffer.watermarks)
+		}
+	}
+	if total := collector.TotalRows(); total != 100 {
+		t.Errorf("expected 100 rows released by watermarks, got %d", total)
+	}
+}
+
+// TestE2EValidatorRejectsBadWatermark verifies that source watermarks are checked up front.
+func TestE2EValidatorRejectsBadWatermark(t *testing.T) {
+	schema := &pb.Schema{
+		Fields:    []*pb.SchemaField{{Name: "ts", ArrowType: pb.ArrowType_ARROW_TYPE_TIMESTAMP_MS}},
+		Watermark: &pb.WatermarkConfig{Column: "event_time", Expression: "event_time - INTERVAL '5' SECOND"},
+	}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "watermark-validate-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "not in the schema") {
+		t.Errorf("expected watermark column error, got: %v", err)
+	}
+}
+
+// TestInputReaderAlignsBarriers verifies that in exactly-once mode elements
+// behind a barrier wait until every input has delivered it.
+func TestInputReaderAlignsBarriers(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	a := make(chan element, 8)
+	b := make(chan element, 8)
+	reader := newInputReader([]chan element{a, b}, []int{1, 1}, true)
+
+	early := makeInt64Batch(alloc, "id", []int64{1})
+	late := makeInt64Batch(alloc, "id", []int64{2})
+	other := makeInt64Batch(alloc, "id", []int64{3})
+	a <- element{kind: barrierElement, checkpoint: 1}
+	a <- element{kind: batchElement, batch: early}
+	a <- element{kind: batchElement, batch: late}
+	b <- element{kind: batchElement, batch: other}
+
+	// Only input b's batch may pass until its barrier arrives.
+	input, el, _ := reader.next()
+	if el.kind != batchElement || input != 1 {
+		t.Fatalf("expected batch from input 1, got kind %d from input %d", el.kind, input)
+	}
+	el.batch.Release()
+
+	b <- element{kind: barrierElement, checkpoint: 1}
+	_, el, _ = reader.next()
+	if el.kind != barrierElement || el.checkpoint != 1 {
+		t.Fatalf("expected barrier 1, got kind %d", el.kind)
+	}
+
+	// The held batches follow the barrier in their original order.
+	for _, want := range []int64{1, 2} {
+		input, el, _ = reader.next()
+		if el.kind != batchElement || input != 0 {
+			t.Fatalf("expected batch from input 0, got kind %d from input %d", el.kind, input)
+		}
+		if got := el.batch.Column(0).(*array.Int64).Value(0); got != want {
+			t.Errorf("expected id %d, got %d", want, got)
+		}
+		el.batch.Release()
+	}
+}
+
+// TestInputReaderAtLeastOnceDoesNotAlign verifies that without alignment
+// elements behind a barrier are processed straight away.
+func TestInputReaderAtLeastOnceDoesNotAlign(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	a := make(chan element, 8)
+	b := make(chan element, 8)
+	reader := newInputReader([]chan element{a, b}, []int{1, 1}, false)
+
+	a <- element{kind: barrierElement, checkpoint: 1}
+	a <- element{kind: batchElement, batch: makeInt64Batch(alloc, "id", []int64{1})}
+
+	input, el, _ := reader.next()
+	if el.kind != batchElement || input != 0 {
+		t.Fatalf("expected batch from input 0, got kind %d from input %d", el.kind, input)
+	}
+	el.batch.Release()
+
+	// A finished sender counts as aligned.
+	b <- element{kind: endElement}
+	_, el, _ = reader.next()
+	if el.kind != barrierElement || el.checkpoint != 1 {
+		t.Fatalf("expected barrier 1, got kind %d", el.kind)
+	}
+}
+
+// TestE2ECheckpointSnapshotsAreConsistent runs a checkpointed pipeline and
+// checks that the latest completed checkpoint records a source position and
+// operator state that agree.
+func TestE2ECheckpointSnapshotsAreConsistent(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "checkpoint-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "20ms", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "count", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "count", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "count", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	counter := &rowCountingOperator{}
+	sink := &countingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			// About 100 rows every 10ms for 300ms.
+			return connectors.NewGenerator(schema, 10000, 3000), nil
+		case "count":
+			return counter, nil
+		default:
+			return sink, nil
+		}
+	}
+
+	dir := t.TempDir()
+	eng := NewEngine(plan, alloc, factory)
+	eng.SetCheckpointDir(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Checkpoints) == 0 {
+		t.Fatalf("expected completed checkpoints, operator saw %d barriers", counter.snapshots)
+	}
+	if len(manifest.Checkpoints) > defaultRetainedCheckpoints {
+		t.Errorf("expected at most %d retained checkpoints, got %d", defaultRetainedCheckpoints, len(manifest.Checkpoints))
+	}
+	latest := manifest.Checkpoints[len(manifest.Checkpoints)-1]
+	if manifest.Pipeline != "checkpoint-test" || latest.Mode != "exactly-once" {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	position, err := os.ReadFile(filepath.Join(dir, latest.Path, "src-0", "position"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pos struct{ Emitted int64 }
+	if err := json.Unmarshal(position, &pos); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := os.ReadFile(filepath.Join(dir, latest.Path, "count-0", "rows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rows) != strconv.FormatInt(pos.Emitted, 10) {
+		t.Errorf("operator snapshot has %s rows but source position is %d", rows, pos.Emitted)
+	}
+}
+
+// TestE2EValidatorRejectsBadCheckpointMode verifies the checkpoint config is checked up front.
+func TestE2EValidatorRejectsBadCheckpointMode(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "checkpoint-validate-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "10s", Mode: "exactly-twice"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "unknown mode") {
+		t.Errorf("expected checkpoint mode error, got: %v", err)
+	}
+}
+
+// TestE2ERestoreFromLatestCheckpoint kills a pipeline part way through and
+// verifies that a restarted engine resumes from its latest checkpoint with the
+// source position and operator state it recorded, producing the same output as
+// an uninterrupted run.
+func TestE2ERestoreFromLatestCheckpoint(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "restore-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "20ms", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "count", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "count", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "count", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	dir := t.TempDir()
+	sink := &seenSink{seen: make(map[int64][]int64)}
+	run := func(ctx context.Context) error {
+		factory := func(node *pb.OperatorNode) (interface{}, error) {
+			switch node.Id {
+			case "src":
+				return connectors.NewGenerator(schema, 10000, totalRows), nil
+			case "count":
+				return &runningCountOperator{}, nil
+			default:
+				return sink, nil
+			}
+		}
+		eng := NewEngine(plan, alloc, factory)
+		eng.SetCheckpointDir(dir)
+		return eng.Run(ctx)
+	}
+
+	// First run: kill the pipeline once a checkpoint has completed.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	sink.afterRows = totalRows / 3
+	sink.onRows = func() {
+		if latest, err := latestCheckpoint(dir); err == nil && latest != "" {
+			cancel()
+		}
+	}
+	if err := run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if len(sink.seen) == 0 || len(sink.seen) >= totalRows {
+		t.Fatalf("expected the first run to stop part way, it wrote %d ids", len(sink.seen))
+	}
+
+	// Second run: resume from the latest checkpoint and run to completion.
+	sink.onRows = nil
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.seen) != totalRows {
+		t.Fatalf("expected %d distinct ids across both runs, got %d", totalRows, len(sink.seen))
+	}
+	for id := int64(0); id < totalRows; id++ {
+		values, ok := sink.seen[id]
+		if !ok {
+			t.Fatalf("id %d was never written", id)
+		}
+		// Rows after the checkpoint are replayed, but must carry the same state.
+		for _, v := range values {
+			if v != id+1 {
+				t.Fatalf("id %d written with seen=%d, want %d", id, v, id+1)
+			}
+		}
+	}
+}
+
+// TestE2EKeyedStateRestore resumes an operator keeping its counts in Pebble
+// keyed state from the latest checkpoint.
+func TestE2EKeyedStateRestore(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := savepointPlan("count")
+	plan.PipelineName = "keyed-state-test"
+	plan.State = &pb.StateConfig{Backend: "pebble"}
+
+	checkpointDir, stateDir := t.TempDir(), t.TempDir()
+	sink := &seenSink{seen: make(map[int64][]int64), afterRows: totalRows / 3}
+	newEngine := func() *Engine {
+		factory := func(node *pb.OperatorNode) (interface{}, error) {
+			switch node.Id {
+			case "src":
+				return connectors.NewGenerator(schema, 10000, totalRows), nil
+			case "count":
+				return &keyedCountOperator{}, nil
+			default:
+				return sink, nil
+			}
+		}
+		eng := NewEngine(plan, alloc, factory)
+		eng.SetCheckpointDir(checkpointDir)
+		eng.SetRetainedCheckpoints(2)
+		eng.SetStateDir(stateDir)
+		return eng
+	}
+
+	// First run: once rows arrive, take a checkpoint that drains the sources,
+	// and kill the pipeline while they wait for it to resume.
+	ready := make(chan struct{})
+	var once sync.Once
+	sink.onRows = func() { once.Do(func() { close(ready) }) }
+	eng := newEngine()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var checkpointErr error
+	go func() {
+		defer cancel()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return
+		}
+		eng.stateMu.Lock()
+		checkpoints := eng.checkpoints
+		eng.stateMu.Unlock()
+		req := &checkpointRequest{drain: true, done: make(chan error, 1)}
+		if _, checkpointErr = checkpoints.start(req); checkpointErr == nil {
+			checkpointErr = <-req.done
+		}
+	}()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if checkpointErr != nil {
+		t.Fatal(checkpointErr)
+	}
+	latest, err := latestCheckpoint(checkpointDir)
+	if err != nil || latest == "" {
+		t.Fatalf("expected a completed checkpoint, got %q: %v", latest, err)
+	}
+	if _, err := os.Stat(filepath.Join(latest, "count-0", "state", "pebble")); err != nil {
+		t.Fatalf("expected the checkpoint to hold a Pebble snapshot of the counts: %v", err)
+	}
+	if len(sink.seen) == 0 || len(sink.seen) >= totalRows {
+		t.Fatalf("expected the first run to stop part way, it wrote %d ids", len(sink.seen))
+	}
+
+	// Second run: resume from the latest checkpoint and run to completion.
+	sink.onRows = nil
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := newEngine().Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.seen) != totalRows {
+		t.Fatalf("expected %d distinct ids across both runs, got %d", totalRows, len(sink.seen))
+	}
+	for id, values := range sink.seen {
+		for _, v := range values {
+			if v != id/10+1 {
+				t.Fatalf("id %d written with count=%d, want %d", id, v, id/10+1)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("expected the state working directory to be cleaned up, found %d entries", len(entries))
+	}
+
+	// Checkpoints snapshot the state incrementally: their SSTs live in the
+	// shared directory, where the manifest references them.
+	manifest, err := readManifest(checkpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Checkpoints) == 0 || len(manifest.Checkpoints) > 2 {
+		t.Fatalf("expected at most 2 retained checkpoints, got %d", len(manifest.Checkpoints))
+	}
+	if latest := manifest.Checkpoints[len(manifest.Checkpoints)-1]; len(latest.Shared) == 0 {
+		t.Errorf("expected the latest checkpoint to reference shared state files")
+	}
+	for _, cp := range manifest.Checkpoints {
+		for _, path := range cp.Shared {
+			if _, err := os.Stat(filepath.Join(checkpointDir, path)); err != nil {
+				t.Errorf("checkpoint %d references a missing shared file: %v", cp.ID, err)
+			}
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(checkpointDir, "chk-*", "*", "state", "pebble", "*.sst")); len(matches) != 0 {
+		t.Errorf("expected no SSTs copied into checkpoints, got %v", matches)
+	}
+}
+
+// TestRestoredPositionsCoverEveryInstance checks that a partitioned source
+// is given the positions of all its instances, in instance order.
+func TestRestoredPositionsCoverEveryInstance(t *testing.T) {
+	dir := t.TempDir()
+	for name, position := range map[string]string{"src-0": "a", "src-2": "c", "src-10": "k", "src-extra-0": "x"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, positionFile), []byte(position), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An instance that never recorded a position.
+	if err := os.MkdirAll(filepath.Join(dir, "src-1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Engine{restoreDir: dir}
+	positions, err := e.restoredPositions("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range positions {
+		got = append(got, string(p))
+	}
+	if want := []string{"a", "c", "k"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected positions %v, got %v", want, got)
+	}
+}
+
+func TestCheckpointSweepRemovesUnreferencedSharedFiles(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, sharedStateDir)
+	if err := os.MkdirAll(shared, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.sst", "b.sst", "expired.sst", "orphan.sst"} {
+		if err := os.WriteFile(filepath.Join(shared, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"chk-1", "chk-2", "chk-3"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &checkpointCoordinator{dir: dir, logger: slog.Default()}
+	c.sweep(&checkpointManifest{Checkpoints: []checkpointRecord{
+		{ID: 2, Path: "chk-2", Shared: []string{"shared/a.sst", "shared/b.sst"}},
+		{ID: 3, Path: "chk-3", Shared: []string{"shared/a.sst"}},
+	}})
+
+	entries, err := os.ReadDir(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"a.sst", "b.sst"}) {
+		t.Errorf("expected only referenced shared files to remain, got %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chk-1")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestE2EStateTTL(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := savepointPlan("ttl-count")
+	plan.PipelineName = "state-ttl-test"
+	plan.Checkpoint = nil
+	plan.State = &pb.StateConfig{Ttl: "1h"}
+	// The join's own TTL overrides the plan's. Batches arrive ~100ms apart, so
+	// counts never outlive one.
+	plan.Operators[1].Config = &pb.OperatorNode_HashJoin{HashJoin: &pb.HashJoinConfig{StateTtl: "1ms"}}
+
+	sink := &seenSink{seen: make(map[int64][]int64)}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 10000, totalRows), nil
+		case "ttl-count":
+			return &keyedCountOperator{}, nil
+		default:
+			return sink, nil
+		}
+	}
+	labels := map[string]string{"operator_id": "ttl-count"}
+	start := metricValue(t, "isotope_state_expired_entries_total", labels)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := NewEngine(plan, alloc, factory).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A count starts over when its key has no state: the first row of each of
+	// the 10 keys, and every row that found its count expired.
+	var fresh float64
+	for _, values := range sink.seen {
+		for _, v := range values {
+			if v == 1 {
+				fresh++
+			}
+		}
+	}
+	expired := metricValue(t, "isotope_state_expired_entries_total", labels) - start
+	if expired == 0 {
+		t.Fatal("expected state to expire between batches")
+	}
+	if fresh != 10+expired {
+		t.Errorf("expected %v rows to restart their count, got %v", 10+expired, fresh)
+	}
+
+	plan.State.Ttl = "soon"
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "soon") {
+		t.Errorf("expected an invalid state ttl to be rejected, got %v", err)
+	}
+	plan.State.Ttl = ""
+	plan.Operators[1].GetHashJoin().StateTtl = "10us"
+	if err := ValidatePlan(plan); err == nil || !strings.Contains(err.Error(), "ttl-count") {
+		t.Errorf("expected a sub-millisecond join state ttl to be rejected, got %v", err)
+	}
+}
+
+// restartPlan returns a generator -> op -> sink plan with the given restart strategy.
+func restartPlan(name string, restart *pb.RestartConfig) *pb.ExecutionPlan {
+	return &pb.ExecutionPlan{
+		PipelineName: name,
+		Restart:      restart,
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "op", Name: "flaky", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "op", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "op", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+}
+
+// TestE2EFixedDelayRestartRecovers verifies a failing operator tears the
+// pipeline down and that it is restarted until it runs to completion.
+func TestE2EFixedDelayRestartRecovers(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := restartPlan("restart-test", &pb.RestartConfig{Type: "fixed-delay", Attempts: 3, Delay: "10ms"})
+
+	var failures atomic.Int32
+	failures.Store(2)
+	sink := &countingSink{column: "id", target: math.MaxInt64}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 100000, 500), nil
+		case "op":
+			return &failingOpenOperator{failures: &failures}, nil
+		default:
+			return sink, nil
+		}
+	}
+
+	before := restartCount(t, "restart-test", "op", "open")
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := eng.Run(ctx); err != nil {
+		t.Fatalf("expected the pipeline to recover, got: %v", err)
+	}
+	if sink.count != 500 {
+		t.Errorf("expected 500 rows after recovery, got %d", sink.count)
+	}
+	if got := restartCount(t, "restart-test", "op", "open") - before; got != 2 {
+		t.Errorf("expected 2 restarts to be counted, got %v", got)
+	}
+}
+
+// TestE2ERestartAttemptsExhausted verifies Run returns the operator failure
+// once the restart strategy gives up.
+func TestE2ERestartAttemptsExhausted(t *testing.T) {
+	for _, restart := range []*pb.RestartConfig{
+		nil,
+		{Type: "no-restart"},
+		{Type: "fixed-delay", Attempts: 1, Delay: "1ms"},
+		{Type: "failure-rate", Attempts: 2, Delay: "1ms"},
+	} {
+		t.Run(restart.GetType(), func(t *testing.T) {
+			alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer alloc.AssertSize(t, 0)
+
+			schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+			var failures atomic.Int32
+			failures.Store(math.MaxInt32)
+			opens := 0
+			factory := func(node *pb.OperatorNode) (interface{}, error) {
+				switch node.Id {
+				case "src":
+					return connectors.NewGenerator(schema, 100000, 0), nil
+				case "op":
+					opens++
+					return &failingOpenOperator{failures: &failures}, nil
+				default:
+					return &countingSink{column: "id", target: math.MaxInt64}, nil
+				}
+			}
+
+			eng := NewEngine(restartPlan("restart-exhausted-test", restart), alloc, factory)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			err := eng.Run(ctx)
+			if err == nil || !strings.Contains(err.Error(), "injected open failure") {
+				t.Fatalf("expected the operator failure, got: %v", err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("Run only returned after the timeout")
+			}
+			wantRuns := 1 + int(restart.GetAttempts())
+			if opens != wantRuns {
+				t.Errorf("expected %d runs, got %d", wantRuns, opens)
+			}
+		})
+	}
+}
+
+// TestFailureRateRestart verifies failures outside the interval are forgotten.
+func TestFailureRateRestart(t *testing.T) {
+	s := &failureRateRestart{maxFailures: 2, interval: time.Minute, delay: time.Second}
+	start := time.Unix(0, 0)
+
+	for i, tc := range []struct {
+		at   time.Duration
+		want bool
+	}{
+		{0, true},
+		{10 * time.Second, true},
+		{20 * time.Second, false}, // third failure within a minute
+		{90 * time.Second, true},  // the earlier failures have all expired
+		{100 * time.Second, true},
+		{110 * time.Second, false},
+	} {
+		delay, ok := s.next(start.Add(tc.at))
+		if ok != tc.want {
+			t.Errorf("failure %d at %s: expected restart=%v, got %v", i, tc.at, tc.want, ok)
+		}
+		if ok && delay != time.Second {
+			t.Errorf("failure %d: expected 1s delay, got %s", i, delay)
+		}
+	}
+}
+
+// TestE2EValidatorRejectsBadRestart verifies the restart strategy is checked up front.
+func TestE2EValidatorRejectsBadRestart(t *testing.T) {
+	plan := restartPlan("restart-validate-test", &pb.RestartConfig{Type: "exponential-backoff"})
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("expected restart type error, got: %v", err)
+	}
+}
+
+// TestE2EOperatorErrorIsReturned verifies a processing error cancels the whole
+// DAG, including an unbounded source, and is returned from Run.
+func TestE2EOperatorErrorIsReturned(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 100000, 0), nil
+		case "op":
+			return &failingBatchOperator{every: 1000}, nil
+		default:
+			return &countingSink{column: "id", target: math.MaxInt64}, nil
+		}
+	}
+
+	eng := NewEngine(restartPlan("error-test", nil), alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := eng.Run(ctx)
+	var opErr *OperatorError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an OperatorError, got: %v", err)
+	}
+	if opErr.OperatorID != "op" || opErr.Phase != PhaseProcess || !errors.Is(err, errInjected) {
+		t.Errorf("unexpected error: %+v", opErr)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Run only returned after the timeout")
+	}
+}
+
+// TestE2EPartitionErrorIsReturned verifies a batch that cannot be
+// partitioned fails the sending operator under the default error policy.
+func TestE2EPartitionErrorIsReturned(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "partition-error-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "sink", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 2},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, PartitionKeys: []string{"missing"}},
+		},
+	}
+	sink := &countingSink{column: "id", target: math.MaxInt64}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.Id == "src" {
+			return connectors.NewGenerator(schema, 100000, 0), nil
+		}
+		return sink, nil
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := eng.Run(ctx)
+	var opErr *OperatorError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an OperatorError, got: %v", err)
+	}
+	if opErr.OperatorID != "src" || opErr.Phase != PhaseProcess || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Run only returned after the timeout")
+	}
+	if sink.count != 0 {
+		t.Errorf("expected no rows at the sink, got %d", sink.count)
+	}
+}
+
+// TestE2EErrorPolicies verifies the skip and log policies keep the pipeline
+// running, dropping or keeping the failed batches respectively.
+func TestE2EErrorPolicies(t *testing.T) {
+	for _, policy := range []ErrorPolicy{ErrorPolicySkip, ErrorPolicyLog} {
+		t.Run(string(policy), func(t *testing.T) {
+			alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer alloc.AssertSize(t, 0)
+
+			schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+			op := &failingBatchOperator{every: 2}
+			sink := &countingSink{column: "id", target: math.MaxInt64}
+			factory := func(node *pb.OperatorNode) (interface{}, error) {
+				switch node.Id {
+				case "src":
+					return connectors.NewGenerator(schema, 100000, 500), nil
+				case "op":
+					return op, nil
+				default:
+					return sink, nil
+				}
+			}
+
+			eng := NewEngine(restartPlan("error-policy-test", nil), alloc, factory)
+			eng.SetOperatorErrorPolicy("op", policy)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := eng.Run(ctx); err != nil {
+				t.Fatalf("expected the pipeline to carry on, got: %v", err)
+			}
+			if op.failedRows == 0 {
+				t.Fatal("expected some batches to fail")
+			}
+			want := int64(500)
+			if policy == ErrorPolicySkip {
+				want -= op.failedRows
+			}
+			if sink.count != want {
+				t.Errorf("expected %d rows at the sink, got %d", want, sink.count)
+			}
+		})
+	}
+}
+
+// TestE2EDeadLetterPolicy verifies every row of a failed batch reaches the
+// dead-letter queue with its operator, error and original values.
+func TestE2EDeadLetterPolicy(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	op := &failingBatchOperator{every: 2}
+	sink := &countingSink{column: "id", target: math.MaxInt64}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 100000, 500), nil
+		case "op":
+			return op, nil
+		default:
+			return sink, nil
+		}
+	}
+
+	dlq := &collectingDeadLetters{}
+	eng := NewEngine(restartPlan("dead-letter-test", nil), alloc, factory)
+	eng.SetDeadLetterQueue(dlq)
+	eng.SetOperatorErrorPolicy("op", ErrorPolicyDeadLetter)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	labels := map[string]string{"operator_id": "op"}
+	startErrors := metricValue(t, "isotope_errors_total", labels)
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Like the other policies, it counts a failed batch as one error.
+	if errs := metricValue(t, "isotope_errors_total", labels) - startErrors; errs != float64(op.failedBatches) {
+		t.Errorf("expected %d errors, one per failed batch, got %v", op.failedBatches, errs)
+	}
+	if op.failedRows == 0 || int64(len(dlq.letters)) != op.failedRows {
+		t.Fatalf("expected one dead letter per failed row (%d), got %d", op.failedRows, len(dlq.letters))
+	}
+	if sink.count != 500-op.failedRows {
+		t.Errorf("expected %d rows at the sink, got %d", 500-op.failedRows, sink.count)
+	}
+
+	seen := make(map[int64]bool)
+	for _, letter := range dlq.letters {
+		if letter.OperatorID != "op" || letter.Error != errInjected.Error() {
+			t.Fatalf("unexpected dead letter: %+v", letter)
+		}
+		var row struct{ ID *int64 }
+		if err := json.Unmarshal(letter.Payload, &row); err != nil || row.ID == nil {
+			t.Fatalf("payload %q is not the original row: %v", letter.Payload, err)
+		}
+		seen[*row.ID] = true
+	}
+	if int64(len(seen)) != op.failedRows {
+		t.Errorf("expected %d distinct rows in the dead letters, got %d", op.failedRows, len(seen))
+	}
+}
+
+// TestE2EBatchModeFlushesWithFinalWatermark verifies that in batch mode the end
+// of a bounded source releases what operators buffer until a watermark, and
+// that sinks are closed in topological order once the DAG has drained.
+func TestE2EBatchModeFlushesWithFinalWatermark(t *testing.T) {
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	newPlan := func(mode pb.PipelineMode) *pb.ExecutionPlan {
+		return &pb.ExecutionPlan{
+			PipelineName: "batch-test",
+			Mode:         mode,
+			Operators: []*pb.OperatorNode{
+				{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE,
+					Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{
+						Schema: schema, RowsPerSecond: 100000, MaxRows: 1000,
+					}}},
+				{Id: "buffer", Name: "buffer", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+				{Id: "late", Name: "late", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+				{Id: "early", Name: "early", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+			},
+			Edges: []*pb.Edge{
+				{FromOperator: "src", ToOperator: "buffer", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+				{FromOperator: "buffer", ToOperator: "late", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+				{FromOperator: "src", ToOperator: "early", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			},
+		}
+	}
+
+	run := func(mode pb.PipelineMode) (*watermarkBufferOperator, []string) {
+		alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+		defer alloc.AssertSize(t, 0)
+
+		var mu sync.Mutex
+		var closed []string
+		buffer := &watermarkBufferOperator{}
+		factory := func(node *pb.OperatorNode) (interface{}, error) {
+			switch node.Id {
+			case "src":
+				return connectors.NewGenerator(schema, 100000, 1000), nil
+			case "buffer":
+				return buffer, nil
+			default:
+				return &closeOrderSink{name: node.Id, mu: &mu, log: &closed}, nil
+			}
+		}
+
+		eng := NewEngine(newPlan(mode), alloc, factory)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := eng.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return buffer, closed
+	}
+
+	buffer, closed := run(pb.PipelineMode_PIPELINE_MODE_BATCH)
+	if len(buffer.watermarks) != 1 || buffer.watermarks[0] != math.MaxInt64 {
+		t.Errorf("expected a single final max watermark, got %v", buffer.watermarks)
+	}
+	if want := []string{"early:1000", "late:1000"}; !slices.Equal(closed, want) {
+		t.Errorf("expected sinks closed in topological order with all rows %v, got %v", want, closed)
+	}
+
+	// Without batch mode, event time never ends and the buffered rows are dropped.
+	buffer, closed = run(pb.PipelineMode_PIPELINE_MODE_STREAMING)
+	if len(buffer.watermarks) != 0 || !slices.Contains(closed, "late:0") {
+		t.Errorf("expected no watermark and no buffered output in streaming mode, got %v and %v",
+			buffer.watermarks, closed)
+	}
+}
+
+// TestE2EBatchModeMatchesSQL runs a bounded filter and projection in batch
+// mode across parallel instances and compares the output with the result of
+// the equivalent query:
+//
+//	SELECT id * 2 AS double_id, UPPER(name) AS upper_name
+//	FROM gen WHERE id >= 40 AND id < 160
+func TestE2EBatchModeMatchesSQL(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+			{Name: "name", ArrowType: pb.ArrowType_ARROW_TYPE_STRING},
+		},
+	}
+	plan := &pb.ExecutionPlan{
+		PipelineName:       "batch-sql-test",
+		Mode:               pb.PipelineMode_PIPELINE_MODE_BATCH,
+		DefaultParallelism: 2,
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, Parallelism: 1,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{
+					Schema: schema, RowsPerSecond: 100000, MaxRows: 500,
+				}}},
+			{Id: "filter", Name: "filter", OperatorType: pb.OperatorType_OPERATOR_TYPE_FILTER,
+				Config: &pb.OperatorNode_Filter{Filter: &pb.FilterConfig{ConditionSql: "id >= 40 AND id < 160"}}},
+			{Id: "project", Name: "project", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP,
+				Config: &pb.OperatorNode_Map{Map: &pb.MapConfig{Columns: map[string]string{
+					"double_id":  "id * 2",
+					"upper_name": "UPPER(name)",
+				}}}},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK, Parallelism: 1},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "filter", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "filter", ToOperator: "project", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "project", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+
+	sink := &collectingSink{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.Id == "sink" {
+			return sink, nil
+		}
+		return NewOperator(node)
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer sink.ReleaseAll()
+
+	var got []string
+	for _, batch := range sink.batches {
+		ids := batch.Column(batch.Schema().FieldIndices("double_id")[0]).(*array.Int64)
+		names := batch.Column(batch.Schema().FieldIndices("upper_name")[0]).(*array.String)
+		for i := 0; i < int(batch.NumRows()); i++ {
+			got = append(got, fmt.Sprintf("%d|%s", ids.Value(i), names.Value(i)))
+		}
+	}
+	var want []string
+	for id := 40; id < 160; id++ {
+		want = append(want, fmt.Sprintf("%d|NAME_%d", id*2, id))
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("output differs from the SQL result: got %d rows, want %d\ngot:  %v\nwant: %v",
+			len(got), len(want), truncate(strings.Join(got, ","), 200), truncate(strings.Join(want, ","), 200))
+	}
+}
+
+// TestE2EValidatorRejectsUnboundedBatchSource verifies batch mode needs bounded sources.
+func TestE2EValidatorRejectsUnboundedBatchSource(t *testing.T) {
+	plan := &pb.ExecutionPlan{
+		PipelineName: "batch-validate-test",
+		Mode:         pb.PipelineMode_PIPELINE_MODE_BATCH,
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE,
+				Config: &pb.OperatorNode_GeneratorSource{GeneratorSource: &pb.GeneratorSourceConfig{RowsPerSecond: 10}}},
+		},
+	}
+
+	err := ValidatePlan(plan)
+	if err == nil || !strings.Contains(err.Error(), "bounded sources") {
+		t.Errorf("expected bounded source error, got: %v", err)
+	}
+}
+
+// TestEdgeByteBudgetBlocksSender verifies a byte budget holds senders back
+// until the receiver catches up, and that in-flight metrics follow the queue.
+func TestEdgeByteBudgetBlocksSender(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	first := makeInt64Batch(alloc, "id", []int64{1, 2, 3})
+	second := makeInt64Batch(alloc, "id", []int64{4, 5, 6})
+	labels := map[string]string{"from_operator": "budget-src", "to_operator": "budget-sink"}
+	// The metrics are process-wide: compare against their values before the
+	// test so it holds when run repeatedly.
+	startRows := metricValue(t, "isotope_edge_rows_in_flight", labels)
+	startBlocked := metricValue(t, "isotope_edge_send_blocked_seconds", labels)
+	ec := newEdgeChannels(1, 1, EdgeBuffer{Batches: 16, Bytes: 1}, newEdgeMetrics("budget-src", "budget-sink"))
+
+	// An empty queue lets one batch through even if it exceeds the budget.
+	ec.deliver(0, element{kind: batchElement, batch: first})
+	if got := metricValue(t, "isotope_edge_rows_in_flight", labels) - startRows; got != 3 {
+		t.Errorf("expected 3 rows in flight, got %v", got)
+	}
+
+	delivered := make(chan struct{})
+	go func() {
+		ec.deliver(0, element{kind: batchElement, batch: second})
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		t.Fatal("second batch was delivered over budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	inputs := newInputReader(ec.chs, []int{1}, false)
+	for i := 0; i < 2; i++ {
+		_, el, ok := inputs.next()
+		if !ok || el.kind != batchElement {
+			t.Fatalf("expected batch %d, got %+v", i, el)
+		}
+		el.batch.Release()
+	}
+	<-delivered
+
+	if got := metricValue(t, "isotope_edge_queue_depth", labels); got != 0 {
+		t.Errorf("expected an empty queue, got depth %v", got)
+	}
+	// Only the second send waited.
+	if got := metricValue(t, "isotope_edge_send_blocked_seconds", labels) - startBlocked; got != 1 {
+		t.Errorf("expected 1 blocked send observed, got %v", got)
+	}
+}
+
+// TestE2EEdgeBufferSize verifies a per-edge buffer size applies and that a slow
+// consumer shows up as time blocked on send.
+func TestE2EEdgeBufferSize(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "edge-buffer-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "buffer-src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "buffer-sink", Name: "slow", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "buffer-src", ToOperator: "buffer-sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+
+	// The generator emits a 1024-row batch every ~10ms; the sink takes 20ms.
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.Id == "buffer-src" {
+			return connectors.NewGenerator(schema, 100000, 8*1024), nil
+		}
+		return &slowSink{delay: 20 * time.Millisecond}, nil
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	eng.SetEdgeBuffer(EdgeBuffer{Batches: 8})
+	eng.SetEdgeBufferFor("buffer-src", "buffer-sink", EdgeBuffer{Batches: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := eng.bufferFor("buffer-src", "buffer-sink").Batches; got != 1 {
+		t.Errorf("expected the per-edge buffer of 1, got %d", got)
+	}
+	if got := eng.bufferFor("buffer-src", "other").Batches; got != 8 {
+		t.Errorf("expected the plan-wide buffer of 8, got %d", got)
+	}
+	eng.SetEdgeBuffer(EdgeBuffer{Bytes: 1 << 20})
+	if got := eng.bufferFor("buffer-src", "other"); got.Batches != budgetedChannelBuffer {
+		t.Errorf("expected a byte-budgeted edge to get %d batches, got %d", budgetedChannelBuffer, got.Batches)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocked float64
+	for _, family := range families {
+		if family.GetName() != "isotope_edge_send_blocked_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "to_operator" && label.GetValue() == "buffer-sink" {
+					blocked = m.GetHistogram().GetSampleSum()
+				}
+			}
+		}
+	}
+	if blocked <= 0 {
+		t.Error("expected sends to block on the slow sink")
+	}
+}
+
+// TestE2EOperatorMetrics verifies sources, operators and sinks report their
+// batches, rows, latency and errors to Prometheus.
+func TestE2EOperatorMetrics(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	// 3000 rows arrive in batches starting at ids 0, 1024 and 2048; the
+	// first one fails.
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "metrics-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "metrics-src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "metrics-op", Name: "flaky", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "metrics-sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "metrics-src", ToOperator: "metrics-op", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "metrics-op", ToOperator: "metrics-sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "metrics-src":
+			return connectors.NewGenerator(schema, 100000, 3000), nil
+		case "metrics-op":
+			return &failingBatchOperator{every: 3}, nil
+		default:
+			return &countingSink{column: "id", target: math.MaxInt64}, nil
+		}
+	}
+
+	tests := []struct {
+		metric   string
+		operator string
+		want     float64
+	}{
+		{"isotope_batches_processed_total", "metrics-src", 3},
+		{"isotope_rows_processed_total", "metrics-src", 3000},
+		{"isotope_batches_processed_total", "metrics-op", 3},
+		{"isotope_rows_processed_total", "metrics-op", 3000},
+		{"isotope_batch_latency_seconds", "metrics-op", 3},
+		{"isotope_errors_total", "metrics-op", 1},
+		{"isotope_batches_processed_total", "metrics-sink", 2},
+		{"isotope_rows_processed_total", "metrics-sink", 1976},
+		{"isotope_batch_latency_seconds", "metrics-sink", 2},
+		{"isotope_errors_total", "metrics-sink", 0},
+	}
+	// The metrics are process-wide: compare against their values before the
+	// run so the test holds when run repeatedly.
+	start := make([]float64, len(tests))
+	for i, tc := range tests {
+		start[i] = metricValue(t, tc.metric, map[string]string{"operator_id": tc.operator})
+	}
+
+	eng := NewEngine(plan, alloc, factory)
+	eng.SetErrorPolicy(ErrorPolicySkip)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range tests {
+		if got := metricValue(t, tc.metric, map[string]string{"operator_id": tc.operator}) - start[i]; got != tc.want {
+			t.Errorf("%s{operator_id=%q} grew by %v, want %v", tc.metric, tc.operator, got, tc.want)
+		}
+	}
+}
+
+// TestE2ELatencyMetrics verifies the watermark lag of every operator and the
+// event-time lag of the rows a sink writes are reported.
+func TestE2ELatencyMetrics(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	// The generator stamps rows with the current time, so the watermark
+	// trails wall-clock time by about the 5s delay.
+	schema := &pb.Schema{
+		Fields: []*pb.SchemaField{
+			{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64},
+			{Name: "event_time", ArrowType: pb.ArrowType_ARROW_TYPE_TIMESTAMP_MS},
+		},
+		Watermark: &pb.WatermarkConfig{Column: "event_time", Expression: "event_time - INTERVAL '5' SECOND"},
+	}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "latency-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "lag-src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, OutputSchema: schema},
+			{Id: "lag-op", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "lag-sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "lag-src", ToOperator: "lag-op", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "lag-op", ToOperator: "lag-sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "lag-src":
+			return connectors.NewGenerator(schema, 100000, 500), nil
+		case "lag-op":
+			return &rowCountingOperator{}, nil
+		default:
+			return &countingSink{column: "id", target: math.MaxInt64}, nil
+		}
+	}
+
+	if got := eventTimeColumn(plan, "lag-sink"); got != "event_time" {
+		t.Fatalf("expected the sink's event time in %q, got %q", "event_time", got)
+	}
+
+	// The sink's histogram is process-wide: count the rows it observes from
+	// its value before the run so the test holds when run repeatedly.
+	sinkLag := map[string]string{"operator_id": "lag-sink"}
+	startRows := metricValue(t, "isotope_sink_event_time_lag_seconds", sinkLag)
+
+	eng := NewEngine(plan, alloc, factory)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"lag-src", "lag-op", "lag-sink"} {
+		lag := metricValue(t, "isotope_watermark_lag_seconds", map[string]string{"operator_id": id})
+		if lag < 4 || lag > 6 {
+			t.Errorf("expected %s to trail wall-clock time by about 5s, got %vs", id, lag)
+		}
+	}
+	if got := metricValue(t, "isotope_sink_event_time_lag_seconds", sinkLag) - startRows; got != 500 {
+		t.Errorf("expected the event-time lag of 500 rows, got %v", got)
+	}
+}
+
+// TestE2ETracing verifies every sampled source batch starts a trace with a
+// child span per operator, including those fused into a chain, and the sink.
+func TestE2ETracing(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	plan := &pb.ExecutionPlan{
+		PipelineName: "tracing-test",
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "first", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "second", Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "first", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+			{FromOperator: "first", ToOperator: "second", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: "second", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 100000, 3000), nil
+		case "first", "second":
+			return &rowCountingOperator{}, nil
+		default:
+			return &countingSink{column: "id", target: math.MaxInt64}, nil
+		}
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(context.Background())
+
+	eng := NewEngine(plan, alloc, factory)
+	eng.SetTracerProvider(tp)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	byID := make(map[trace.SpanID]sdktrace.ReadOnlySpan, len(spans))
+	for _, span := range spans {
+		byID[span.SpanContext().SpanID()] = span
+	}
+	rows := func(span sdktrace.ReadOnlySpan, key attribute.Key) int64 {
+		for _, kv := range span.Attributes() {
+			if kv.Key == key {
+				return kv.Value.AsInt64()
+			}
+		}
+		t.Fatalf("span %s has no %s", span.Name(), key)
+		return 0
+	}
+
+	// 3000 rows arrive in three batches, each traced from source to sink.
+	var sinkSpans int
+	for _, span := range spans {
+		if span.Name() != "sink" {
+			continue
+		}
+		sinkSpans++
+		path := []string{span.Name()}
+		for parent, ok := byID[span.Parent().SpanID()]; ok; parent, ok = byID[parent.Parent().SpanID()] {
+			path = append([]string{parent.Name()}, path...)
+			if parent.Name() != "src" && rows(parent, attrRowsIn) != rows(parent, attrRowsOut) {
+				t.Errorf("expected %s to pass every row through", parent.Name())
+			}
+		}
+		if want := []string{"src", "first", "second", "sink"}; !slices.Equal(path, want) {
+			t.Errorf("expected trace %v, got %v", want, path)
+		}
+	}
+	if sinkSpans != 3 {
+		t.Errorf("expected 3 traced batches at the sink, got %d", sinkSpans)
+	}
+}
+
+// savepointPlan returns a generator -> count -> sink plan whose counting
+// operator has the given ID.
+func savepointPlan(countID string) *pb.ExecutionPlan {
+	return &pb.ExecutionPlan{
+		PipelineName: "savepoint-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "1h", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gen", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: countID, Name: "count", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: countID, Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+			{FromOperator: countID, ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+}
+
+// TestE2ESavepointStateMapping takes a savepoint and resumes from it with the
+// same plan and with a plan whose stateful operator changed its ID.
+func TestE2ESavepointStateMapping(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	checkpointDir, savepointDir := t.TempDir(), t.TempDir()
+	newEngine := func(plan *pb.ExecutionPlan, sink *seenSink) *Engine {
+		factory := func(node *pb.OperatorNode) (interface{}, error) {
+			switch node.Id {
+			case "src":
+				return connectors.NewGenerator(schema, 2000, totalRows), nil
+			case "sink":
+				return sink, nil
+			default:
+				return &runningCountOperator{}, nil
+			}
+		}
+		eng := NewEngine(plan, alloc, factory)
+		eng.SetCheckpointDir(checkpointDir)
+		eng.SetSavepointDir(savepointDir)
+		return eng
+	}
+
+	// First run: take a savepoint part way, then stop.
+	sink := &seenSink{seen: make(map[int64][]int64), afterRows: totalRows / 4}
+	ready := make(chan struct{})
+	var once sync.Once
+	sink.onRows = func() { once.Do(func() { close(ready) }) }
+	eng := newEngine(savepointPlan("count"), sink)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var info *SavepointInfo
+	var savepointErr error
+	go func() {
+		defer eng.Stop()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return
+		}
+		info, savepointErr = eng.TriggerSavepoint(ctx, "v1")
+	}()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if savepointErr != nil {
+		t.Fatal(savepointErr)
+	}
+	if info == nil || info.Name != "v1" || info.Pipeline != "savepoint-test" || info.Path != filepath.Join(savepointDir, "v1") {
+		t.Fatalf("unexpected savepoint: %+v", info)
+	}
+	if _, err := eng.TriggerSavepoint(ctx, "../v1"); !errors.Is(err, ErrInvalidSavepoint) {
+		t.Errorf("expected an invalid savepoint name to be rejected, got %v", err)
+	}
+	if len(sink.seen) >= totalRows {
+		t.Fatalf("expected the first run to stop part way, it wrote %d ids", len(sink.seen))
+	}
+
+	// Resuming with the same plan carries the operator state over.
+	eng = newEngine(savepointPlan("count"), sink)
+	eng.SetRestoreFrom(info.Path)
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.seen) != totalRows {
+		t.Fatalf("expected %d distinct ids across both runs, got %d", totalRows, len(sink.seen))
+	}
+	for id, values := range sink.seen {
+		for _, v := range values {
+			if v != id+1 {
+				t.Fatalf("id %d written with seen=%d, want %d", id, v, id+1)
+			}
+		}
+	}
+
+	// The renamed operator leaves the state of "count" behind.
+	renamed := &seenSink{seen: make(map[int64][]int64)}
+	eng = newEngine(savepointPlan("recount"), renamed)
+	eng.SetRestoreFrom(info.Path)
+	if err := eng.Run(ctx); err == nil || !strings.Contains(err.Error(), "count") {
+		t.Fatalf("expected restoring removed state to fail, got %v", err)
+	}
+
+	eng = newEngine(savepointPlan("recount"), renamed)
+	eng.SetRestoreFrom(info.Path)
+	eng.SetStateMapping(StateMapping{AllowRemoved: true, RequireAll: true})
+	if err := eng.Run(ctx); err == nil || !strings.Contains(err.Error(), "no state for operator recount") {
+		t.Fatalf("expected restoring without state for recount to fail, got %v", err)
+	}
+
+	eng = newEngine(savepointPlan("recount"), renamed)
+	eng.SetRestoreFrom(info.Path)
+	eng.SetStateMapping(StateMapping{AllowRemoved: true})
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The source resumes from the savepoint, the new operator starts empty.
+	if len(renamed.seen) == 0 || len(renamed.seen) >= totalRows {
+		t.Fatalf("expected the source to resume part way, it wrote %d ids", len(renamed.seen))
+	}
+	first := int64(totalRows - len(renamed.seen))
+	if got := renamed.seen[first]; len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected id %d to be the first row counted, got seen=%v", first, got)
+	}
+}
+
+// TestSavepointRefusesParallelismChange checks that state snapshotted at one
+// parallelism is not restored at another, while an operator that left no state
+// behind or a partitioned source may change it freely.
+func TestSavepointRefusesParallelismChange(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"src-0", "src-1", "count-0", "count-1", "sink-0", "sink-1"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"src-0", "src-1"} {
+		if err := os.WriteFile(filepath.Join(dir, name, positionFile), []byte("0"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan := savepointPlan("count")
+	plan.Operators[0].Parallelism = 2
+	e := &Engine{plan: plan, restoreDir: dir, logger: slog.Default()}
+	if _, err := e.mapState(nil); err != nil {
+		t.Fatalf("expected the unchanged source and stateless operators to restore, got %v", err)
+	}
+
+	plan.Operators[0].Parallelism = 3
+	if _, err := e.mapState(nil); err == nil || !strings.Contains(err.Error(), "operator src at parallelism 2") {
+		t.Fatalf("expected restoring src at a new parallelism to fail, got %v", err)
+	}
+
+	// A partitioned source restores the positions of all instances into each.
+	partitioned := map[string][]*operatorInstance{"src": {{impl: &partitionedSource{}}}}
+	if _, err := e.mapState(partitioned); err != nil {
+		t.Fatalf("expected a partitioned source to restore at a new parallelism, got %v", err)
+	}
+}
+
+// TestE2EPlanSwap swaps in a plan with an extra operator part way through a
+// run: no row is lost or written twice, and the counting operator keeps its
+// state.
+func TestE2EPlanSwap(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const totalRows = 3000
+	schema := &pb.Schema{Fields: []*pb.SchemaField{{Name: "id", ArrowType: pb.ArrowType_ARROW_TYPE_INT64}}}
+	v1 := savepointPlan("count")
+	v1.PipelineName = "swap-test"
+	v2 := proto.Clone(v1).(*pb.ExecutionPlan)
+	v2.Operators[1].Name = "count-v2"
+	v2.Operators = append(v2.Operators, &pb.OperatorNode{Id: "extra", Name: "pass", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP})
+	v2.Edges[1].ToOperator = "extra"
+	v2.Edges = append(v2.Edges, &pb.Edge{FromOperator: "extra", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD})
+
+	sink := &seenSink{seen: make(map[int64][]int64), afterRows: totalRows / 4}
+	extra := &rowCountingOperator{}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		switch node.Id {
+		case "src":
+			return connectors.NewGenerator(schema, 2000, totalRows), nil
+		case "count":
+			return &runningCountOperator{}, nil
+		case "extra":
+			return extra, nil
+		default:
+			return sink, nil
+		}
+	}
+	eng := NewEngine(v1, alloc, factory)
+	eng.SetCheckpointDir(t.TempDir())
+
+	ready := make(chan struct{})
+	var once sync.Once
+	sink.onRows = func() { once.Do(func() { close(ready) }) }
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var diff *PlanDiff
+	swapped := make(chan error, 1)
+	go func() {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			swapped <- ctx.Err()
+			return
+		}
+		var err error
+		diff, err = eng.Swap(v2)
+		swapped <- err
+	}()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-swapped; err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(diff.Added, []string{"extra"}) || !slices.Equal(diff.Kept, []string{"src", "count", "sink"}) ||
+		len(diff.Removed) != 0 || len(diff.Reset) != 0 {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if eng.Plan() != v2 {
+		t.Error("expected the swapped plan to be running")
+	}
+	if extra.rows == 0 || extra.rows >= totalRows {
+		t.Errorf("expected the added operator to see the rows after the swap, it saw %d", extra.rows)
+	}
+	if len(sink.seen) != totalRows {
+		t.Fatalf("expected %d distinct ids, got %d", totalRows, len(sink.seen))
+	}
+	for id, values := range sink.seen {
+		if len(values) != 1 || values[0] != id+1 {
+			t.Fatalf("id %d written with seen=%v, want [%d]", id, values, id+1)
+		}
+	}
+}
+
+// TestCheckpointAfterAbortedCheckpoint starts a checkpoint right after
+// aborting one a source has yet to acknowledge: the source picks the new one
+// up once it acknowledges the old, and it completes.
+func TestCheckpointAfterAbortedCheckpoint(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	plan := &pb.ExecutionPlan{
+		PipelineName: "aborted-checkpoint-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "1h", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "gated", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_FORWARD},
+		},
+	}
+	src := &gatedSource{release: make(chan struct{})}
+	sink := &idSink{ids: make(map[int64]int), afterRows: 10}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.Id == "src" {
+			return src, nil
+		}
+		return sink, nil
+	}
+	eng := NewEngine(plan, alloc, factory)
+	eng.SetCheckpointDir(t.TempDir())
+
+	ready := make(chan struct{})
+	var once sync.Once
+	sink.onRows = func() { once.Do(func() { close(ready) }) }
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	checkpointed := make(chan error, 1)
+	go func() {
+		defer eng.Stop()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			checkpointed <- ctx.Err()
+			return
+		}
+		eng.stateMu.Lock()
+		checkpoints := eng.checkpoints
+		eng.stateMu.Unlock()
+
+		first := &checkpointRequest{done: make(chan error, 1)}
+		if _, err := checkpoints.start(first); err != nil {
+			checkpointed <- err
+			return
+		}
+		checkpoints.mu.Lock()
+		checkpoints.abort(errors.New("injected abort"))
+		checkpoints.mu.Unlock()
+		second := &checkpointRequest{done: make(chan error, 1)}
+		if _, err := checkpoints.start(second); err != nil {
+			checkpointed <- err
+			return
+		}
+		close(src.release)
+		select {
+		case err := <-second.done:
+			checkpointed <- err
+		case <-ctx.Done():
+			checkpointed <- fmt.Errorf("second checkpoint: %w", ctx.Err())
+		}
+	}()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-checkpointed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestE2EPlanSwapRescalesPartitionedSource swaps in a plan running a
+// partitioned source at a higher parallelism: the source keeps its positions,
+// so no row is lost or read twice.
+func TestE2EPlanSwapRescalesPartitionedSource(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	const partitions, rows = 6, 200
+	v1 := &pb.ExecutionPlan{
+		PipelineName: "rescale-test",
+		Checkpoint:   &pb.CheckpointConfig{Interval: "1h", Mode: "exactly-once"},
+		Operators: []*pb.OperatorNode{
+			{Id: "src", Name: "partitions", OperatorType: pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE, Parallelism: 2},
+			{Id: "sink", Name: "collect", OperatorType: pb.OperatorType_OPERATOR_TYPE_CONSOLE_SINK},
+		},
+		Edges: []*pb.Edge{
+			{FromOperator: "src", ToOperator: "sink", Shuffle: pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN},
+		},
+	}
+	v2 := proto.Clone(v1).(*pb.ExecutionPlan)
+	v2.Operators[0].Parallelism = 3
+
+	sink := &idSink{ids: make(map[int64]int), afterRows: partitions * rows / 4}
+	factory := func(node *pb.OperatorNode) (interface{}, error) {
+		if node.Id == "src" {
+			return &partitionedSource{partitions: partitions, rows: rows}, nil
+		}
+		return sink, nil
+	}
+	eng := NewEngine(v1, alloc, factory)
+	eng.SetCheckpointDir(t.TempDir())
+
+	ready := make(chan struct{})
+	var once sync.Once
+	sink.onRows = func() { once.Do(func() { close(ready) }) }
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var diff *PlanDiff
+	swapped := make(chan error, 1)
+	go func() {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			swapped <- ctx.Err()
+			return
+		}
+		var err error
+		diff, err = eng.Swap(v2)
+		swapped <- err
+	}()
+	if err := eng.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-swapped; err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(diff.Kept, []string{"src", "sink"}) || len(diff.Reset) != 0 {
+		t.Errorf("expected the partitioned source to be kept, got %+v", diff)
+	}
+	if eng.Plan() != v2 {
+		t.Error("expected the swapped plan to be running")
+	}
+	if len(sink.ids) != partitions*rows {
+		t.Fatalf("expected %d distinct ids, got %d", partitions*rows, len(sink.ids))
+	}
+	for id, n := range sink.ids {
+		if n != 1 {
+			t.Fatalf("id %d written %d times", id, n)
+		}
+	}
+}
+
+// TestDiffPlans verifies operators are matched by ID and reset when what
+// their state depends on changes.
+func TestDiffPlans(t *testing.T) {
+	old := savepointPlan("count")
+	old.Operators = append(old.Operators, &pb.OperatorNode{Id: "gone", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP})
+	new := savepointPlan("count")
+	new.Operators[0].Parallelism = 4
+	new.Operators[1].OperatorType = pb.OperatorType_OPERATOR_TYPE_FILTER
+	new.Operators[2].Name = "renamed"
+	new.Operators = append(new.Operators, &pb.OperatorNode{Id: "new", OperatorType: pb.OperatorType_OPERATOR_TYPE_MAP})
+
+	// State is restored by instance index, so a parallelism change resets it.
+	diff := DiffPlans(old, new)
+	want := &PlanDiff{Added: []string{"new"}, Removed: []string{"gone"}, Reset: []string{"src", "count"}, Kept: []string{"sink"}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("expected %+v, got %+v", want, diff)
+	}
+
+	if _, err := NewEngine(old, memory.DefaultAllocator, nil).Swap(&pb.ExecutionPlan{PipelineName: "savepoint-test"}); !errors.Is(err, ErrInvalidPlan) {
+		t.Errorf("expected an empty plan to be rejected, got %v", err)
+	}
+}
+
+// ── helpers ─────────────────────────────────────────────────────────
+
+// restartCount reads the restart counter for a pipeline, operator and reason
+// from the default Prometheus registry.
+func restartCount(t *testing.T, pipeline, operatorID, reason string) float64 {
+	t.Helper()
+	return metricValue(t, "isotope_restarts_total",
+		map[string]string{"pipeline": pipeline, "operator_id": operatorID, "reason": reason})
+}
+
+// metricValue reads a counter or gauge, or the sample count of a histogram,
+// with the given labels from the default Prometheus registry.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if want, ok := labels[label.GetName()]; ok && want != label.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+func makeInt64Batch(alloc memory.Allocator, name string, vals []int64) arrow.Record {
+	bldr := array.NewInt64Builder(alloc)
+	defer bldr.Release()
+	bldr.AppendValues(vals, nil)
+	arr := bldr.NewArray()
+	defer arr.Release()
+	schema := arrow.NewSchema([]arrow.Field{{Name: name, Type: arrow.PrimitiveTypes.Int64}}, nil)
+	return array.NewRecord(schema, []arrow.Array{arr}, int64(len(vals)))
 }
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// Phase is the stage of an operator's lifecycle in which an error occurred.
+type Phase string
+
+const (
+	PhaseOpen    Phase = "open"
+	PhaseRestore Phase = "restore"
+	PhaseProcess Phase = "process"
+	PhaseClose   Phase = "close"
+)
+
+// OperatorError reports an error of one operator instance. Run returns the
+// first fatal OperatorError of a pipeline.
+type OperatorError struct {
+	OperatorID string
+	Instance   int
+	Phase      Phase
+	Err        error
+}
+
+func (e *OperatorError) Error() string {
+	return fmt.Sprintf("operator %s[%d] %s: %v", e.OperatorID, e.Instance, e.Phase, e.Err)
+}
+
+func (e *OperatorError) Unwrap() error { return e.Err }
+
+// ErrorPolicy decides what happens when an operator fails to process a batch.
+// Errors while opening, restoring or closing an operator are always fatal.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyFail cancels the pipeline and makes Run return the error,
+	// subject to the restart strategy.
+	ErrorPolicyFail ErrorPolicy = "fail"
+	// ErrorPolicySkip drops the batch, along with anything the operator
+	// returned for it, and carries on.
+	ErrorPolicySkip ErrorPolicy = "skip"
+	// ErrorPolicyLog logs the error and carries on with whatever the operator
+	// returned for the batch.
+	ErrorPolicyLog ErrorPolicy = "log"
+	// ErrorPolicyDeadLetter sends every row of the batch to the dead-letter
+	// queue (see Engine.SetDeadLetterQueue) and otherwise acts like
+	// ErrorPolicySkip.
+	ErrorPolicyDeadLetter ErrorPolicy = "dead-letter"
+)
+
+// ParseErrorPolicy parses the name of an error policy.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case ErrorPolicyFail, ErrorPolicySkip, ErrorPolicyLog, ErrorPolicyDeadLetter:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown error policy %q, expected %q, %q, %q or %q",
+			s, ErrorPolicyFail, ErrorPolicySkip, ErrorPolicyLog, ErrorPolicyDeadLetter)
+	}
+}
+
+// SetErrorPolicy sets the policy for processing errors of operators without
+// one of their own. It defaults to ErrorPolicyFail.
+func (e *Engine) SetErrorPolicy(policy ErrorPolicy) {
+	e.defaultPolicy = policy
+}
+
+// SetOperatorErrorPolicy sets the policy for processing errors of one operator.
+func (e *Engine) SetOperatorErrorPolicy(operatorID string, policy ErrorPolicy) {
+	if e.policies == nil {
+		e.policies = make(map[string]ErrorPolicy)
+	}
+	e.policies[operatorID] = policy
+}
+
+func (e *Engine) errorPolicy(operatorID string) ErrorPolicy {
+	if p, ok := e.policies[operatorID]; ok {
+		return p
+	}
+	if e.defaultPolicy != "" {
+		return e.defaultPolicy
+	}
+	return ErrorPolicyFail
+}
+
+// fail records a fatal error of an operator instance and cancels the run.
+// Only the first error is kept; errors after cancellation are part of the
+// teardown.
+func (e *Engine) fail(ctx context.Context, inst *operatorInstance, phase Phase, err error) {
+	e.logger.Error("operator failed", "operator", inst.node.Id, "instance", inst.index, "phase", phase, "error", err)
+	inst.opCtx.Metrics.AddError()
+	inst.state.store(StateFailed)
+
+	e.failMu.Lock()
+	defer e.failMu.Unlock()
+	if e.failure != nil || ctx.Err() != nil {
+		return
+	}
+	e.failure = &OperatorError{OperatorID: inst.node.Id, Instance: inst.index, Phase: phase, Err: err}
+	e.cancelRun()
+}
+
+// processError applies the operator's error policy to an error processing a
+// batch, watermark or end of input, counts it, and returns the policy applied. input is
+// the batch being processed, if any, and outputs is what the operator returned
+// alongside the error; unless the policy is ErrorPolicyLog, they are released
+// and nil is returned in their place. The caller keeps ownership of input.
+func (e *Engine) processError(ctx context.Context, inst *operatorInstance, err error, input arrow.Record, outputs []arrow.Record) (ErrorPolicy, []arrow.Record) {
+	policy := e.errorPolicy(inst.node.Id)
+	switch policy {
+	case ErrorPolicyDeadLetter:
+		e.deadLetter(inst, input, err)
+		releaseAll(outputs)
+		return policy, nil
+	case ErrorPolicySkip:
+		inst.opCtx.Metrics.AddError()
+		e.logger.Debug("batch skipped", "operator", inst.node.Id, "instance", inst.index, "error", err)
+		releaseAll(outputs)
+		return policy, nil
+	case ErrorPolicyLog:
+		inst.opCtx.Metrics.AddError()
+		e.logger.Error("process batch failed", "operator", inst.node.Id, "instance", inst.index, "error", err)
+		return policy, outputs
+	default:
+		e.fail(ctx, inst, PhaseProcess, err)
+		releaseAll(outputs)
+		return policy, nil
+	}
+}
+
+// deadLetter sends every row of a batch the instance failed to process to the
+// dead-letter queue as JSON, counting one error for the batch. Without a
+// batch, e.g. for a failed watermark, the error alone is recorded.
+func (e *Engine) deadLetter(inst *operatorInstance, input arrow.Record, err error) {
+	if input == nil {
+		inst.opCtx.DeadLetter(nil, err)
+		return
+	}
+	var buf bytes.Buffer
+	if encErr := array.RecordToJSON(input, &buf); encErr != nil {
+		inst.opCtx.DeadLetter(nil, fmt.Errorf("%w (batch not encodable: %v)", err, encErr))
+		return
+	}
+	inst.opCtx.DeadLetterBatch(bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n")), err)
+}
+
+// closeOperator closes an operator instance, reporting an error as fatal.
+func (e *Engine) closeOperator(ctx context.Context, inst *operatorInstance, close func() error) {
+	if err := close(); err != nil {
+		e.fail(ctx, inst, PhaseClose, err)
+	}
+	if err := inst.opCtx.State.Close(); err != nil {
+		e.fail(ctx, inst, PhaseClose, fmt.Errorf("close keyed state: %w", err))
+	}
+}
+
+// drainInputs discards whatever still arrives on the instance's inputs, so
+// that upstream instances are not blocked on a failed instance while the DAG
+// shuts down.
+func drainInputs(inst *operatorInstance) {
+	inputs := newInputReader(inst.inputChs, inst.inputSenders, false)
+	for {
+		_, el, ok := inputs.next()
+		if !ok {
+			return
+		}
+		if el.kind == batchElement {
+			el.batch.Release()
+		}
+	}
+}
+
+func releaseAll(batches []arrow.Record) {
+	for _, b := range batches {
+		b.Release()
+	}
+}
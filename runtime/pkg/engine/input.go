@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// inputReader merges the input channels of an operator instance. Each call to
+// next picks uniformly at random among the inputs that have an element ready,
+// so a busy or never-ending input cannot starve the others.
+//
+// It also tracks the last watermark from every upstream instance of every
+// input and reports the minimum across them whenever it advances. A finished
+// sender no longer holds the watermark back.
+//
+// Checkpoint barriers are reported once every sender that has not finished has
+// delivered one. With align set, elements from a sender whose barrier has
+// arrived are held back until then, so the operator's snapshot covers exactly
+// the elements before the barrier (exactly-once). Without it, they are
+// processed straight away (at-least-once).
+type inputReader struct {
+	cases []reflect.SelectCase
+	open  int
+	align bool
+
+	marks     [][]int64 // last watermark per input and sender
+	ended     [][]bool  // finished senders per input
+	watermark int64     // last watermark reported by next
+
+	checkpoint int64    // barrier being aligned, 0 if none
+	arrived    [][]bool // senders whose barrier for checkpoint has arrived
+	waiting    int      // senders whose barrier has not arrived yet
+	completed  int64    // last barrier reported by next
+	ready      bool     // checkpoint is aligned but not yet reported
+
+	held   []inputElement // elements from aligned senders, in arrival order
+	replay []inputElement // held elements to process before reading channels
+}
+
+// inputClosed is the sender of the endElement inputReader records when an
+// input channel closes.
+const inputClosed = -1
+
+// inputElement is an element together with the input it arrived on.
+type inputElement struct {
+	input int
+	el    element
+}
+
+// newInputReader reads from chs, where senders[i] is the number of upstream
+// instances writing to chs[i]. align enables barrier alignment.
+func newInputReader(chs []chan element, senders []int, align bool) *inputReader {
+	r := &inputReader{
+		cases:     make([]reflect.SelectCase, len(chs)),
+		open:      len(chs),
+		align:     align,
+		marks:     make([][]int64, len(chs)),
+		ended:     make([][]bool, len(chs)),
+		arrived:   make([][]bool, len(chs)),
+		watermark: math.MinInt64,
+	}
+	for i, ch := range chs {
+		r.cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+		r.marks[i] = make([]int64, senders[i])
+		for j := range r.marks[i] {
+			r.marks[i][j] = math.MinInt64
+		}
+		r.ended[i] = make([]bool, senders[i])
+		r.arrived[i] = make([]bool, senders[i])
+	}
+	return r
+}
+
+// next blocks until a batch arrives, an input ends, a checkpoint barrier is
+// aligned, or the combined watermark advances. It returns the index of the
+// input and the element; an endElement means that input has ended. ok is
+// false once every input has ended.
+func (r *inputReader) next() (input int, el element, ok bool) {
+	for {
+		if r.ready {
+			r.ready = false
+			return 0, element{kind: barrierElement, checkpoint: r.completed}, true
+		}
+		// A sender that just finished may have been the one holding the watermark back.
+		if wm, advanced := r.advance(); advanced {
+			return 0, element{kind: watermarkElement, watermark: wm}, true
+		}
+
+		var in inputElement
+		switch {
+		case len(r.replay) > 0:
+			in, r.replay = r.replay[0], r.replay[1:]
+		case r.open > 0:
+			chosen, value, recvOK := reflect.Select(r.cases)
+			if !recvOK {
+				// A nil channel is never selected again.
+				r.cases[chosen].Chan = reflect.Value{}
+				r.open--
+				in = inputElement{input: chosen, el: element{kind: endElement, sender: inputClosed}}
+			} else {
+				in = inputElement{input: chosen, el: value.Interface().(element)}
+				if in.el.kind == batchElement {
+					in.el.received()
+				}
+			}
+		default:
+			return 0, element{}, false
+		}
+
+		if r.holds(in) {
+			r.held = append(r.held, in)
+			continue
+		}
+
+		switch in.el.kind {
+		case batchElement:
+			return in.input, in.el, true
+		case watermarkElement:
+			if in.el.watermark.Timestamp > r.marks[in.input][in.el.sender] {
+				r.marks[in.input][in.el.sender] = in.el.watermark.Timestamp
+			}
+		case barrierElement:
+			r.barrier(in.input, in.el.sender, in.el.checkpoint)
+		case endElement:
+			if in.el.sender != inputClosed {
+				r.finish(in.input, in.el.sender)
+				continue
+			}
+			for sender := range r.ended[in.input] {
+				r.finish(in.input, sender)
+			}
+			return in.input, in.el, true
+		}
+	}
+}
+
+// holds reports whether in must wait for the barrier being aligned: it comes
+// from a sender whose barrier has arrived, or closes an input with elements
+// already held.
+func (r *inputReader) holds(in inputElement) bool {
+	if !r.align || r.checkpoint == 0 {
+		return false
+	}
+	if in.el.sender != inputClosed {
+		return r.arrived[in.input][in.el.sender]
+	}
+	for _, h := range r.held {
+		if h.input == in.input {
+			return true
+		}
+	}
+	return false
+}
+
+// barrier records the arrival of a checkpoint barrier from one sender.
+func (r *inputReader) barrier(input, sender int, checkpoint int64) {
+	switch {
+	case checkpoint <= r.completed || checkpoint < r.checkpoint:
+		// A barrier of a checkpoint that was already reported or superseded.
+		return
+	case checkpoint > r.checkpoint:
+		// A newer checkpoint abandons the one being aligned.
+		r.release()
+		r.checkpoint = checkpoint
+		r.waiting = 0
+		for i := range r.arrived {
+			for j := range r.arrived[i] {
+				r.arrived[i][j] = r.ended[i][j]
+				if !r.ended[i][j] {
+					r.waiting++
+				}
+			}
+		}
+	}
+	if !r.arrived[input][sender] {
+		r.arrived[input][sender] = true
+		r.waiting--
+		r.checkAligned()
+	}
+}
+
+// finish marks a sender as finished. It counts as aligned for any barrier in
+// progress, since it will not send one.
+func (r *inputReader) finish(input, sender int) {
+	if r.ended[input][sender] {
+		return
+	}
+	r.ended[input][sender] = true
+	if r.checkpoint != 0 && !r.arrived[input][sender] {
+		r.arrived[input][sender] = true
+		r.waiting--
+		r.checkAligned()
+	}
+}
+
+func (r *inputReader) checkAligned() {
+	if r.waiting > 0 {
+		return
+	}
+	r.completed = r.checkpoint
+	r.checkpoint = 0
+	r.ready = true
+	r.release()
+}
+
+// release queues the held elements to be processed ahead of any remaining replay.
+func (r *inputReader) release() {
+	if len(r.held) == 0 {
+		return
+	}
+	r.replay = append(r.held, r.replay...)
+	r.held = nil
+}
+
+// advance recomputes the minimum watermark across the senders that have not
+// finished and reports it if it moved forward.
+func (r *inputReader) advance() (operator.Watermark, bool) {
+	low := int64(math.MaxInt64)
+	active := false
+	for i, senders := range r.marks {
+		for j, ts := range senders {
+			if !r.ended[i][j] {
+				low = min(low, ts)
+				active = true
+			}
+		}
+	}
+	if !active || low == math.MinInt64 || low <= r.watermark {
+		return operator.Watermark{}, false
+	}
+	r.watermark = low
+	return operator.Watermark{Timestamp: low}, true
+}
+
+// processBatch hands a batch from the given input to op, telling multi-input
+// operators which input it came from, and records it in m.
+func processBatch(op operator.Operator, m *operator.Metrics, input int, batch arrow.Record) ([]arrow.Record, error) {
+	start := time.Now()
+	defer func() { m.ObserveBatch(batch.NumRows(), time.Since(start)) }()
+	if mi, ok := op.(operator.MultiInputOperator); ok {
+		return mi.ProcessBatchFrom(input, batch)
+	}
+	return op.ProcessBatch(batch)
+}
+
+// writeBatch hands a batch to a sink and records it in m.
+func writeBatch(sink operator.Sink, m *operator.Metrics, batch arrow.Record) error {
+	start := time.Now()
+	defer func() { m.ObserveBatch(batch.NumRows(), time.Since(start)) }()
+	return sink.WriteBatch(batch)
+}
+
+// endInput notifies multi-input operators that the given input has ended.
+func endInput(op operator.Operator, input int) ([]arrow.Record, error) {
+	if mi, ok := op.(operator.MultiInputOperator); ok {
+		return mi.EndInput(input)
+	}
+	return nil, nil
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/metrics"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// watermarkLagInterval is how often the watermark lag of every operator is
+// recomputed, so that a stalled watermark shows as a growing lag.
+const watermarkLagInterval = time.Second
+
+// noWatermark marks an instance that has not seen a watermark yet.
+const noWatermark = math.MinInt64
+
+// observeWatermark records the watermark an instance has reached, which is
+// also the clock of event-time state TTLs. The final watermark of a bounded
+// source only ends event time and is not recorded.
+func (inst *operatorInstance) observeWatermark(wm operator.Watermark) {
+	if wm.Timestamp != math.MaxInt64 {
+		inst.watermark.Store(wm.Timestamp)
+		if inst.opCtx != nil {
+			inst.opCtx.State.AdvanceWatermark(wm.Timestamp)
+		}
+	}
+}
+
+// reportWatermarkLag keeps metrics.WatermarkLag up to date until ctx is done.
+func (e *Engine) reportWatermarkLag(ctx context.Context, instances map[string][]*operatorInstance) {
+	ticker := time.NewTicker(watermarkLagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.updateWatermarkLag(instances, now)
+		}
+	}
+}
+
+// updateWatermarkLag sets the watermark lag of every operator whose instances
+// have all seen a watermark.
+func (e *Engine) updateWatermarkLag(instances map[string][]*operatorInstance, now time.Time) {
+	for _, insts := range instances {
+		low := int64(math.MaxInt64)
+		for _, inst := range insts {
+			low = min(low, inst.watermark.Load())
+		}
+		if low == noWatermark || low == math.MaxInt64 {
+			continue
+		}
+		lag := now.Sub(time.UnixMilli(low))
+		op := insts[0].node
+		metrics.WatermarkLag.WithLabelValues(op.Id, op.Name).Set(lag.Seconds())
+	}
+}
+
+// eventTimeLag observes the event-time lag of the rows a sink writes.
+type eventTimeLag struct {
+	column   string
+	observer prometheus.Observer
+}
+
+// newEventTimeLag returns the event-time lag of a sink, or nil if none of the
+// sources upstream of it declares a watermark column.
+func newEventTimeLag(plan *pb.ExecutionPlan, node *pb.OperatorNode) *eventTimeLag {
+	column := eventTimeColumn(plan, node.Id)
+	if column == "" {
+		return nil
+	}
+	return &eventTimeLag{
+		column:   column,
+		observer: metrics.SinkEventTimeLag.WithLabelValues(node.Id, node.Name),
+	}
+}
+
+// observe records the lag of every row of batch with an event time. Batches
+// without the column, e.g. after a projection dropped it, are not observed.
+func (l *eventTimeLag) observe(batch arrow.Record, now time.Time) {
+	if l == nil {
+		return
+	}
+	indices := batch.Schema().FieldIndices(l.column)
+	if len(indices) == 0 {
+		return
+	}
+	col := batch.Column(indices[0])
+	toMillis, err := eventTimes(col)
+	if err != nil {
+		return
+	}
+	nowMillis := now.UnixMilli()
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) {
+			l.observer.Observe(float64(nowMillis-toMillis(i)) / 1000)
+		}
+	}
+}
+
+// eventTimeColumn returns the watermark column of the nearest source upstream
+// of an operator, searching breadth-first, or "" if there is none.
+func eventTimeColumn(plan *pb.ExecutionPlan, id string) string {
+	nodes := make(map[string]*pb.OperatorNode, len(plan.Operators))
+	for _, op := range plan.Operators {
+		nodes[op.Id] = op
+	}
+	upstream := buildAdjacency(plan).upstream
+
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if column := sourceSchema(nodes[current]).GetWatermark().GetColumn(); column != "" {
+			return column
+		}
+		for _, up := range upstream[current] {
+			if !seen[up.operatorID] {
+				seen[up.operatorID] = true
+				queue = append(queue, up.operatorID)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,763 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	helpers "github.com/sandboxws/isotope/runtime/pkg/arrow/helpers"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// elementKind distinguishes the kinds of element sent along an edge.
+type elementKind uint8
+
+const (
+	batchElement elementKind = iota
+	watermarkElement
+	barrierElement
+	// endElement is sent by an upstream instance when it finishes. inputReader
+	// reports it to the operator once every sender of an input has finished.
+	endElement
+)
+
+// element is what travels along an edge: a batch, a watermark, or a
+// checkpoint barrier, tagged with the index of the upstream instance that sent it.
+type element struct {
+	kind       elementKind
+	batch      arrow.Record
+	watermark  operator.Watermark
+	checkpoint int64 // checkpoint ID of a barrier
+	sender     int
+
+	// span is the trace a batch is part of, if it is sampled.
+	span trace.SpanContext
+
+	// Backpressure accounting of a batch: the edge and downstream instance it
+	// was delivered to and its size in bytes.
+	edge     *edgeChannels
+	receiver int
+	size     int64
+}
+
+// edgeChannels carries one plan edge into every parallel instance of the
+// downstream operator. The channels are shared by all upstream instances and
+// closed once the last of them has finished sending.
+type edgeChannels struct {
+	chs     []chan element
+	senders int
+	active  atomic.Int32
+
+	metrics *edgeMetrics
+	budgets []*byteBudget // one per downstream instance, nil without a byte budget
+}
+
+func newEdgeChannels(receivers, senders int, buf EdgeBuffer, metrics *edgeMetrics) *edgeChannels {
+	ec := &edgeChannels{chs: make([]chan element, receivers), senders: senders, metrics: metrics}
+	for i := range ec.chs {
+		ec.chs[i] = make(chan element, buf.Batches)
+	}
+	if buf.Bytes > 0 {
+		ec.budgets = make([]*byteBudget, receivers)
+		for i := range ec.budgets {
+			ec.budgets[i] = newByteBudget(buf.Bytes)
+		}
+	}
+	ec.active.Store(int32(senders))
+	return ec
+}
+
+// done is called by each upstream instance when it stops sending.
+func (ec *edgeChannels) done() {
+	if ec.active.Add(-1) == 0 {
+		for _, ch := range ec.chs {
+			close(ch)
+		}
+	}
+}
+
+// output sends the batches of one upstream instance along an edge,
+// splitting them across the downstream instances with a partitioner.
+type output struct {
+	channels    *edgeChannels
+	partitioner partitioner
+	sender      int // index of the upstream instance
+}
+
+// send partitions batch and delivers each non-empty part to its downstream
+// instance, as part of the trace span. It takes ownership of batch.
+func (o *output) send(batch arrow.Record, span trace.SpanContext) error {
+	parts, err := o.partitioner.partition(batch, len(o.channels.chs))
+	batch.Release()
+	if err != nil {
+		return err
+	}
+	for i, part := range parts {
+		if part != nil {
+			o.channels.deliver(i, element{kind: batchElement, batch: part, sender: o.sender, span: span})
+		}
+	}
+	return nil
+}
+
+// sendWatermark delivers wm to every downstream instance, whatever the
+// partitioning, since each of them must see event time advance.
+func (o *output) sendWatermark(wm operator.Watermark) {
+	o.broadcast(element{kind: watermarkElement, watermark: wm})
+}
+
+// sendBarrier delivers a checkpoint barrier to every downstream instance.
+func (o *output) sendBarrier(checkpointID int64) {
+	o.broadcast(element{kind: barrierElement, checkpoint: checkpointID})
+}
+
+// close tells every downstream instance that this sender has finished, so it
+// no longer holds back their watermark or barrier alignment.
+func (o *output) close() {
+	o.broadcast(element{kind: endElement})
+	o.channels.done()
+}
+
+func (o *output) broadcast(el element) {
+	el.sender = o.sender
+	for _, ch := range o.channels.chs {
+		ch <- el
+	}
+}
+
+// partitioner decides which downstream instance receives each row of a batch.
+type partitioner interface {
+	// partition splits batch into n parts, one per downstream instance.
+	// Parts with no rows are nil. The caller owns the returned batches;
+	// batch itself is not released.
+	partition(batch arrow.Record, n int) ([]arrow.Record, error)
+}
+
+// newPartitioners returns one partitioner per upstream instance of edge.
+// Partitioners of the same edge share any state that must agree across
+// senders: the range boundaries of a RANGE edge are bounds, or sampled afresh
+// if bounds is nil.
+func newPartitioners(edge *pb.Edge, senders int, alloc memory.Allocator, bounds *rangeBoundaries) []partitioner {
+	parts := make([]partitioner, senders)
+	if edge.Shuffle == pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE && bounds == nil {
+		bounds = &rangeBoundaries{keys: edge.PartitionKeys}
+	}
+
+	for i := range parts {
+		switch edge.Shuffle {
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH:
+			parts[i] = &hashPartitioner{keys: edge.PartitionKeys, alloc: alloc, hasher: fnv.New64a()}
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_BROADCAST:
+			parts[i] = broadcastPartitioner{}
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN:
+			// Start each sender at a different instance so small streams still spread out.
+			parts[i] = &roundRobinPartitioner{next: i}
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE:
+			parts[i] = &rangePartitioner{keys: edge.PartitionKeys, alloc: alloc, bounds: bounds}
+		default:
+			parts[i] = forwardPartitioner{index: i}
+		}
+	}
+	return parts
+}
+
+// forwardPartitioner sends every batch to the downstream instance with the
+// same index as the sender. The validator guarantees equal parallelism.
+type forwardPartitioner struct {
+	index int
+}
+
+func (f forwardPartitioner) partition(batch arrow.Record, n int) ([]arrow.Record, error) {
+	parts := make([]arrow.Record, n)
+	batch.Retain()
+	parts[f.index%n] = batch
+	return parts, nil
+}
+
+// broadcastPartitioner sends every batch to every downstream instance.
+type broadcastPartitioner struct{}
+
+func (broadcastPartitioner) partition(batch arrow.Record, n int) ([]arrow.Record, error) {
+	parts := make([]arrow.Record, n)
+	for i := range parts {
+		batch.Retain()
+		parts[i] = batch
+	}
+	return parts, nil
+}
+
+// roundRobinPartitioner rebalances load by sending whole batches to the
+// downstream instances in turn.
+type roundRobinPartitioner struct {
+	next int
+}
+
+func (r *roundRobinPartitioner) partition(batch arrow.Record, n int) ([]arrow.Record, error) {
+	parts := make([]arrow.Record, n)
+	batch.Retain()
+	parts[r.next%n] = batch
+	r.next = (r.next + 1) % n
+	return parts, nil
+}
+
+// hashPartitioner routes each row by the hash of its partition key columns,
+// so all rows with the same key reach the same downstream instance.
+type hashPartitioner struct {
+	keys   []string
+	alloc  memory.Allocator
+	hasher hash.Hash64
+	buf    [8]byte
+}
+
+func (h *hashPartitioner) partition(batch arrow.Record, n int) ([]arrow.Record, error) {
+	if n == 1 {
+		batch.Retain()
+		return []arrow.Record{batch}, nil
+	}
+
+	cols := make([]arrow.Array, len(h.keys))
+	for i, key := range h.keys {
+		col, err := helpers.Column(batch, key)
+		if err == nil {
+			err = checkKeyColumn(key, col)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("hash partition: %w", err)
+		}
+		cols[i] = col
+	}
+
+	targets := make([]int, batch.NumRows())
+	for row := range targets {
+		targets[row] = int(h.hashRow(cols, row) % uint64(n))
+	}
+	return splitByTarget(h.alloc, batch, targets, n)
+}
+
+// hashRow hashes the key columns of one row. The encoding is stable across
+// processes so the same key always maps to the same instance. Integer types
+// hash by value regardless of width, so keys join correctly across types.
+func (h *hashPartitioner) hashRow(cols []arrow.Array, row int) uint64 {
+	h.hasher.Reset()
+	for _, col := range cols {
+		if col.IsNull(row) {
+			h.hasher.Write([]byte{0})
+			continue
+		}
+		h.hasher.Write([]byte{1})
+		switch a := col.(type) {
+		case *array.String:
+			h.hasher.Write([]byte(a.Value(row)))
+		case *array.LargeString:
+			h.hasher.Write([]byte(a.Value(row)))
+		case *array.Binary:
+			h.hasher.Write(a.Value(row))
+		case *array.LargeBinary:
+			h.hasher.Write(a.Value(row))
+		case *array.Boolean:
+			if a.Value(row) {
+				h.hasher.Write([]byte{1})
+			} else {
+				h.hasher.Write([]byte{0})
+			}
+		case *array.Float32:
+			h.writeUint64(math.Float64bits(float64(a.Value(row))))
+		case *array.Float64:
+			h.writeUint64(math.Float64bits(a.Value(row)))
+		default:
+			h.writeUint64(uint64(integerValue(col, row)))
+		}
+	}
+	return h.hasher.Sum64()
+}
+
+func (h *hashPartitioner) writeUint64(v uint64) {
+	binary.LittleEndian.PutUint64(h.buf[:], v)
+	h.hasher.Write(h.buf[:])
+}
+
+// checkKeyColumn returns an error unless the partition key column named key
+// has a type hashRow and rangeKey tell values apart in: strings, binaries,
+// booleans, floats and the integer-like types integerValue widens.
+func checkKeyColumn(key string, col arrow.Array) error {
+	switch col.(type) {
+	case *array.String, *array.LargeString, *array.Binary, *array.LargeBinary, *array.Boolean,
+		*array.Float32, *array.Float64,
+		*array.Int8, *array.Int16, *array.Int32, *array.Int64,
+		*array.Uint8, *array.Uint16, *array.Uint32, *array.Uint64,
+		*array.Timestamp, *array.Date32, *array.Date64, *array.Time32, *array.Time64, *array.Duration:
+		return nil
+	}
+	return fmt.Errorf("partition key %q has unsupported type %s", key, col.DataType())
+}
+
+// integerValue widens an integer-like value (including timestamps and dates)
+// to int64. A Uint64 keeps its bits, so values of 2^63 and above wrap to
+// negative numbers: fine for hashing, but rangeKey orders them separately.
+// Types checkKeyColumn rejects yield 0.
+func integerValue(arr arrow.Array, row int) int64 {
+	switch a := arr.(type) {
+	case *array.Int8:
+		return int64(a.Value(row))
+	case *array.Int16:
+		return int64(a.Value(row))
+	case *array.Int32:
+		return int64(a.Value(row))
+	case *array.Int64:
+		return a.Value(row)
+	case *array.Uint8:
+		return int64(a.Value(row))
+	case *array.Uint16:
+		return int64(a.Value(row))
+	case *array.Uint32:
+		return int64(a.Value(row))
+	case *array.Uint64:
+		return int64(a.Value(row))
+	case *array.Timestamp:
+		return int64(a.Value(row))
+	case *array.Date32:
+		return int64(a.Value(row))
+	case *array.Date64:
+		return int64(a.Value(row))
+	case *array.Time32:
+		return int64(a.Value(row))
+	case *array.Time64:
+		return int64(a.Value(row))
+	case *array.Duration:
+		return int64(a.Value(row))
+	default:
+		return 0
+	}
+}
+
+// splitByTarget splits batch into n parts where row i goes to part targets[i].
+// When every row has the same target the batch is forwarded without copying.
+func splitByTarget(alloc memory.Allocator, batch arrow.Record, targets []int, n int) ([]arrow.Record, error) {
+	parts := make([]arrow.Record, n)
+	if len(targets) == 0 {
+		return parts, nil
+	}
+
+	counts := make([]int, n)
+	for _, t := range targets {
+		counts[t]++
+	}
+	for t, c := range counts {
+		if c == len(targets) {
+			batch.Retain()
+			parts[t] = batch
+			return parts, nil
+		}
+	}
+
+	for t, c := range counts {
+		if c == 0 {
+			continue
+		}
+		bldr := array.NewBooleanBuilder(alloc)
+		for _, target := range targets {
+			bldr.Append(target == t)
+		}
+		mask := bldr.NewArray()
+		bldr.Release()
+
+		part, err := helpers.Filter(context.Background(), batch, mask)
+		mask.Release()
+		if err != nil {
+			for _, p := range parts {
+				if p != nil {
+					p.Release()
+				}
+			}
+			return nil, err
+		}
+		parts[t] = part
+	}
+	return parts, nil
+}
+
+// rangeBoundaries holds the split points of a RANGE edge. They are sampled
+// once, from the first non-empty batch any sender sees, and then shared by
+// all senders so a key maps to the same instance regardless of its origin.
+// Checkpoints store them, and a restored run reuses them instead of sampling
+// again, so every key keeps going to the instance holding its state.
+//
+// Boundaries are never resampled while running, as that would move keys away
+// from their state. Keys that keep growing, such as timestamps or sequence
+// numbers, therefore soon all fall past the last boundary and reach the last
+// instance; partition by something else, or hash, to spread them.
+type rangeBoundaries struct {
+	keys []string
+
+	mu     sync.Mutex
+	bounds [][]interface{} // nil until sampled
+	// checked is set once the boundaries are known to hold values of the
+	// key columns' types; restored ones may not, if a column changed type.
+	checked bool
+}
+
+// get returns the boundaries, sampling them from keys if there are none yet,
+// or if the restored ones hold values of other types than keys.
+func (b *rangeBoundaries) get(keys [][]interface{}, n int) [][]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.bounds != nil && !b.checked && !sameKinds(keys, b.bounds) {
+		b.bounds = nil
+	}
+	if b.bounds == nil {
+		b.bounds = sampleBoundaries(keys, n)
+	}
+	b.checked = true
+	return b.bounds
+}
+
+// sampled returns the boundaries, or nil if none were sampled yet.
+func (b *rangeBoundaries) sampled() [][]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bounds
+}
+
+// rangePartitioner routes each row to the instance whose key range contains
+// it: instance i receives keys between boundary i-1 and boundary i, so the
+// instances together hold the keys in sorted order.
+type rangePartitioner struct {
+	keys   []string
+	alloc  memory.Allocator
+	bounds *rangeBoundaries
+}
+
+func (r *rangePartitioner) partition(batch arrow.Record, n int) ([]arrow.Record, error) {
+	if n == 1 {
+		batch.Retain()
+		return []arrow.Record{batch}, nil
+	}
+
+	cols := make([]arrow.Array, len(r.keys))
+	for i, key := range r.keys {
+		col, err := helpers.Column(batch, key)
+		if err == nil {
+			err = checkKeyColumn(key, col)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("range partition: %w", err)
+		}
+		cols[i] = col
+	}
+
+	numRows := int(batch.NumRows())
+	if numRows == 0 {
+		return make([]arrow.Record, n), nil
+	}
+
+	rowKeys := make([][]interface{}, numRows)
+	for row := range rowKeys {
+		rowKeys[row] = rangeKey(cols, row)
+	}
+
+	bounds := r.bounds.get(rowKeys, n)
+
+	targets := make([]int, numRows)
+	for row, key := range rowKeys {
+		// The target is the number of boundaries that are <= key.
+		targets[row] = sort.Search(len(bounds), func(i int) bool {
+			return compareRangeKeys(bounds[i], key) > 0
+		})
+	}
+	return splitByTarget(r.alloc, batch, targets, n)
+}
+
+// sampleBoundaries picks n-1 split points at evenly spaced quantiles of keys.
+func sampleBoundaries(keys [][]interface{}, n int) [][]interface{} {
+	sorted := make([][]interface{}, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareRangeKeys(sorted[i], sorted[j]) < 0
+	})
+
+	bounds := make([][]interface{}, 0, n-1)
+	for i := 1; i < n; i++ {
+		bounds = append(bounds, sorted[i*len(sorted)/n])
+	}
+	return bounds
+}
+
+// rangeKey extracts the comparable key values of one row. Values are widened
+// to int64, float64, string, or bool, except that Uint64 values stay uint64
+// to keep their order; nulls are represented as nil.
+func rangeKey(cols []arrow.Array, row int) []interface{} {
+	key := make([]interface{}, len(cols))
+	for i, col := range cols {
+		if col.IsNull(row) {
+			continue
+		}
+		switch a := col.(type) {
+		case *array.String:
+			key[i] = a.Value(row)
+		case *array.LargeString:
+			key[i] = a.Value(row)
+		case *array.Binary:
+			key[i] = string(a.Value(row))
+		case *array.LargeBinary:
+			key[i] = string(a.Value(row))
+		case *array.Uint64:
+			key[i] = a.Value(row)
+		case *array.Boolean:
+			key[i] = a.Value(row)
+		case *array.Float32:
+			key[i] = float64(a.Value(row))
+		case *array.Float64:
+			key[i] = a.Value(row)
+		default:
+			key[i] = integerValue(col, row)
+		}
+	}
+	return key
+}
+
+// sameKinds reports whether every column of keys a and b holds values of the
+// same type, ignoring nulls. a must not be empty.
+func sameKinds(a, b [][]interface{}) bool {
+	for col := range a[0] {
+		if ka, kb := columnKind(a, col), columnKind(b, col); ka != 0 && kb != 0 && ka != kb {
+			return false
+		}
+	}
+	return true
+}
+
+// columnKind returns the rangeKind of the first non-null value in a column
+// of keys, or 0 if they are all null.
+func columnKind(keys [][]interface{}, col int) int {
+	for _, key := range keys {
+		if kind := rangeKind(key[col]); kind != 0 {
+			return kind
+		}
+	}
+	return 0
+}
+
+// rangeKind numbers the types rangeKey produces; nil is 0.
+func rangeKind(v interface{}) int {
+	switch v.(type) {
+	case bool:
+		return 1
+	case int64:
+		return 2
+	case uint64:
+		return 3
+	case float64:
+		return 4
+	case string:
+		return 5
+	}
+	return 0
+}
+
+// compareRangeKeys orders keys column by column. Nulls sort first.
+func compareRangeKeys(a, b []interface{}) int {
+	for i := range a {
+		if c := compareRangeValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareRangeValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if ka, kb := rangeKind(a), rangeKind(b); ka != kb {
+		// Values of one column share a type; get ensures restored
+		// boundaries do too. Order by type rather than fail if not.
+		return cmpOrdered(int64(ka), int64(kb))
+	}
+
+	switch av := a.(type) {
+	case int64:
+		return cmpOrdered(av, b.(int64))
+	case uint64:
+		return cmpOrdered(av, b.(uint64))
+	case float64:
+		return cmpOrdered(av, b.(float64))
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+func cmpOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// rangesFile holds the boundaries of every RANGE edge in a checkpoint.
+const rangesFile = "ranges.json"
+
+// rangeEdgeName identifies a RANGE edge in rangesFile.
+func rangeEdgeName(edge *pb.Edge) string {
+	return edge.FromOperator + "->" + edge.ToOperator
+}
+
+// savedRange is the boundaries of one RANGE edge as stored in rangesFile.
+type savedRange struct {
+	Keys   []string       `json:"keys"`
+	Bounds [][]rangeValue `json:"bounds"`
+}
+
+// rangeValue is one boundary value, tagged with its type so that integers
+// survive JSON. A null has no field set.
+type rangeValue struct {
+	Int    *int64   `json:"i,omitempty"`
+	Uint   *uint64  `json:"u,omitempty"`
+	Float  *float64 `json:"f,omitempty"`
+	String *string  `json:"s,omitempty"`
+	Bool   *bool    `json:"b,omitempty"`
+}
+
+func toRangeValue(v interface{}) rangeValue {
+	switch v := v.(type) {
+	case int64:
+		return rangeValue{Int: &v}
+	case uint64:
+		return rangeValue{Uint: &v}
+	case float64:
+		return rangeValue{Float: &v}
+	case string:
+		return rangeValue{String: &v}
+	case bool:
+		return rangeValue{Bool: &v}
+	}
+	return rangeValue{}
+}
+
+func (v rangeValue) value() interface{} {
+	switch {
+	case v.Int != nil:
+		return *v.Int
+	case v.Uint != nil:
+		return *v.Uint
+	case v.Float != nil:
+		return *v.Float
+	case v.String != nil:
+		return *v.String
+	case v.Bool != nil:
+		return *v.Bool
+	}
+	return nil
+}
+
+// writeRanges stores the boundaries sampled so far for every RANGE edge in
+// the snapshot in dir. Edges that have not sampled theirs are left out.
+func writeRanges(dir string, ranges map[string]*rangeBoundaries) error {
+	saved := make(map[string]savedRange, len(ranges))
+	for name, r := range ranges {
+		bounds := r.sampled()
+		if bounds == nil {
+			continue
+		}
+		s := savedRange{Keys: r.keys, Bounds: make([][]rangeValue, len(bounds))}
+		for i, bound := range bounds {
+			for _, v := range bound {
+				s.Bounds[i] = append(s.Bounds[i], toRangeValue(v))
+			}
+		}
+		saved[name] = s
+	}
+	if len(saved) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, rangesFile), data, 0o644)
+}
+
+// restoreRanges returns the boundaries of every RANGE edge in the plan,
+// taken from the snapshot in dir where it holds them for the same partition
+// keys and downstream parallelism. Other edges sample theirs afresh, as do
+// edges whose key columns no longer have the types of the restored
+// boundaries; the partitioner checks that on its first batch.
+func restoreRanges(plan *pb.ExecutionPlan, dir string) (map[string]*rangeBoundaries, error) {
+	var saved map[string]savedRange
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, rangesFile))
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &saved); err != nil {
+				return nil, fmt.Errorf("read %s: %w", rangesFile, err)
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	ops := make(map[string]*pb.OperatorNode, len(plan.Operators))
+	for _, op := range plan.Operators {
+		ops[op.Id] = op
+	}
+	ranges := make(map[string]*rangeBoundaries)
+	for _, edge := range plan.Edges {
+		if edge.Shuffle != pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE {
+			continue
+		}
+		name := rangeEdgeName(edge)
+		r := &rangeBoundaries{keys: edge.PartitionKeys}
+		ranges[name] = r
+		s, ok := saved[name]
+		if !ok || !slices.Equal(s.Keys, edge.PartitionKeys) ||
+			len(s.Bounds) != operatorParallelism(plan, ops[edge.ToOperator])-1 {
+			continue
+		}
+		r.bounds = make([][]interface{}, len(s.Bounds))
+		for i, bound := range s.Bounds {
+			r.bounds[i] = make([]interface{}, len(bound))
+			for j, v := range bound {
+				r.bounds[i][j] = v.value()
+			}
+		}
+	}
+	return ranges, nil
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+)
+
+// registry maps operator types to the factories that build them.
+var registry = struct {
+	sync.RWMutex
+	factories map[pb.OperatorType]OperatorFactory
+}{factories: make(map[pb.OperatorType]OperatorFactory)}
+
+// Register makes a factory available for the given operator type.
+// It is intended to be called from an init function. Registering a nil
+// factory or the same operator type twice panics.
+func Register(opType pb.OperatorType, factory OperatorFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("engine: Register factory for %s is nil", opType))
+	}
+	if _, dup := registry.factories[opType]; dup {
+		panic(fmt.Sprintf("engine: Register called twice for %s", opType))
+	}
+	registry.factories[opType] = factory
+}
+
+// RegisteredTypes returns the operator types that currently have a factory.
+func RegisteredTypes() []pb.OperatorType {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	types := make([]pb.OperatorType, 0, len(registry.factories))
+	for t := range registry.factories {
+		types = append(types, t)
+	}
+	return types
+}
+
+// NewOperator builds an operator, source, or sink for the node using the
+// factory registered for its operator type. It satisfies OperatorFactory
+// and is the engine's default when NewEngine is given a nil factory.
+func NewOperator(node *pb.OperatorNode) (interface{}, error) {
+	registry.RLock()
+	factory, ok := registry.factories[node.OperatorType]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no factory registered for operator type %s", node.OperatorType)
+	}
+	return factory(node)
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+)
+
+const (
+	restartFixedDelay  = "fixed-delay"
+	restartFailureRate = "failure-rate"
+	restartNone        = "no-restart"
+
+	// defaultRestartAttempts and defaultRestartDelay apply when the plan
+	// selects a strategy without setting them.
+	defaultRestartAttempts = 3
+	defaultRestartDelay    = time.Second
+
+	// failureRateInterval is the window over which the failure-rate strategy
+	// counts failures.
+	failureRateInterval = time.Minute
+)
+
+// restartStrategy decides whether the pipeline is restarted after a failure.
+type restartStrategy interface {
+	// next records a failure at now and returns how long to wait before
+	// restarting, or false if the pipeline must not be restarted.
+	next(now time.Time) (time.Duration, bool)
+}
+
+// newRestartStrategy returns the strategy selected by cfg. Without one, a
+// failure stops the pipeline.
+func newRestartStrategy(cfg *pb.RestartConfig) (restartStrategy, error) {
+	if cfg == nil || cfg.Type == "" || cfg.Type == restartNone {
+		return noRestart{}, nil
+	}
+
+	attempts := int(cfg.Attempts)
+	if attempts < 0 {
+		return nil, fmt.Errorf("restart: attempts must not be negative, got %d", cfg.Attempts)
+	}
+	if attempts == 0 {
+		attempts = defaultRestartAttempts
+	}
+	delay := defaultRestartDelay
+	if cfg.Delay != "" {
+		var err error
+		if delay, err = time.ParseDuration(cfg.Delay); err != nil {
+			return nil, fmt.Errorf("restart: invalid delay %q: %w", cfg.Delay, err)
+		}
+		if delay < 0 {
+			return nil, fmt.Errorf("restart: delay must not be negative, got %s", cfg.Delay)
+		}
+	}
+
+	switch cfg.Type {
+	case restartFixedDelay:
+		return &fixedDelayRestart{attempts: attempts, delay: delay}, nil
+	case restartFailureRate:
+		return &failureRateRestart{maxFailures: attempts, interval: failureRateInterval, delay: delay}, nil
+	default:
+		return nil, fmt.Errorf("restart: unknown type %q, expected %q, %q or %q",
+			cfg.Type, restartFixedDelay, restartFailureRate, restartNone)
+	}
+}
+
+// noRestart never restarts.
+type noRestart struct{}
+
+func (noRestart) next(time.Time) (time.Duration, bool) { return 0, false }
+
+// fixedDelayRestart restarts up to attempts times, waiting delay before each.
+type fixedDelayRestart struct {
+	attempts int
+	delay    time.Duration
+	restarts int
+}
+
+func (s *fixedDelayRestart) next(time.Time) (time.Duration, bool) {
+	if s.restarts >= s.attempts {
+		return 0, false
+	}
+	s.restarts++
+	return s.delay, true
+}
+
+// failureRateRestart restarts after a delay as long as no more than
+// maxFailures failures occurred within the last interval.
+type failureRateRestart struct {
+	maxFailures int
+	interval    time.Duration
+	delay       time.Duration
+	failures    []time.Time
+}
+
+func (s *failureRateRestart) next(now time.Time) (time.Duration, bool) {
+	recent := s.failures[:0]
+	for _, t := range s.failures {
+		if now.Sub(t) < s.interval {
+			recent = append(recent, t)
+		}
+	}
+	s.failures = append(recent, now)
+	if len(s.failures) > s.maxFailures {
+		return 0, false
+	}
+	return s.delay, true
+}
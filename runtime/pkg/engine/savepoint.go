@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// defaultSavepointRoot holds one savepoint directory per pipeline unless
+// SetSavepointDir is called.
+const defaultSavepointRoot = "savepoints"
+
+// savepointFile describes a completed savepoint. A savepoint directory
+// without it is incomplete.
+const savepointFile = "savepoint.json"
+
+// ErrInvalidSavepoint is returned for a savepoint name that cannot be used.
+var ErrInvalidSavepoint = errors.New("invalid savepoint")
+
+// SavepointInfo describes a completed savepoint.
+type SavepointInfo struct {
+	Name         string    `json:"name"`
+	Pipeline     string    `json:"pipeline"`
+	CheckpointID int64     `json:"checkpoint_id"`
+	Path         string    `json:"path"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// StateMapping controls how state in a checkpoint or savepoint is matched to
+// the operators of the plan restoring it. State is always matched by
+// operator ID, so operators keep their state across plan versions as long
+// as their IDs are stable.
+type StateMapping struct {
+	// AllowRemoved discards the state of operators no longer in the plan.
+	// Without it, restoring such state fails.
+	AllowRemoved bool
+	// RequireAll fails a restore if a stateful operator has no state to
+	// restore. Without it, operators new to the plan start empty.
+	RequireAll bool
+}
+
+// SetSavepointDir sets the directory savepoints are written to. It defaults
+// to savepoints/<pipeline name>.
+func (e *Engine) SetSavepointDir(dir string) {
+	e.savepointDir = dir
+}
+
+// SetStateMapping sets how restored state is matched to the plan's operators.
+func (e *Engine) SetStateMapping(m StateMapping) {
+	e.stateMapping = m
+}
+
+// TriggerSavepoint takes a savepoint of the running pipeline and waits for it
+// to complete. Unlike checkpoints, savepoints are never expired, and a later
+// plan version can resume from one with SetRestoreFrom.
+func (e *Engine) TriggerSavepoint(ctx context.Context, name string) (*SavepointInfo, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: name %q", ErrInvalidSavepoint, name)
+	}
+	e.stateMu.Lock()
+	checkpoints := e.checkpoints
+	e.stateMu.Unlock()
+	if checkpoints == nil {
+		return nil, ErrCheckpointingDisabled
+	}
+
+	root := e.savepointDir
+	if root == "" {
+		root = filepath.Join(defaultSavepointRoot, e.Plan().PipelineName)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create savepoint directory: %w", err)
+	}
+	dir := filepath.Join(root, name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("savepoint %q already exists", name)
+		}
+		return nil, fmt.Errorf("create savepoint directory: %w", err)
+	}
+
+	req := &checkpointRequest{savepoint: name, dir: dir, done: make(chan error, 1)}
+	if _, err := checkpoints.start(req); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	select {
+	case err := <-req.done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		// The savepoint may still complete; its directory is left to the user.
+		return nil, ctx.Err()
+	}
+	return readSavepoint(dir)
+}
+
+// writeSavepoint marks the savepoint snapshotted by checkpoint id complete.
+// Callers hold c.mu.
+func (c *checkpointCoordinator) writeSavepoint(id int64, req *checkpointRequest) error {
+	info := SavepointInfo{
+		Name:         req.savepoint,
+		Pipeline:     c.pipeline,
+		CheckpointID: id,
+		Path:         req.dir,
+		CreatedAt:    time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode savepoint: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(req.dir, savepointFile), data, 0o644); err != nil {
+		return fmt.Errorf("write savepoint: %w", err)
+	}
+	c.logger.Info("savepoint completed", "savepoint", req.savepoint, "checkpoint", id, "path", req.dir)
+	return nil
+}
+
+// readSavepoint loads the description of the savepoint in dir.
+func readSavepoint(dir string) (*SavepointInfo, error) {
+	data, err := os.ReadFile(filepath.Join(dir, savepointFile))
+	if err != nil {
+		return nil, fmt.Errorf("read savepoint: %w", err)
+	}
+	info := &SavepointInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("parse savepoint: %w", err)
+	}
+	return info, nil
+}
+
+// snapshotOperator describes what one operator left in a checkpoint or
+// savepoint.
+type snapshotOperator struct {
+	// parallelism is the number of instances that took part in the snapshot.
+	parallelism int
+	// state is set if any instance wrote state or a source position.
+	state bool
+}
+
+// snapshotOperators describes the operators in the checkpoint or savepoint in
+// dir by ID.
+func snapshotOperators(dir string) (map[string]*snapshotOperator, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ops := make(map[string]*snapshotOperator)
+	for _, entry := range entries {
+		id, ok := instanceDirOperator(entry.Name())
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		op := ops[id]
+		if op == nil {
+			op = &snapshotOperator{}
+			ops[id] = op
+		}
+		index, _ := strconv.Atoi(entry.Name()[len(id)+1:])
+		op.parallelism = max(op.parallelism, index+1)
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		op.state = op.state || len(files) > 0
+	}
+	return ops, nil
+}
+
+// mapState checks the state in the checkpoint being restored against the
+// plan and returns the IDs of the operators it holds state for.
+//
+// Keyed state and source positions are restored by instance index, so an
+// operator holding either must run with the parallelism it was snapshotted
+// with: a key or partition would otherwise not find its state. Partitioned
+// sources are the exception, as every instance is given the positions of all.
+func (e *Engine) mapState(instances map[string][]*operatorInstance) (map[string]bool, error) {
+	ops, err := snapshotOperators(e.restoreDir)
+	if err != nil {
+		return nil, err
+	}
+	inPlan := make(map[string]*pb.OperatorNode, len(e.plan.Operators))
+	for _, op := range e.plan.Operators {
+		inPlan[op.Id] = op
+	}
+	restored := make(map[string]bool, len(ops))
+	for id, op := range ops {
+		restored[id] = true
+		node, ok := inPlan[id]
+		if !ok || !op.state || rescalable(instances[id]) {
+			continue
+		}
+		if n := operatorParallelism(e.plan, node); n != op.parallelism {
+			return nil, fmt.Errorf("%s holds state of operator %s at parallelism %d, but the plan runs it at %d: "+
+				"its state cannot be redistributed (give the operator a new ID to start it empty)",
+				e.restoreDir, id, op.parallelism, n)
+		}
+	}
+	var removed []string
+	for id := range restored {
+		if inPlan[id] == nil {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return restored, nil
+	}
+	if !e.stateMapping.AllowRemoved {
+		return nil, fmt.Errorf("%s holds state of operators not in the plan: %s (allow removed state to discard it)",
+			e.restoreDir, strings.Join(removed, ", "))
+	}
+	e.logger.Warn("discarding state of removed operators", "operators", removed)
+	return restored, nil
+}
+
+// rescalable reports whether the instances of an operator restore their
+// state at any parallelism: those of a partitioned source do.
+func rescalable(insts []*operatorInstance) bool {
+	if len(insts) == 0 {
+		return false
+	}
+	_, ok := insts[0].impl.(operator.PartitionedSource)
+	return ok
+}
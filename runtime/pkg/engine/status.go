@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+)
+
+// InstanceState is the lifecycle state of an operator instance.
+type InstanceState string
+
+const (
+	StateCreated  InstanceState = "created"
+	StateOpened   InstanceState = "opened"
+	StateRunning  InstanceState = "running"
+	StateFailed   InstanceState = "failed"
+	StateFinished InstanceState = "finished"
+)
+
+// instanceState holds an InstanceState for concurrent reads.
+type instanceState struct {
+	v atomic.Value
+}
+
+func (s *instanceState) load() InstanceState {
+	if state, ok := s.v.Load().(InstanceState); ok {
+		return state
+	}
+	return StateCreated
+}
+
+func (s *instanceState) store(state InstanceState) {
+	s.v.Store(state)
+}
+
+// finish marks the instance finished unless it failed.
+func (s *instanceState) finish() {
+	if s.load() != StateFailed {
+		s.store(StateFinished)
+	}
+}
+
+// PipelineStatus is a snapshot of a running pipeline.
+type PipelineStatus struct {
+	Pipeline  string           `json:"pipeline"`
+	Operators []OperatorStatus `json:"operators"`
+}
+
+// OperatorStatus is a snapshot of one operator, aggregated over its instances.
+type OperatorStatus struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	State   InstanceState `json:"state"`
+	Rows    int64         `json:"rows"`
+	Batches int64         `json:"batches"`
+	Errors  int64         `json:"errors"`
+	// Watermark is the lowest watermark across the instances, in milliseconds
+	// since epoch, or nil until every instance has seen one.
+	Watermark *int64           `json:"watermark,omitempty"`
+	Instances []InstanceStatus `json:"instances"`
+}
+
+// InstanceStatus is a snapshot of one parallel instance of an operator.
+type InstanceStatus struct {
+	Index     int           `json:"index"`
+	State     InstanceState `json:"state"`
+	Rows      int64         `json:"rows"`
+	Batches   int64         `json:"batches"`
+	Errors    int64         `json:"errors"`
+	Watermark *int64        `json:"watermark,omitempty"`
+}
+
+// CheckpointInfo describes a completed checkpoint.
+type CheckpointInfo struct {
+	ID          int64     `json:"id"`
+	Path        string    `json:"path"`
+	Mode        string    `json:"mode"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// ErrCheckpointingDisabled is returned when a checkpoint is requested of a
+// plan without checkpointing.
+var ErrCheckpointingDisabled = errors.New("checkpointing is disabled")
+
+// Plan returns the plan the engine runs, which changes with Swap.
+func (e *Engine) Plan() *pb.ExecutionPlan {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	return e.plan
+}
+
+// Chains returns the operator IDs of each chain of FORWARD-connected operators
+// fused into a single goroutine per instance.
+func (e *Engine) Chains() [][]string {
+	plan := e.Plan()
+	chains := identifyChains(plan, buildAdjacency(plan))
+	if chains == nil {
+		return [][]string{}
+	}
+	return chains
+}
+
+// Status returns a snapshot of the state, row counts and watermarks of every
+// operator of the current run.
+func (e *Engine) Status() PipelineStatus {
+	e.stateMu.Lock()
+	plan, instances := e.plan, e.instances
+	e.stateMu.Unlock()
+
+	status := PipelineStatus{Pipeline: plan.PipelineName, Operators: []OperatorStatus{}}
+	for _, op := range plan.Operators {
+		opStatus := OperatorStatus{ID: op.Id, Name: op.Name, Instances: []InstanceStatus{}}
+		low, complete := int64(0), len(instances[op.Id]) > 0
+		for _, inst := range instances[op.Id] {
+			s := inst.status()
+			opStatus.Rows += s.Rows
+			opStatus.Batches += s.Batches
+			opStatus.Errors += s.Errors
+			if s.Watermark == nil {
+				complete = false
+			} else if len(opStatus.Instances) == 0 || *s.Watermark < low {
+				low = *s.Watermark
+			}
+			opStatus.Instances = append(opStatus.Instances, s)
+		}
+		if complete {
+			opStatus.Watermark = &low
+		}
+		opStatus.State = operatorState(opStatus.Instances)
+		status.Operators = append(status.Operators, opStatus)
+	}
+	return status
+}
+
+func (inst *operatorInstance) status() InstanceStatus {
+	s := InstanceStatus{Index: inst.index, State: inst.state.load()}
+	if inst.opCtx != nil {
+		m := inst.opCtx.Metrics
+		s.Rows = m.RowsProcessed.Load()
+		s.Batches = m.BatchesProcessed.Load()
+		s.Errors = m.Errors.Load()
+	}
+	if wm := inst.watermark.Load(); wm != noWatermark {
+		s.Watermark = &wm
+	}
+	return s
+}
+
+// operatorState sums up the states of an operator's instances: failed if any
+// failed, else running, opened or created if any is, else finished.
+func operatorState(instances []InstanceStatus) InstanceState {
+	if len(instances) == 0 {
+		return StateCreated
+	}
+	for _, state := range []InstanceState{StateFailed, StateRunning, StateOpened, StateCreated} {
+		for _, inst := range instances {
+			if inst.State == state {
+				return state
+			}
+		}
+	}
+	return StateFinished
+}
+
+// LatestCheckpoint returns the latest completed checkpoint of the pipeline, or
+// nil if there is none.
+func (e *Engine) LatestCheckpoint() (*CheckpointInfo, error) {
+	e.stateMu.Lock()
+	checkpoints := e.checkpoints
+	e.stateMu.Unlock()
+	if checkpoints == nil {
+		return nil, ErrCheckpointingDisabled
+	}
+
+	checkpoints.mu.Lock()
+	manifest, err := readManifest(checkpoints.dir)
+	checkpoints.mu.Unlock()
+	if err != nil || len(manifest.Checkpoints) == 0 {
+		return nil, err
+	}
+	latest := manifest.Checkpoints[len(manifest.Checkpoints)-1]
+	return &CheckpointInfo{
+		ID:          latest.ID,
+		Path:        filepath.Join(checkpoints.dir, latest.Path),
+		Mode:        latest.Mode,
+		CompletedAt: latest.CompletedAt,
+	}, nil
+}
+
+// TriggerCheckpoint starts a checkpoint now, outside the plan's interval, and
+// returns its ID. It completes asynchronously; see LatestCheckpoint.
+func (e *Engine) TriggerCheckpoint() (int64, error) {
+	e.stateMu.Lock()
+	checkpoints := e.checkpoints
+	e.stateMu.Unlock()
+	if checkpoints == nil {
+		return 0, ErrCheckpointingDisabled
+	}
+	id, err := checkpoints.trigger()
+	if err != nil {
+		return 0, fmt.Errorf("checkpoint: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+)
+
+// ErrInvalidPlan is returned by Swap for a plan that fails validation or
+// cannot replace the running one.
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// PlanDiff lists how the operators of a new plan differ from the running one.
+type PlanDiff struct {
+	// Added operators are new to the plan and start empty.
+	Added []string `json:"added"`
+	// Removed operators are dropped along with their state.
+	Removed []string `json:"removed"`
+	// Reset operators keep their ID but changed their type, configuration,
+	// input schema or parallelism, so their state no longer applies and they
+	// start empty. State is restored by instance index and never redistributed
+	// by key, hence the parallelism; partitioned sources, whose instances are
+	// all given every position, are kept at any parallelism.
+	Reset []string `json:"reset"`
+	// Kept operators carry their state over, even if e.g. their name changed.
+	Kept []string `json:"kept"`
+}
+
+// DiffPlans compares the operators of two plans by ID. It cannot tell which
+// operators are partitioned sources, so it resets every operator whose
+// parallelism changed; Swap keeps partitioned sources.
+func DiffPlans(old, new *pb.ExecutionPlan) *PlanDiff {
+	return diffPlans(old, new, func(string) bool { return false })
+}
+
+// diffPlans is DiffPlans keeping the operators rescalable reports to restore
+// their state at any parallelism.
+func diffPlans(old, new *pb.ExecutionPlan, rescalable func(id string) bool) *PlanDiff {
+	diff := &PlanDiff{Added: []string{}, Removed: []string{}, Reset: []string{}, Kept: []string{}}
+	before := make(map[string]*pb.OperatorNode, len(old.Operators))
+	for _, op := range old.Operators {
+		before[op.Id] = op
+	}
+	for _, op := range new.Operators {
+		prev, ok := before[op.Id]
+		delete(before, op.Id)
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, op.Id)
+		case !sameState(prev, op),
+			operatorParallelism(old, prev) != operatorParallelism(new, op) && !rescalable(op.Id):
+			diff.Reset = append(diff.Reset, op.Id)
+		default:
+			diff.Kept = append(diff.Kept, op.Id)
+		}
+	}
+	for _, op := range old.Operators {
+		if _, ok := before[op.Id]; ok {
+			diff.Removed = append(diff.Removed, op.Id)
+		}
+	}
+	return diff
+}
+
+// sameState reports whether state written by one version of an operator can
+// be restored by another: both must agree on everything but their name,
+// parallelism, output schema and presentation. DiffPlans compares the
+// parallelism each plan gives them separately.
+func sameState(a, b *pb.OperatorNode) bool {
+	strip := func(node *pb.OperatorNode) *pb.OperatorNode {
+		node = proto.Clone(node).(*pb.OperatorNode)
+		node.Name = ""
+		node.Parallelism = 0
+		node.OutputSchema = nil
+		node.SourceLocation = nil
+		node.ExecutionStrategy = pb.ExecutionStrategy(0)
+		return node
+	}
+	return proto.Equal(strip(a), strip(b))
+}
+
+// planSwap is a plan waiting to replace the running one once its run stops.
+type planSwap struct {
+	plan *pb.ExecutionPlan
+	diff *PlanDiff
+	// checkpoint is the checkpoint the running plan was drained to.
+	checkpoint string
+}
+
+// Swap replaces the running plan with plan without losing data: the
+// pipeline is drained to a checkpoint barrier, with sources holding back
+// everything after it, then restarted with plan from that checkpoint.
+// Operators whose state still applies carry it over; see DiffPlans.
+//
+// Swap returns once the running plan is drained; the new plan starts
+// asynchronously. It requires the running plan to enable checkpointing.
+func (e *Engine) Swap(plan *pb.ExecutionPlan) (*PlanDiff, error) {
+	if err := ValidatePlan(plan); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPlan, err)
+	}
+	e.stateMu.Lock()
+	running, checkpoints, instances := e.plan, e.checkpoints, e.instances
+	e.stateMu.Unlock()
+	if plan.PipelineName != running.PipelineName {
+		return nil, fmt.Errorf("%w: pipeline name changed from %q to %q", ErrInvalidPlan, running.PipelineName, plan.PipelineName)
+	}
+	if plan.Checkpoint.GetInterval() == "" {
+		return nil, fmt.Errorf("%w: checkpointing must stay enabled", ErrInvalidPlan)
+	}
+	if checkpoints == nil {
+		return nil, ErrCheckpointingDisabled
+	}
+	diff := diffPlans(running, plan, func(id string) bool { return rescalable(instances[id]) })
+	if proto.Equal(running, plan) {
+		return diff, nil
+	}
+
+	req := &checkpointRequest{drain: true, done: make(chan error, 1)}
+	id, err := checkpoints.start(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := <-req.done; err != nil {
+		return nil, fmt.Errorf("drain: %w", err)
+	}
+
+	e.logger.Info("swapping plan", "checkpoint", id,
+		"added", diff.Added, "removed", diff.Removed, "reset", diff.Reset)
+	e.stateMu.Lock()
+	e.swap = &planSwap{
+		plan:       plan,
+		diff:       diff,
+		checkpoint: filepath.Join(checkpoints.dir, checkpointDirName(id)),
+	}
+	e.stateMu.Unlock()
+	e.failMu.Lock()
+	e.cancelRun()
+	e.failMu.Unlock()
+	return diff, nil
+}
+
+// takeSwap returns the plan swap requested during the last run, if any.
+func (e *Engine) takeSwap() *planSwap {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	swap := e.swap
+	e.swap = nil
+	return swap
+}
+
+// applySwap makes the swap's plan the running one. The state of removed and
+// reset operators is deleted from the drained checkpoint, which the next run
+// restores as the latest checkpoint.
+func (e *Engine) applySwap(swap *planSwap) error {
+	entries, err := os.ReadDir(swap.checkpoint)
+	if err != nil {
+		return fmt.Errorf("swap: %w", err)
+	}
+	drop := slices.Concat(swap.diff.Removed, swap.diff.Reset)
+	for _, entry := range entries {
+		if id, ok := instanceDirOperator(entry.Name()); ok && slices.Contains(drop, id) {
+			if err := os.RemoveAll(filepath.Join(swap.checkpoint, entry.Name())); err != nil {
+				return fmt.Errorf("swap: %w", err)
+			}
+		}
+	}
+
+	e.stateMu.Lock()
+	e.plan = swap.plan
+	e.stateMu.Unlock()
+	e.logger.Info("plan swapped", "operators", len(swap.plan.Operators), "edges", len(swap.plan.Edges))
+	return nil
+}
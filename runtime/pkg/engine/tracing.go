@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the engine's spans.
+const tracerName = "github.com/sandboxws/isotope/runtime/pkg/engine"
+
+// Span attributes.
+const (
+	attrOperatorID   = attribute.Key("isotope.operator.id")
+	attrOperatorName = attribute.Key("isotope.operator.name")
+	attrInstance     = attribute.Key("isotope.operator.instance")
+	attrRowsIn       = attribute.Key("isotope.rows.in")
+	attrRowsOut      = attribute.Key("isotope.rows.out")
+)
+
+// SetTracerProvider sets the provider of the spans that trace batches through
+// the DAG. It defaults to the global provider, which records nothing unless
+// one is installed with otel.SetTracerProvider.
+//
+// Whether a batch is traced is decided by the provider's sampler when a
+// source emits it. Every operator and sink that processes a traced batch, or
+// what an upstream operator made of it, records a child span with its rows in
+// and out.
+func (e *Engine) SetTracerProvider(tp trace.TracerProvider) {
+	e.tracer = tp.Tracer(tracerName)
+}
+
+// traceSource starts the root span of a batch emitted by a source instance,
+// or returns nil if the batch is not sampled. Batches the instance emits
+// carry the span until endTrace.
+func (e *Engine) traceSource(inst *operatorInstance, batch arrow.Record) trace.Span {
+	_, span := e.tracer.Start(context.Background(), inst.node.Id,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(operatorAttributes(inst)...),
+		trace.WithAttributes(attrRowsIn.Int64(0)),
+	)
+	if !span.SpanContext().IsSampled() {
+		span.End()
+		inst.trace = trace.SpanContext{}
+		return nil
+	}
+	inst.trace = span.SpanContext()
+	return span
+}
+
+// traceBatch starts the span of an instance processing a batch that is part
+// of the trace parent, or returns nil if the batch is not traced.
+func (e *Engine) traceBatch(inst *operatorInstance, parent trace.SpanContext, rowsIn int64) trace.Span {
+	if !parent.IsSampled() {
+		return nil
+	}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	_, span := e.tracer.Start(ctx, inst.node.Id,
+		trace.WithAttributes(operatorAttributes(inst)...),
+		trace.WithAttributes(attrRowsIn.Int64(rowsIn)),
+	)
+	return span
+}
+
+// endTrace ends the span of an instance, if any, with the rows it produced
+// and the error it failed with. Batches the instance emits next carry the span.
+func (inst *operatorInstance) endTrace(span trace.Span, rowsOut int64, err error) {
+	if span == nil {
+		inst.trace = trace.SpanContext{}
+		return
+	}
+	span.SetAttributes(attrRowsOut.Int64(rowsOut))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	inst.trace = span.SpanContext()
+}
+
+func operatorAttributes(inst *operatorInstance) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attrOperatorID.String(inst.node.Id),
+		attrOperatorName.String(inst.node.Name),
+		attrInstance.Int(inst.index),
+	}
+}
+
+func totalRows(batches []arrow.Record) int64 {
+	var n int64
+	for _, b := range batches {
+		n += b.NumRows()
+	}
+	return n
+}
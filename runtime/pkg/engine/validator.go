@@ -2,9 +2,12 @@ package engine
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
 )
 
 // ValidatePlan checks the execution plan for structural integrity.
@@ -52,6 +55,46 @@ func ValidatePlan(plan *pb.ExecutionPlan) error {
 		return err
 	}
 
+	// Validate that each edge can be partitioned across parallel instances.
+	if err := validatePartitioning(plan, operatorIDs); err != nil {
+		return err
+	}
+
+	// Validate that route targets are wired as downstream edges.
+	if err := validateRoutes(plan); err != nil {
+		return err
+	}
+
+	// Validate that aggregates emit a changelog their consumers can apply.
+	if err := validateAggregates(plan); err != nil {
+		return err
+	}
+
+	// Validate that source watermarks can be derived.
+	if err := validateWatermarks(plan); err != nil {
+		return err
+	}
+
+	// Validate the checkpoint interval and mode.
+	if err := validateCheckpoint(plan.Checkpoint); err != nil {
+		return err
+	}
+
+	// Validate the state backend and TTLs.
+	if err := validateState(plan); err != nil {
+		return err
+	}
+
+	// Validate that a batch pipeline only reads bounded sources.
+	if err := validateBatchMode(plan); err != nil {
+		return err
+	}
+
+	// Validate the restart strategy.
+	if _, err := newRestartStrategy(plan.Restart); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -131,6 +174,119 @@ func validateSchemaConsistency(plan *pb.ExecutionPlan, ops map[string]*pb.Operat
 	return nil
 }
 
+// validatePartitioning checks that each edge's shuffle strategy can connect the
+// parallel instances on both sides, and that a parallel aggregate sees every
+// row of a group in the same instance.
+func validatePartitioning(plan *pb.ExecutionPlan, ops map[string]*pb.OperatorNode) error {
+	for i, edge := range plan.Edges {
+		if err := validateAggregateInput(plan, edge, ops[edge.ToOperator]); err != nil {
+			return fmt.Errorf("edge[%d] (%s -> %s): %w", i, edge.FromOperator, edge.ToOperator, err)
+		}
+		switch edge.Shuffle {
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH, pb.ShuffleStrategy_SHUFFLE_STRATEGY_RANGE:
+			if len(edge.PartitionKeys) == 0 {
+				return fmt.Errorf("edge[%d] (%s -> %s): %s shuffle requires partition_keys",
+					i, edge.FromOperator, edge.ToOperator, edge.Shuffle)
+			}
+			continue
+		case pb.ShuffleStrategy_SHUFFLE_STRATEGY_BROADCAST, pb.ShuffleStrategy_SHUFFLE_STRATEGY_ROUND_ROBIN:
+			continue
+		}
+
+		// Forward edges connect instance i to instance i, so both sides must match.
+		fromP := operatorParallelism(plan, ops[edge.FromOperator])
+		toP := operatorParallelism(plan, ops[edge.ToOperator])
+		if fromP != toP {
+			return fmt.Errorf("edge[%d] (%s -> %s): %s shuffle requires equal parallelism, got %d and %d",
+				i, edge.FromOperator, edge.ToOperator, edge.Shuffle, fromP, toP)
+		}
+	}
+	return nil
+}
+
+// validateAggregateInput checks an edge into an aggregate: with more than one
+// instance, it must hash partition on a subset of the group_by columns so that
+// each group is folded by one instance.
+func validateAggregateInput(plan *pb.ExecutionPlan, edge *pb.Edge, to *pb.OperatorNode) error {
+	cfg := to.GetAggregate()
+	if cfg == nil || operatorParallelism(plan, to) == 1 {
+		return nil
+	}
+	if edge.Shuffle != pb.ShuffleStrategy_SHUFFLE_STRATEGY_HASH || len(edge.PartitionKeys) == 0 {
+		return fmt.Errorf("aggregate with parallelism %d requires a HASH shuffle on its group_by columns",
+			operatorParallelism(plan, to))
+	}
+	for _, key := range edge.PartitionKeys {
+		if !slices.Contains(cfg.GroupBy, key) {
+			return fmt.Errorf("partition key %q is not a group_by column of the aggregate", key)
+		}
+	}
+	return nil
+}
+
+// validateAggregates checks that no aggregate is asked for an append-only
+// changelog. Its results change as rows arrive, so every update would be
+// another insert, and an append-only consumer would count each group once
+// per update.
+func validateAggregates(plan *pb.ExecutionPlan) error {
+	for _, op := range plan.Operators {
+		if op.GetAggregate() != nil && op.ChangelogMode == pb.ChangelogMode_CHANGELOG_MODE_APPEND_ONLY {
+			return fmt.Errorf("operator %s: a GROUP BY aggregate updates its results and cannot emit an append-only changelog; use retract or upsert", op.Id)
+		}
+	}
+	return nil
+}
+
+// validateRoutes checks that every Route branch target and default operator is
+// a downstream edge of the route, that the default operator is not also a
+// branch target, and that the route has no other edges.
+func validateRoutes(plan *pb.ExecutionPlan) error {
+	downstream := make(map[string]map[string]bool)
+	for _, edge := range plan.Edges {
+		if downstream[edge.FromOperator] == nil {
+			downstream[edge.FromOperator] = make(map[string]bool)
+		}
+		downstream[edge.FromOperator][edge.ToOperator] = true
+	}
+
+	for _, op := range plan.Operators {
+		cfg := op.GetRoute()
+		if cfg == nil {
+			continue
+		}
+
+		targets := make(map[string]bool)
+		for i, branch := range cfg.Branches {
+			if !downstream[op.Id][branch.TargetOperator] {
+				return fmt.Errorf("route %q: branch[%d] target %q is not a downstream edge",
+					op.Id, i, branch.TargetOperator)
+			}
+			targets[branch.TargetOperator] = true
+		}
+		if cfg.DefaultOperator != "" {
+			if !downstream[op.Id][cfg.DefaultOperator] {
+				return fmt.Errorf("route %q: default operator %q is not a downstream edge",
+					op.Id, cfg.DefaultOperator)
+			}
+			// Unmatched rows leave on the regular outputs, which a branch
+			// target no longer has.
+			if targets[cfg.DefaultOperator] {
+				return fmt.Errorf("route %q: default operator %q is also a branch target",
+					op.Id, cfg.DefaultOperator)
+			}
+			targets[cfg.DefaultOperator] = true
+		}
+
+		for to := range downstream[op.Id] {
+			if !targets[to] {
+				return fmt.Errorf("route %q: edge to %q is neither a branch target nor the default operator",
+					op.Id, to)
+			}
+		}
+	}
+	return nil
+}
+
 // schemasCompatible checks if two schemas are compatible (same fields in same order with compatible types).
 func schemasCompatible(output, input *pb.Schema) error {
 	if len(output.Fields) != len(input.Fields) {
@@ -152,3 +308,87 @@ func schemasCompatible(output, input *pb.Schema) error {
 
 	return nil
 }
+
+// validateWatermarks checks that every source watermark names a schema column
+// and uses an expression the engine can evaluate.
+func validateWatermarks(plan *pb.ExecutionPlan) error {
+	for _, op := range plan.Operators {
+		schema := sourceSchema(op)
+		wm := schema.GetWatermark()
+		if wm == nil || wm.Column == "" {
+			continue
+		}
+		found := false
+		for _, f := range schema.Fields {
+			if f.Name == wm.Column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("operator %q: watermark column %q is not in the schema", op.Id, wm.Column)
+		}
+		if _, err := parseWatermark(wm); err != nil {
+			return fmt.Errorf("operator %q: %w", op.Id, err)
+		}
+	}
+	return nil
+}
+
+// validateCheckpoint checks that an enabled checkpoint config has a positive
+// interval and a known mode.
+func validateCheckpoint(cfg *pb.CheckpointConfig) error {
+	if cfg == nil || cfg.Interval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return fmt.Errorf("checkpoint: invalid interval %q: %w", cfg.Interval, err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("checkpoint: interval must be positive, got %s", cfg.Interval)
+	}
+	switch cfg.Mode {
+	case "", checkpointModeExactlyOnce, checkpointModeAtLeastOnce:
+		return nil
+	default:
+		return fmt.Errorf("checkpoint: unknown mode %q, expected %q or %q",
+			cfg.Mode, checkpointModeExactlyOnce, checkpointModeAtLeastOnce)
+	}
+}
+
+// validateState checks that the state config names a known backend and that
+// every state TTL, the plan's and each hash join's, is at least a millisecond.
+func validateState(plan *pb.ExecutionPlan) error {
+	if backend := plan.State.GetBackend(); !state.ValidBackend(backend) {
+		return fmt.Errorf("state: unknown backend %q, expected %q or %q", backend, state.BackendPebble, state.BackendMemory)
+	}
+	if _, err := stateTTL(plan, &pb.OperatorNode{}); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	for _, op := range plan.Operators {
+		if _, err := stateTTL(plan, op); err != nil {
+			return fmt.Errorf("operator %q: %w", op.Id, err)
+		}
+	}
+	return nil
+}
+
+// validateBatchMode checks that every source of a batch-mode plan ends on its
+// own: a generator needs max_rows, and Kafka topics are unbounded.
+func validateBatchMode(plan *pb.ExecutionPlan) error {
+	if plan.Mode != pb.PipelineMode_PIPELINE_MODE_BATCH {
+		return nil
+	}
+	for _, op := range plan.Operators {
+		switch op.OperatorType {
+		case pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE:
+			if op.GetGeneratorSource().GetMaxRows() <= 0 {
+				return fmt.Errorf("operator %s: batch mode requires bounded sources, set max_rows on the generator", op.Id)
+			}
+		case pb.OperatorType_OPERATOR_TYPE_KAFKA_SOURCE:
+			return fmt.Errorf("operator %s: batch mode requires bounded sources, kafka sources are unbounded", op.Id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+
+	pb "github.com/sandboxws/isotope/runtime/internal/proto/isotope/v1"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+)
+
+// watermarkExpr matches the bounded-out-of-orderness form of a watermark
+// expression, e.g. "ts - INTERVAL '5' SECOND".
+var watermarkExpr = regexp.MustCompile(`(?i)^\s*(\w+)\s*(?:-\s*INTERVAL\s+'(\d+(?:\.\d+)?)'\s+(\w+))?\s*$`)
+
+// intervalUnits maps SQL interval units to durations.
+var intervalUnits = map[string]time.Duration{
+	"MILLISECOND": time.Millisecond,
+	"SECOND":      time.Second,
+	"MINUTE":      time.Minute,
+	"HOUR":        time.Hour,
+	"DAY":         24 * time.Hour,
+}
+
+// parseWatermark returns the out-of-orderness delay of a watermark on column.
+// An empty expression means the column itself, i.e. no delay.
+func parseWatermark(cfg *pb.WatermarkConfig) (time.Duration, error) {
+	if cfg.Expression == "" {
+		return 0, nil
+	}
+	m := watermarkExpr.FindStringSubmatch(cfg.Expression)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported watermark expression %q, expected \"%s - INTERVAL 'n' UNIT\"",
+			cfg.Expression, cfg.Column)
+	}
+	if !strings.EqualFold(m[1], cfg.Column) {
+		return 0, fmt.Errorf("watermark expression %q does not reference column %q", cfg.Expression, cfg.Column)
+	}
+	if m[2] == "" {
+		return 0, nil
+	}
+
+	unit, ok := intervalUnits[strings.TrimSuffix(strings.ToUpper(m[3]), "S")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported interval unit %q in watermark expression", m[3])
+	}
+	amount, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q in watermark expression: %w", m[2], err)
+	}
+	return time.Duration(amount * float64(unit)), nil
+}
+
+// sourceSchema returns the schema a source node produces, preferring the
+// schema in its connector config. It returns nil for other operators.
+func sourceSchema(node *pb.OperatorNode) *pb.Schema {
+	var schema *pb.Schema
+	switch node.OperatorType {
+	case pb.OperatorType_OPERATOR_TYPE_KAFKA_SOURCE:
+		schema = node.GetKafkaSource().GetSchema()
+	case pb.OperatorType_OPERATOR_TYPE_GENERATOR_SOURCE:
+		schema = node.GetGeneratorSource().GetSchema()
+	default:
+		return nil
+	}
+	if schema == nil {
+		schema = node.OutputSchema
+	}
+	return schema
+}
+
+// watermarkGenerator derives watermarks from the batches a source emits: the
+// highest event time seen so far minus the configured delay.
+type watermarkGenerator struct {
+	column  string
+	delay   int64 // milliseconds
+	maxSeen int64
+	current int64
+}
+
+// newWatermarkGenerator returns a generator for the source node, or nil if
+// its schema declares no watermark.
+func newWatermarkGenerator(node *pb.OperatorNode) (*watermarkGenerator, error) {
+	cfg := sourceSchema(node).GetWatermark()
+	if cfg == nil || cfg.Column == "" {
+		return nil, nil
+	}
+	delay, err := parseWatermark(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &watermarkGenerator{
+		column:  cfg.Column,
+		delay:   delay.Milliseconds(),
+		maxSeen: math.MinInt64,
+		current: math.MinInt64,
+	}, nil
+}
+
+// observe updates the generator with batch and returns the new watermark if
+// it advanced.
+func (g *watermarkGenerator) observe(batch arrow.Record) (operator.Watermark, bool, error) {
+	indices := batch.Schema().FieldIndices(g.column)
+	if len(indices) == 0 {
+		return operator.Watermark{}, false, fmt.Errorf("watermark column %q not found", g.column)
+	}
+	ts, ok, err := maxEventTime(batch.Column(indices[0]))
+	if err != nil || !ok {
+		return operator.Watermark{}, false, err
+	}
+	g.maxSeen = max(g.maxSeen, ts)
+
+	wm := g.maxSeen - g.delay
+	if wm <= g.current {
+		return operator.Watermark{}, false, nil
+	}
+	g.current = wm
+	return operator.Watermark{Timestamp: wm}, true, nil
+}
+
+// maxEventTime returns the largest non-null event time in col in milliseconds
+// since epoch.
+func maxEventTime(col arrow.Array) (int64, bool, error) {
+	toMillis, err := eventTimes(col)
+	if err != nil {
+		return 0, false, err
+	}
+
+	found := false
+	var highest int64
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		if ts := toMillis(i); !found || ts > highest {
+			highest, found = ts, true
+		}
+	}
+	return highest, found, nil
+}
+
+// eventTimes returns a function reading the event time of a row of col in
+// milliseconds since epoch. Integer columns are taken to already hold
+// milliseconds.
+func eventTimes(col arrow.Array) (func(i int) int64, error) {
+	switch arr := col.(type) {
+	case *array.Timestamp:
+		toTime, err := arr.DataType().(*arrow.TimestampType).GetToTimeFunc()
+		if err != nil {
+			return nil, err
+		}
+		return func(i int) int64 { return toTime(arr.Value(i)).UnixMilli() }, nil
+	case *array.Date64:
+		return func(i int) int64 { return int64(arr.Value(i)) }, nil
+	case *array.Int64:
+		return arr.Value, nil
+	default:
+		return nil, fmt.Errorf("unsupported watermark column type %s", col.DataType())
+	}
+}
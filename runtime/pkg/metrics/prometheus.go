@@ -3,6 +3,9 @@ package metrics
 
 import (
 	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -32,7 +35,63 @@ var (
 	// Errors counts errors by operator.
 	Errors = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "isotope_errors_total",
-		Help: "Total number of errors by operator",
+		Help: "Total number of errors by operator, counting a failed batch once",
+	}, []string{"operator_id", "operator_name"})
+
+	// Restarts counts pipeline restarts by the operator whose failure caused
+	// them and the phase it failed in.
+	Restarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isotope_restarts_total",
+		Help: "Total number of pipeline restarts after an operator failure",
+	}, []string{"pipeline", "operator_id", "reason"})
+
+	// EdgeQueueDepth is the number of batches queued on each edge, summed over
+	// the downstream instances.
+	EdgeQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "isotope_edge_queue_depth",
+		Help: "Number of batches queued on an edge",
+	}, []string{"from_operator", "to_operator"})
+
+	// EdgeRowsInFlight is the number of rows in the batches queued on each edge.
+	EdgeRowsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "isotope_edge_rows_in_flight",
+		Help: "Number of rows queued on an edge",
+	}, []string{"from_operator", "to_operator"})
+
+	// EdgeBytesInFlight is the size of the batches queued on each edge.
+	EdgeBytesInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "isotope_edge_bytes_in_flight",
+		Help: "Bytes of batches queued on an edge",
+	}, []string{"from_operator", "to_operator"})
+
+	// EdgeSendBlocked tracks how long sending a batch on each edge blocked
+	// because the downstream operator was not keeping up.
+	EdgeSendBlocked = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isotope_edge_send_blocked_seconds",
+		Help:    "Time spent blocked sending a batch on an edge in seconds, for sends that had to wait",
+		Buckets: []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1.0, 10.0},
+	}, []string{"from_operator", "to_operator"})
+
+	// WatermarkLag is how far each operator's watermark, the lowest across its
+	// instances, trails wall-clock time.
+	WatermarkLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "isotope_watermark_lag_seconds",
+		Help: "Wall-clock time minus the operator's current watermark in seconds",
+	}, []string{"operator_id", "operator_name"})
+
+	// SinkEventTimeLag tracks, per row written by each sink, how far the row's
+	// event time trails wall-clock time.
+	SinkEventTimeLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "isotope_sink_event_time_lag_seconds",
+		Help:    "Wall-clock time minus the event time of rows written by a sink in seconds",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"operator_id", "operator_name"})
+
+	// StateExpiredEntries counts keyed state entries dropped because their
+	// TTL ran out, whether found on read or swept in the background.
+	StateExpiredEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "isotope_state_expired_entries_total",
+		Help: "Total number of keyed state entries dropped after their TTL expired",
 	}, []string{"operator_id", "operator_name"})
 
 	// GCPauseSummary tracks GC pause durations.
@@ -55,3 +114,28 @@ func ServeMetrics(addr string) *http.Server {
 	go server.ListenAndServe()
 	return server
 }
+
+var gcSampler sync.Once
+
+// SampleGCPauses starts observing the pause of every garbage collection into
+// GCPauseSummary, checking for new collections every interval. Pauses are
+// process-wide, so only the first call starts a sampler; later calls do
+// nothing.
+func SampleGCPauses(interval time.Duration) {
+	gcSampler.Do(func() {
+		go func() {
+			var stats debug.GCStats
+			debug.ReadGCStats(&stats)
+			last := stats.NumGC
+			for range time.Tick(interval) {
+				debug.ReadGCStats(&stats)
+				// stats.Pause holds the most recent pauses first.
+				n := min(stats.NumGC-last, int64(len(stats.Pause)))
+				for _, pause := range stats.Pause[:n] {
+					GCPauseSummary.Observe(pause.Seconds())
+				}
+				last = stats.NumGC
+			}
+		}()
+	})
+}
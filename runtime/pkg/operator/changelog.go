@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// RowKind is the change a row of a changelog stream makes to the result it
+// describes.
+type RowKind int8
+
+const (
+	// Insert (+I) adds a row.
+	Insert RowKind = iota
+	// UpdateBefore (-U) retracts the previous version of an updated row.
+	UpdateBefore
+	// UpdateAfter (+U) is the new version of an updated row.
+	UpdateAfter
+	// Delete (-D) removes a row.
+	Delete
+)
+
+// RowKindColumn is the reserved Int8 column that holds the RowKind of every
+// row of a batch. A batch without it holds only inserts, so append-only
+// streams never carry it. Operators that reshape batches keep it as it is,
+// and operators that rebuild them carry it through.
+const RowKindColumn = "__op"
+
+func (k RowKind) String() string {
+	switch k {
+	case Insert:
+		return "+I"
+	case UpdateBefore:
+		return "-U"
+	case UpdateAfter:
+		return "+U"
+	case Delete:
+		return "-D"
+	default:
+		return "?"
+	}
+}
+
+// RowKinds returns the row kind column of batch, or nil if the batch holds
+// only inserts.
+func RowKinds(batch arrow.Record) (*array.Int8, error) {
+	idx := batch.Schema().FieldIndices(RowKindColumn)
+	if len(idx) == 0 {
+		return nil, nil
+	}
+	kinds, ok := batch.Column(idx[0]).(*array.Int8)
+	if !ok {
+		return nil, fmt.Errorf("row kind column %s is %s, not int8", RowKindColumn, batch.Column(idx[0]).DataType())
+	}
+	return kinds, nil
+}
+
+// RowKindAt returns the kind of a row given the column RowKinds returned.
+func RowKindAt(kinds *array.Int8, row int) RowKind {
+	if kinds == nil || kinds.IsNull(row) {
+		return Insert
+	}
+	return RowKind(kinds.Value(row))
+}
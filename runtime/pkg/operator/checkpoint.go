@@ -0,0 +1,38 @@
+package operator
+
+// CheckpointTrigger asks a running CheckpointedSource to mark its position in
+// the stream for a checkpoint. The engine injects the checkpoint barrier right
+// after the last batch the source sent before calling Ack.
+type CheckpointTrigger struct {
+	CheckpointID int64
+
+	acked    chan struct{}
+	released chan struct{}
+}
+
+// NewCheckpointTrigger creates a trigger for the given checkpoint.
+func NewCheckpointTrigger(checkpointID int64) *CheckpointTrigger {
+	return &CheckpointTrigger{
+		CheckpointID: checkpointID,
+		acked:        make(chan struct{}),
+		released:     make(chan struct{}),
+	}
+}
+
+// Ack is called by the source between batches. It blocks until the engine has
+// snapshotted the source's position, so the source must not be sending at the
+// same time.
+func (t *CheckpointTrigger) Ack() {
+	t.acked <- struct{}{}
+	<-t.released
+}
+
+// Acked is ready once the source calls Ack.
+func (t *CheckpointTrigger) Acked() <-chan struct{} {
+	return t.acked
+}
+
+// Release lets a source blocked in Ack resume.
+func (t *CheckpointTrigger) Release() {
+	close(t.released)
+}
@@ -4,15 +4,63 @@ import (
 	"context"
 	"log/slog"
 	"sync/atomic"
+	"time"
 
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sandboxws/isotope/runtime/pkg/metrics"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
 )
 
-// Metrics tracks basic operator-level metrics.
+// Metrics tracks basic operator-level metrics. Metrics created by NewMetrics
+// also update the operator's series in the Prometheus registry; use AddBatch
+// and AddError rather than the counters directly so that they do.
 type Metrics struct {
 	BatchesProcessed atomic.Int64
 	RowsProcessed    atomic.Int64
 	Errors           atomic.Int64
+
+	batches prometheus.Counter
+	rows    prometheus.Counter
+	errors  prometheus.Counter
+	latency prometheus.Observer
+}
+
+// NewMetrics creates the metrics of an operator, labelled with its ID and name.
+func NewMetrics(operatorID, operatorName string) *Metrics {
+	return &Metrics{
+		batches: metrics.BatchesProcessed.WithLabelValues(operatorID, operatorName),
+		rows:    metrics.RowsProcessed.WithLabelValues(operatorID, operatorName),
+		errors:  metrics.Errors.WithLabelValues(operatorID, operatorName),
+		latency: metrics.BatchLatency.WithLabelValues(operatorID, operatorName),
+	}
+}
+
+// AddBatch counts a batch of rows produced or consumed by the operator.
+func (m *Metrics) AddBatch(rows int64) {
+	m.BatchesProcessed.Add(1)
+	m.RowsProcessed.Add(rows)
+	if m.batches != nil {
+		m.batches.Inc()
+		m.rows.Add(float64(rows))
+	}
+}
+
+// ObserveBatch counts a batch of rows and records how long processing it took.
+func (m *Metrics) ObserveBatch(rows int64, latency time.Duration) {
+	m.AddBatch(rows)
+	if m.latency != nil {
+		m.latency.Observe(latency.Seconds())
+	}
+}
+
+// AddError counts an error of the operator.
+func (m *Metrics) AddError() {
+	m.Errors.Add(1)
+	if m.errors != nil {
+		m.errors.Inc()
+	}
 }
 
 // Context provides the execution environment for an operator.
@@ -40,6 +88,20 @@ type Context struct {
 
 	// InstanceIndex is the index of this parallel instance (0-based).
 	InstanceIndex int
+
+	// Checkpoints delivers checkpoint triggers to a CheckpointedSource. It is
+	// nil, and so never ready, for other operators or when checkpointing is off.
+	Checkpoints <-chan *CheckpointTrigger
+
+	// DeadLetters receives records the operator could not process; see
+	// DeadLetter. It is nil when the pipeline has no dead-letter queue.
+	DeadLetters DeadLetterQueue
+
+	// State is the keyed state of this instance; see state.NewValue,
+	// state.NewList and state.NewMap. The engine snapshots it on every
+	// checkpoint barrier, after ProcessCheckpointBarrier, and restores it
+	// before the first batch.
+	State *state.Store
 }
 
 // NewContext creates a new operator context with defaults.
@@ -47,11 +109,12 @@ func NewContext(ctx context.Context, alloc memory.Allocator, operatorID, operato
 	return &Context{
 		Ctx:          ctx,
 		Logger:       slog.Default().With("operator", operatorID, "name", operatorName),
-		Metrics:      &Metrics{},
+		Metrics:      NewMetrics(operatorID, operatorName),
 		Alloc:        alloc,
 		OperatorID:   operatorID,
 		OperatorName: operatorName,
 		Parallelism:  1,
+		State:        state.NewMemoryStore(),
 	}
 }
 
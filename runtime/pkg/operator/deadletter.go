@@ -0,0 +1,52 @@
+package operator
+
+import "time"
+
+// DeadLetter is a record an operator could not process, kept so that it can
+// be audited and replayed.
+type DeadLetter struct {
+	OperatorID string    `json:"operator_id"`
+	Instance   int       `json:"instance"`
+	Error      string    `json:"error"`
+	Payload    []byte    `json:"payload"` // the original record, e.g. a Kafka value or a row as JSON; base64 in JSON
+	Time       time.Time `json:"time"`
+}
+
+// DeadLetterQueue receives the records operators could not process. It is
+// shared by every operator instance, so implementations must be safe for
+// concurrent use.
+type DeadLetterQueue interface {
+	Send(letter DeadLetter) error
+	Close() error
+}
+
+// DeadLetter hands a record this operator could not process to the pipeline's
+// dead-letter queue, counting one error. Without a queue, the record is
+// logged and dropped.
+func (c *Context) DeadLetter(payload []byte, err error) {
+	c.DeadLetterBatch([][]byte{payload}, err)
+}
+
+// DeadLetterBatch is DeadLetter for the records of a batch that failed as a
+// whole: each gets its own letter, but the failure counts as one error, as
+// it does under the other error policies.
+func (c *Context) DeadLetterBatch(payloads [][]byte, err error) {
+	c.Metrics.AddError()
+	if c.DeadLetters == nil {
+		c.Logger.Error("records dropped", "records", len(payloads), "error", err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, payload := range payloads {
+		letter := DeadLetter{
+			OperatorID: c.OperatorID,
+			Instance:   c.InstanceIndex,
+			Error:      err.Error(),
+			Payload:    payload,
+			Time:       now,
+		}
+		if sendErr := c.DeadLetters.Send(letter); sendErr != nil {
+			c.Logger.Error("dead letter lost", "error", err, "send_error", sendErr)
+		}
+	}
+}
@@ -13,6 +13,9 @@ type Watermark struct {
 // CheckpointBarrier signals that a checkpoint should be taken.
 type CheckpointBarrier struct {
 	CheckpointID int64
+	// Dir is the directory this operator instance snapshots its state into.
+	// It exists by the time the barrier is delivered.
+	Dir string
 }
 
 // Operator is the core interface for all stream operators.
@@ -26,8 +29,10 @@ type Operator interface {
 	// The caller is responsible for releasing the input batch after this returns.
 	ProcessBatch(batch arrow.Record) ([]arrow.Record, error)
 
-	// ProcessWatermark handles an advancing watermark.
-	ProcessWatermark(wm Watermark) error
+	// ProcessWatermark handles an advancing watermark, the minimum across all
+	// inputs. It may return output batches, e.g. windows the watermark closes;
+	// the engine emits them before forwarding the watermark downstream.
+	ProcessWatermark(wm Watermark) ([]arrow.Record, error)
 
 	// ProcessCheckpointBarrier handles a checkpoint barrier.
 	ProcessCheckpointBarrier(barrier CheckpointBarrier) error
@@ -36,6 +41,48 @@ type Operator interface {
 	Close() error
 }
 
+// RestorableOperator is implemented by operators whose state survives a
+// restart. The engine calls RestoreState after Open and before any input when
+// a pipeline resumes from a checkpoint.
+type RestorableOperator interface {
+	Operator
+
+	// RestoreState loads the state ProcessCheckpointBarrier wrote to dir.
+	RestoreState(dir string) error
+}
+
+// MultiInputOperator is implemented by operators that need to know which input a
+// batch arrived on, such as joins. Inputs are numbered in the order their edges
+// appear in the plan. The engine calls ProcessBatchFrom instead of ProcessBatch.
+type MultiInputOperator interface {
+	Operator
+
+	// ProcessBatchFrom processes one batch that arrived on the given input.
+	// The same ownership rules as ProcessBatch apply.
+	ProcessBatchFrom(input int, batch arrow.Record) ([]arrow.Record, error)
+
+	// EndInput is called once the given input has delivered its last batch.
+	// It may return output batches, e.g. unmatched rows of an outer join.
+	EndInput(input int) ([]arrow.Record, error)
+}
+
+// MultiOutputOperator is implemented by operators that send rows to specific
+// downstream operators instead of all of them, such as Route. Before Open, the
+// engine calls SetOutput once per target returned by OutputTargets. Batches
+// returned from ProcessBatch go to the remaining downstream edges.
+type MultiOutputOperator interface {
+	Operator
+
+	// OutputTargets returns the IDs of the downstream operators fed through
+	// SetOutput. An ID may repeat, e.g. once per Route branch that targets it.
+	OutputTargets() []string
+
+	// SetOutput sets the channel for batches addressed to target. The engine
+	// drains it after every ProcessBatch call, so an operator must not send
+	// more than len(OutputTargets()) batches on it per call.
+	SetOutput(target string, out chan<- arrow.Record)
+}
+
 // Source is a specialization of Operator for source connectors that produce data.
 // Sources run in their own goroutine and push batches to the output channel.
 type Source interface {
@@ -51,6 +98,36 @@ type Source interface {
 	Close() error
 }
 
+// CheckpointedSource is a Source whose read position is recorded in checkpoints.
+// While running, it must select on Context.Checkpoints between batches and Ack
+// every trigger. Sources that do not implement it get barriers injected between
+// batches without a recorded position.
+type CheckpointedSource interface {
+	Source
+
+	// SnapshotPosition returns the read position just after the last batch sent
+	// on the output channel. The engine calls it while the source is blocked in
+	// CheckpointTrigger.Ack, or after Run has returned.
+	SnapshotPosition() ([]byte, error)
+
+	// RestorePosition makes Run resume from a position returned by
+	// SnapshotPosition. It is called after Open and before Run.
+	RestorePosition(position []byte) error
+}
+
+// PartitionedSource is a CheckpointedSource whose instances split partitions
+// between them that can move from one instance to another, such as the
+// partitions of a Kafka consumer group. A partition's position may therefore
+// have been recorded by any instance.
+type PartitionedSource interface {
+	CheckpointedSource
+
+	// RestorePositions is RestorePosition given the positions every instance
+	// of the source recorded, in instance order. The engine calls it instead
+	// of RestorePosition.
+	RestorePositions(positions [][]byte) error
+}
+
 // Sink is a specialization of Operator for sink connectors that consume data.
 type Sink interface {
 	// Open initializes the sink.
@@ -0,0 +1,908 @@
+package operators
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/compute"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/sandboxws/isotope/runtime/pkg/arrow/helpers"
+	"github.com/sandboxws/isotope/runtime/pkg/expr"
+	"github.com/sandboxws/isotope/runtime/pkg/operator"
+	"github.com/sandboxws/isotope/runtime/pkg/state"
+)
+
+// EmitMode is how an Aggregate emits the changes to its results.
+type EmitMode int
+
+const (
+	// EmitRetract retracts a group's previous result (-U) before emitting the
+	// new one (+U). A group's first result is an insert (+I).
+	EmitRetract EmitMode = iota
+	// EmitUpsert emits a group's new result (+U) to replace the previous one
+	// with the same group key. A group's first result is an insert (+I).
+	EmitUpsert
+	// EmitAppend emits every new result as an insert, without a row kind
+	// column. Only consumers that keep the latest row per group key can use
+	// it; anything else counts a group once per update. Plans cannot ask for
+	// it, as the engine refuses an aggregate with an append-only changelog.
+	EmitAppend
+)
+
+// Aggregate is a streaming GROUP BY: it folds every batch into per-group
+// accumulators kept in keyed state and emits the groups whose results
+// changed, one row per group and batch. Select maps each output column to
+// COUNT, SUM, MIN, MAX, AVG, COUNT(DISTINCT ...), FIRST_VALUE or LAST_VALUE
+// of a SQL expression; the group_by columns come first in the output. Its
+// input must be append-only.
+//
+// COUNT(DISTINCT ...) keeps every value it has seen per group in map state,
+// which grows without bound unless the plan sets a state TTL.
+type Aggregate struct {
+	groupBy []string
+	calls   []aggregateCall
+	mode    EmitMode
+
+	ctx      *operator.Context
+	eval     *expr.Evaluator
+	alloc    memory.Allocator
+	accs     *state.Value[[]accumulator]
+	distinct []*state.Map[[]byte, int64] // by call, for COUNT DISTINCT
+
+	schema *arrow.Schema // output schema, from the first batch
+	kinds  []valueKind   // argument kind of each call
+}
+
+// aggFunc is an aggregate function.
+type aggFunc int
+
+const (
+	aggCount aggFunc = iota
+	aggCountDistinct
+	aggSum
+	aggMin
+	aggMax
+	aggAvg
+	aggFirstValue
+	aggLastValue
+)
+
+func (fn aggFunc) String() string {
+	if fn == aggCountDistinct {
+		return "COUNT DISTINCT"
+	}
+	for name, f := range aggFuncs {
+		if f == fn {
+			return name
+		}
+	}
+	return fmt.Sprintf("aggFunc(%d)", int(fn))
+}
+
+var aggFuncs = map[string]aggFunc{
+	"COUNT":       aggCount,
+	"SUM":         aggSum,
+	"MIN":         aggMin,
+	"MAX":         aggMax,
+	"AVG":         aggAvg,
+	"FIRST_VALUE": aggFirstValue,
+	"LAST_VALUE":  aggLastValue,
+}
+
+// aggregateCall is one output column: a function of an argument expression.
+type aggregateCall struct {
+	name string
+	fn   aggFunc
+	arg  string // "" for COUNT(*)
+}
+
+var aggregateCallRE = regexp.MustCompile(`(?is)^\s*([a-z_]+)\s*\(\s*(distinct\s+)?(.*?)\s*\)\s*$`)
+
+func parseAggregateCall(name, sql string) (aggregateCall, error) {
+	m := aggregateCallRE.FindStringSubmatch(sql)
+	if m == nil {
+		return aggregateCall{}, fmt.Errorf("aggregate %q: %q is not an aggregate function call", name, sql)
+	}
+	fn, ok := aggFuncs[strings.ToUpper(m[1])]
+	if !ok {
+		return aggregateCall{}, fmt.Errorf("aggregate %q: unsupported function %s, expected COUNT, SUM, MIN, MAX, AVG, FIRST_VALUE or LAST_VALUE", name, m[1])
+	}
+	call := aggregateCall{name: name, fn: fn, arg: m[3]}
+	if m[2] != "" {
+		if fn != aggCount {
+			return aggregateCall{}, fmt.Errorf("aggregate %q: DISTINCT is only supported in COUNT", name)
+		}
+		call.fn = aggCountDistinct
+	}
+	switch {
+	case call.arg == "":
+		return aggregateCall{}, fmt.Errorf("aggregate %q: %s needs an argument", name, m[1])
+	case call.arg == "*" && call.fn == aggCount:
+		call.arg = ""
+	case call.arg == "*":
+		return aggregateCall{}, fmt.Errorf("aggregate %q: only COUNT accepts *", name)
+	}
+	return call, nil
+}
+
+// NewAggregate creates an Aggregate grouping by the groupBy columns.
+func NewAggregate(groupBy []string, selects map[string]string, mode EmitMode) (*Aggregate, error) {
+	if len(selects) == 0 {
+		return nil, fmt.Errorf("aggregate needs at least one aggregate function")
+	}
+	// Sort output names for a deterministic column order.
+	names := make([]string, 0, len(selects))
+	for name := range selects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	a := &Aggregate{groupBy: groupBy, mode: mode}
+	for _, name := range names {
+		if name == operator.RowKindColumn || containsString(groupBy, name) {
+			return nil, fmt.Errorf("aggregate %q: output name is already taken", name)
+		}
+		call, err := parseAggregateCall(name, selects[name])
+		if err != nil {
+			return nil, err
+		}
+		a.calls = append(a.calls, call)
+	}
+	return a, nil
+}
+
+func (a *Aggregate) Open(ctx *operator.Context) error {
+	a.ctx = ctx
+	a.eval = expr.NewEvaluator(ctx.Alloc)
+	a.alloc = ctx.Alloc
+	a.accs = state.NewValue(ctx.State, "aggregate", accumulatorsCodec{calls: a.calls})
+	a.distinct = make([]*state.Map[[]byte, int64], len(a.calls))
+	for i, call := range a.calls {
+		if call.fn == aggCountDistinct {
+			a.distinct[i] = state.NewMap(ctx.State, "distinct/"+call.name, state.Bytes, state.Int64)
+		}
+	}
+	return nil
+}
+
+// aggregateGroup is a group with rows in the current batch.
+type aggregateGroup struct {
+	key  []byte
+	rows []int
+}
+
+func (a *Aggregate) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
+	n := int(batch.NumRows())
+	if n == 0 {
+		return nil, nil
+	}
+	kinds, err := operator.RowKinds(batch)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate: %w", err)
+	}
+	for row := 0; kinds != nil && row < n; row++ {
+		if kind := operator.RowKindAt(kinds, row); kind != operator.Insert {
+			return nil, fmt.Errorf("aggregate: cannot apply %s rows, only inserts", kind)
+		}
+	}
+	keys := make([]arrow.Array, len(a.groupBy))
+	for i, name := range a.groupBy {
+		col, err := helpers.Column(batch, name)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate group by: %w", err)
+		}
+		keys[i] = col
+	}
+	args := make([]arrow.Array, len(a.calls))
+	defer func() {
+		for _, arg := range args {
+			if arg != nil {
+				arg.Release()
+			}
+		}
+	}()
+	for i, call := range a.calls {
+		if call.arg == "" {
+			continue
+		}
+		arg, err := a.eval.Eval(context.Background(), batch, call.arg)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate %q: %w", call.name, err)
+		}
+		args[i] = arg
+	}
+	if a.schema == nil {
+		if err := a.resolveSchema(batch.Schema(), args); err != nil {
+			return nil, err
+		}
+	}
+
+	// Group the rows by key, in the order groups first appear.
+	var groups []*aggregateGroup
+	index := make(map[string]*aggregateGroup)
+	var buf []byte
+	for row := 0; row < n; row++ {
+		if buf, err = encodeKey(buf[:0], keys, row); err != nil {
+			return nil, fmt.Errorf("aggregate group by: %w", err)
+		}
+		g, ok := index[string(buf)]
+		if !ok {
+			g = &aggregateGroup{key: append([]byte(nil), buf...)}
+			index[string(g.key)] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, row)
+	}
+
+	out := newAggregateOutput(a)
+	defer out.release()
+	for _, g := range groups {
+		if err := a.update(g, args, out); err != nil {
+			return nil, err
+		}
+	}
+	if len(out.rows) == 0 {
+		return nil, nil
+	}
+	result, err := out.record(keys)
+	if err != nil {
+		return nil, err
+	}
+	return []arrow.Record{result}, nil
+}
+
+// update folds a group's rows into its accumulators and emits its result if
+// it changed.
+func (a *Aggregate) update(g *aggregateGroup, args []arrow.Array, out *aggregateOutput) error {
+	a.ctx.State.SetCurrentKey(g.key)
+	accs, existed, err := a.accs.Get()
+	if err != nil {
+		return fmt.Errorf("aggregate state: %w", err)
+	}
+	if !existed {
+		accs = make([]accumulator, len(a.calls))
+	}
+	before := a.results(accs)
+	for i, call := range a.calls {
+		if err := a.accumulate(i, call, &accs[i], args[i], g.rows); err != nil {
+			return err
+		}
+	}
+	if err := a.accs.Set(accs); err != nil {
+		return fmt.Errorf("aggregate state: %w", err)
+	}
+	after := a.results(accs)
+
+	row := g.rows[0]
+	switch {
+	case !existed:
+		out.add(row, operator.Insert, after)
+	case equalResults(before, after):
+		// Nothing downstream needs to hear about.
+	case a.mode == EmitRetract:
+		out.add(row, operator.UpdateBefore, before)
+		out.add(row, operator.UpdateAfter, after)
+	case a.mode == EmitUpsert:
+		out.add(row, operator.UpdateAfter, after)
+	default:
+		out.add(row, operator.Insert, after)
+	}
+	return nil
+}
+
+// accumulate folds the rows of a group into the accumulator of call i. Null
+// arguments are skipped, as in SQL. Numeric arguments are folded in one typed
+// loop over the column; strings, booleans and distinct counts value by value.
+func (a *Aggregate) accumulate(i int, call aggregateCall, acc *accumulator, arg arrow.Array, rows []int) error {
+	if arg == nil {
+		acc.count += int64(len(rows))
+		return nil
+	}
+	kind := a.kinds[i]
+	if call.fn != aggCountDistinct && foldColumn(acc, call.fn, kind, arg, rows) {
+		return nil
+	}
+	for _, row := range rows {
+		if arg.IsNull(row) {
+			continue
+		}
+		v := readValue(arg, kind, row)
+		switch call.fn {
+		case aggCountDistinct:
+			value := v.encode(nil)
+			seen, ok, err := a.distinct[i].Get(value)
+			if err != nil {
+				return fmt.Errorf("aggregate state: %w", err)
+			}
+			if !ok {
+				acc.count++
+			}
+			if err := a.distinct[i].Put(value, seen+1); err != nil {
+				return fmt.Errorf("aggregate state: %w", err)
+			}
+			continue
+		case aggMin:
+			if acc.count == 0 || v.less(acc.value, kind) {
+				acc.value = v
+			}
+		case aggMax:
+			if acc.count == 0 || acc.value.less(v, kind) {
+				acc.value = v
+			}
+		case aggFirstValue:
+			if acc.count == 0 {
+				acc.value = v
+			}
+		case aggLastValue:
+			acc.value = v
+		}
+		acc.count++
+	}
+	return nil
+}
+
+// number is an Arrow primitive type aggregated as a number.
+type number interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+// foldColumn folds the rows of a numeric column into acc and reports whether
+// the column was numeric.
+func foldColumn(acc *accumulator, fn aggFunc, kind valueKind, arg arrow.Array, rows []int) bool {
+	switch arr := arg.(type) {
+	case *array.Int8:
+		foldNumbers(acc, fn, kind, arr.Int8Values(), arg, rows)
+	case *array.Int16:
+		foldNumbers(acc, fn, kind, arr.Int16Values(), arg, rows)
+	case *array.Int32:
+		foldNumbers(acc, fn, kind, arr.Int32Values(), arg, rows)
+	case *array.Int64:
+		foldNumbers(acc, fn, kind, arr.Int64Values(), arg, rows)
+	case *array.Uint8:
+		foldNumbers(acc, fn, kind, arr.Uint8Values(), arg, rows)
+	case *array.Uint16:
+		foldNumbers(acc, fn, kind, arr.Uint16Values(), arg, rows)
+	case *array.Uint32:
+		foldNumbers(acc, fn, kind, arr.Uint32Values(), arg, rows)
+	case *array.Uint64:
+		foldNumbers(acc, fn, kind, arr.Uint64Values(), arg, rows)
+	case *array.Timestamp:
+		foldNumbers(acc, fn, kind, arr.TimestampValues(), arg, rows)
+	case *array.Date32:
+		foldNumbers(acc, fn, kind, arr.Date32Values(), arg, rows)
+	case *array.Date64:
+		foldNumbers(acc, fn, kind, arr.Date64Values(), arg, rows)
+	case *array.Float32:
+		foldNumbers(acc, fn, kind, arr.Float32Values(), arg, rows)
+	case *array.Float64:
+		foldNumbers(acc, fn, kind, arr.Float64Values(), arg, rows)
+	default:
+		return false
+	}
+	return true
+}
+
+// foldNumbers folds values at rows into acc. Extremes are found in the
+// column's own type and merged into acc once.
+func foldNumbers[T number](acc *accumulator, fn aggFunc, kind valueKind, values []T, arg arrow.Array, rows []int) {
+	nulls := arg.NullN() > 0
+	var (
+		n          int64
+		isum       int64
+		fsum       float64
+		first, ext T
+	)
+	for _, row := range rows {
+		if nulls && arg.IsNull(row) {
+			continue
+		}
+		v := values[row]
+		switch fn {
+		case aggSum, aggAvg:
+			if kind == kindFloat || fn == aggAvg {
+				fsum += float64(v)
+			} else {
+				isum += int64(v)
+			}
+		case aggMin:
+			if n == 0 || v < ext {
+				ext = v
+			}
+		case aggMax:
+			if n == 0 || v > ext {
+				ext = v
+			}
+		case aggFirstValue:
+			if n == 0 {
+				first = v
+			}
+		case aggLastValue:
+			ext = v
+		}
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	toValue := func(v T) value {
+		if kind == kindFloat {
+			return value{f: float64(v)}
+		}
+		return value{i: int64(v)}
+	}
+	switch fn {
+	case aggSum, aggAvg:
+		acc.value.i += isum
+		acc.value.f += fsum
+	case aggMin:
+		if v := toValue(ext); acc.count == 0 || v.less(acc.value, kind) {
+			acc.value = v
+		}
+	case aggMax:
+		if v := toValue(ext); acc.count == 0 || acc.value.less(v, kind) {
+			acc.value = v
+		}
+	case aggFirstValue:
+		if acc.count == 0 {
+			acc.value = toValue(first)
+		}
+	case aggLastValue:
+		acc.value = toValue(ext)
+	}
+	acc.count += n
+}
+
+// results returns the output value of every call.
+func (a *Aggregate) results(accs []accumulator) []result {
+	results := make([]result, len(a.calls))
+	for i, call := range a.calls {
+		acc := accs[i]
+		switch call.fn {
+		case aggCount, aggCountDistinct:
+			results[i] = result{valid: true, v: value{i: acc.count}}
+		case aggAvg:
+			if acc.count > 0 {
+				results[i] = result{valid: true, v: value{f: acc.value.f / float64(acc.count)}}
+			}
+		default:
+			results[i] = result{valid: acc.count > 0, v: acc.value}
+		}
+	}
+	return results
+}
+
+// resolveSchema derives the output schema from the first batch.
+func (a *Aggregate) resolveSchema(input *arrow.Schema, args []arrow.Array) error {
+	fields := make([]arrow.Field, 0, len(a.groupBy)+len(a.calls)+1)
+	for _, name := range a.groupBy {
+		idx := input.FieldIndices(name)
+		fields = append(fields, input.Field(idx[0]))
+	}
+	a.kinds = make([]valueKind, len(a.calls))
+	for i, call := range a.calls {
+		if args[i] == nil {
+			fields = append(fields, arrow.Field{Name: call.name, Type: arrow.PrimitiveTypes.Int64})
+			continue
+		}
+		dt := args[i].DataType()
+		kind, ok := kindOf(dt)
+		if !ok {
+			return fmt.Errorf("aggregate %q: unsupported argument type %s", call.name, dt)
+		}
+		a.kinds[i] = kind
+		var typ arrow.DataType
+		switch call.fn {
+		case aggCount, aggCountDistinct:
+			typ = arrow.PrimitiveTypes.Int64
+		case aggSum, aggAvg:
+			if kind == kindString || kind == kindBool {
+				return fmt.Errorf("aggregate %q: cannot sum or average %s", call.name, dt)
+			}
+			typ = arrow.PrimitiveTypes.Float64
+			switch {
+			case call.fn == aggSum && kind == kindInt:
+				typ = arrow.PrimitiveTypes.Int64
+			case call.fn == aggSum && kind == kindUint:
+				typ = arrow.PrimitiveTypes.Uint64
+			}
+		default:
+			typ = dt
+		}
+		fields = append(fields, arrow.Field{Name: call.name, Type: typ, Nullable: true})
+	}
+	if a.mode != EmitAppend {
+		fields = append(fields, arrow.Field{Name: operator.RowKindColumn, Type: arrow.PrimitiveTypes.Int8})
+	}
+	a.schema = arrow.NewSchema(fields, nil)
+	return nil
+}
+
+func (a *Aggregate) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+
+// ProcessCheckpointBarrier has nothing to do: the accumulators live in keyed
+// state, which the engine snapshots.
+func (a *Aggregate) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
+func (a *Aggregate) Close() error                                                { return nil }
+
+// aggregateOutput collects the rows of an output batch: the input row whose
+// group keys they carry, their kind and their results.
+type aggregateOutput struct {
+	a        *Aggregate
+	rows     []int64
+	builders []array.Builder // by call
+	kinds    *array.Int8Builder
+}
+
+func newAggregateOutput(a *Aggregate) *aggregateOutput {
+	out := &aggregateOutput{a: a, builders: make([]array.Builder, len(a.calls))}
+	for i := range a.calls {
+		out.builders[i] = array.NewBuilder(a.alloc, a.schema.Field(len(a.groupBy)+i).Type)
+	}
+	if a.mode != EmitAppend {
+		out.kinds = array.NewInt8Builder(a.alloc)
+	}
+	return out
+}
+
+func (out *aggregateOutput) add(row int, kind operator.RowKind, results []result) {
+	out.rows = append(out.rows, int64(row))
+	for i, r := range results {
+		appendResult(out.builders[i], r)
+	}
+	if out.kinds != nil {
+		out.kinds.Append(int8(kind))
+	}
+}
+
+// record builds the output batch, taking the group key columns from the
+// input rows in one vectorized pass.
+func (out *aggregateOutput) record(keys []arrow.Array) (arrow.Record, error) {
+	a := out.a
+	cols := make([]arrow.Array, 0, len(a.schema.Fields()))
+	defer func() {
+		for _, col := range cols {
+			col.Release()
+		}
+	}()
+	if len(keys) > 0 {
+		indices := array.NewInt64Builder(a.alloc)
+		indices.AppendValues(out.rows, nil)
+		idx := indices.NewArray()
+		indices.Release()
+		defer idx.Release()
+		ctx := compute.WithAllocator(context.Background(), a.alloc)
+		for _, key := range keys {
+			taken, err := compute.TakeArray(ctx, key, idx)
+			if err != nil {
+				return nil, fmt.Errorf("aggregate group keys: %w", err)
+			}
+			cols = append(cols, taken)
+		}
+	}
+	for _, b := range out.builders {
+		cols = append(cols, b.NewArray())
+	}
+	if out.kinds != nil {
+		cols = append(cols, out.kinds.NewArray())
+	}
+	return array.NewRecord(a.schema, cols, int64(len(out.rows))), nil
+}
+
+func (out *aggregateOutput) release() {
+	for _, b := range out.builders {
+		b.Release()
+	}
+	if out.kinds != nil {
+		out.kinds.Release()
+	}
+}
+
+// valueKind is how values of an Arrow type are accumulated.
+type valueKind int
+
+const (
+	kindInt  valueKind = iota // signed integers, timestamps and dates
+	kindUint                  // unsigned integers, held in value.i as their bits
+	kindFloat
+	kindString
+	kindBool
+)
+
+func kindOf(dt arrow.DataType) (valueKind, bool) {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return kindInt, true
+	case arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return kindUint, true
+	case arrow.FLOAT32, arrow.FLOAT64:
+		return kindFloat, true
+	case arrow.STRING, arrow.LARGE_STRING:
+		return kindString, true
+	case arrow.BOOL:
+		return kindBool, true
+	default:
+		return 0, false
+	}
+}
+
+// value is a single accumulated value; which field holds it depends on its
+// kind. Booleans are held as 0 or 1.
+type value struct {
+	i int64
+	f float64
+	s string
+}
+
+func readValue(arr arrow.Array, kind valueKind, row int) value {
+	switch a := arr.(type) {
+	case *array.Int8:
+		return value{i: int64(a.Value(row))}
+	case *array.Int16:
+		return value{i: int64(a.Value(row))}
+	case *array.Int32:
+		return value{i: int64(a.Value(row))}
+	case *array.Int64:
+		return value{i: a.Value(row)}
+	case *array.Uint8:
+		return value{i: int64(a.Value(row))}
+	case *array.Uint16:
+		return value{i: int64(a.Value(row))}
+	case *array.Uint32:
+		return value{i: int64(a.Value(row))}
+	case *array.Uint64:
+		return value{i: int64(a.Value(row))}
+	case *array.Timestamp:
+		return value{i: int64(a.Value(row))}
+	case *array.Date32:
+		return value{i: int64(a.Value(row))}
+	case *array.Date64:
+		return value{i: int64(a.Value(row))}
+	case *array.Float32:
+		return value{f: float64(a.Value(row))}
+	case *array.Float64:
+		return value{f: a.Value(row)}
+	case *array.String:
+		return value{s: a.Value(row)}
+	case *array.LargeString:
+		return value{s: a.Value(row)}
+	case *array.Boolean:
+		if a.Value(row) {
+			return value{i: 1}
+		}
+		return value{}
+	}
+	return value{}
+}
+
+func (v value) less(w value, kind valueKind) bool {
+	switch kind {
+	case kindUint:
+		return uint64(v.i) < uint64(w.i)
+	case kindFloat:
+		return v.f < w.f
+	case kindString:
+		return v.s < w.s
+	default:
+		return v.i < w.i
+	}
+}
+
+// encode appends a binary form of v that tells it apart from any other value
+// of its kind.
+func (v value) encode(buf []byte) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(v.i))
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v.f))
+	return append(buf, v.s...)
+}
+
+// result is the output value of one aggregate call; invalid is null.
+type result struct {
+	valid bool
+	v     value
+}
+
+func equalResults(a, b []result) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func appendResult(b array.Builder, r result) {
+	if !r.valid {
+		b.AppendNull()
+		return
+	}
+	v := r.v
+	switch b := b.(type) {
+	case *array.Int8Builder:
+		b.Append(int8(v.i))
+	case *array.Int16Builder:
+		b.Append(int16(v.i))
+	case *array.Int32Builder:
+		b.Append(int32(v.i))
+	case *array.Int64Builder:
+		b.Append(v.i)
+	case *array.Uint8Builder:
+		b.Append(uint8(v.i))
+	case *array.Uint16Builder:
+		b.Append(uint16(v.i))
+	case *array.Uint32Builder:
+		b.Append(uint32(v.i))
+	case *array.Uint64Builder:
+		b.Append(uint64(v.i))
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(v.i))
+	case *array.Date32Builder:
+		b.Append(arrow.Date32(v.i))
+	case *array.Date64Builder:
+		b.Append(arrow.Date64(v.i))
+	case *array.Float32Builder:
+		b.Append(float32(v.f))
+	case *array.Float64Builder:
+		b.Append(v.f)
+	case *array.StringBuilder:
+		b.Append(v.s)
+	case *array.LargeStringBuilder:
+		b.Append(v.s)
+	case *array.BooleanBuilder:
+		b.Append(v.i != 0)
+	default:
+		b.AppendNull()
+	}
+}
+
+// encodeKey appends the group key of a row: per key column, a null flag and
+// the value.
+func encodeKey(buf []byte, keys []arrow.Array, row int) ([]byte, error) {
+	for _, col := range keys {
+		if col.IsNull(row) {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		kind, ok := kindOf(col.DataType())
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %s", col.DataType())
+		}
+		v := readValue(col, kind, row)
+		switch kind {
+		case kindString:
+			buf = binary.AppendUvarint(buf, uint64(len(v.s)))
+			buf = append(buf, v.s...)
+		case kindFloat:
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v.f))
+		default:
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v.i))
+		}
+	}
+	return buf, nil
+}
+
+// accumulator is the running state of one aggregate call for one group:
+// how many values it folded in and, depending on the function, their sum,
+// extreme, first or last value.
+type accumulator struct {
+	count int64
+	value value
+}
+
+// accumulatorsCodec stores a group's accumulators as one state entry. Each
+// is preceded by the name and function of its call, so that state restored
+// into an aggregate whose select changed is refused instead of being folded
+// into the wrong columns.
+type accumulatorsCodec struct {
+	calls []aggregateCall
+}
+
+func (c accumulatorsCodec) Encode(accs []accumulator) ([]byte, error) {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(accs)))
+	for i, acc := range accs {
+		buf = binary.AppendUvarint(buf, uint64(len(c.calls[i].name)))
+		buf = append(buf, c.calls[i].name...)
+		buf = binary.AppendUvarint(buf, uint64(c.calls[i].fn))
+		buf = binary.AppendVarint(buf, acc.count)
+		buf = binary.AppendVarint(buf, acc.value.i)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(acc.value.f))
+		buf = binary.AppendUvarint(buf, uint64(len(acc.value.s)))
+		buf = append(buf, acc.value.s...)
+	}
+	return buf, nil
+}
+
+func (c accumulatorsCodec) Decode(data []byte) ([]accumulator, error) {
+	corrupt := fmt.Errorf("decode aggregate accumulators: corrupt entry")
+	n, size := binary.Uvarint(data)
+	if size <= 0 {
+		return nil, corrupt
+	}
+	data = data[size:]
+	calls := make([]aggregateCall, 0, n)
+	accs := make([]accumulator, 0, n)
+	for range n {
+		var call aggregateCall
+		l, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < l {
+			return nil, corrupt
+		}
+		call.name = string(data[size : size+int(l)])
+		data = data[size+int(l):]
+		fn, size := binary.Uvarint(data)
+		if size <= 0 {
+			return nil, corrupt
+		}
+		call.fn = aggFunc(fn)
+		data = data[size:]
+		calls = append(calls, call)
+
+		var acc accumulator
+		if acc.count, size = binary.Varint(data); size <= 0 {
+			return nil, corrupt
+		}
+		data = data[size:]
+		if acc.value.i, size = binary.Varint(data); size <= 0 {
+			return nil, corrupt
+		}
+		data = data[size:]
+		if len(data) < 8 {
+			return nil, corrupt
+		}
+		acc.value.f = math.Float64frombits(binary.BigEndian.Uint64(data))
+		data = data[8:]
+		l, size = binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < l {
+			return nil, corrupt
+		}
+		acc.value.s = string(data[size : size+int(l)])
+		data = data[size+int(l):]
+		accs = append(accs, acc)
+	}
+	if !sameCalls(calls, c.calls) {
+		return nil, fmt.Errorf("decode aggregate accumulators: state holds %s, but the aggregate computes %s "+
+			"(give the operator a new ID to start it empty)", describeCalls(calls), describeCalls(c.calls))
+	}
+	return accs, nil
+}
+
+// sameCalls reports whether accumulators written for calls a can be read as
+// accumulators of calls b.
+func sameCalls(a, b []aggregateCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || a[i].fn != b[i].fn {
+			return false
+		}
+	}
+	return true
+}
+
+func describeCalls(calls []aggregateCall) string {
+	parts := make([]string, len(calls))
+	for i, call := range calls {
+		parts[i] = call.name + "=" + call.fn.String()
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
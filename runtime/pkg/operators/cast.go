@@ -28,6 +28,11 @@ func NewCast(columns []CastColumn) *Cast {
 }
 
 func (c *Cast) Open(ctx *operator.Context) error {
+	for _, col := range c.columns {
+		if col.Name == operator.RowKindColumn {
+			return fmt.Errorf("cast: cannot cast the row kind column %s", operator.RowKindColumn)
+		}
+	}
 	c.alloc = ctx.Alloc
 	return nil
 }
@@ -76,9 +81,9 @@ func (c *Cast) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{result}, nil
 }
 
-func (c *Cast) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (c *Cast) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (c *Cast) Close() error                                              { return nil }
+func (c *Cast) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (c *Cast) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (c *Cast) Close() error                                                  { return nil }
 
 // castArrayToType performs a manual element-wise cast.
 func castArrayToType(alloc memory.Allocator, arr arrow.Array, target arrow.DataType) (arrow.Array, error) {
@@ -1,13 +1,16 @@
 package operators
 
 import (
+	"fmt"
+
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 
 	"github.com/sandboxws/isotope/runtime/pkg/operator"
 )
 
-// Drop removes specified columns from the RecordBatch.
+// Drop removes specified columns from the RecordBatch. Dropping the row kind
+// column would turn every retraction into an insert, so it is refused.
 type Drop struct {
 	columns map[string]bool
 }
@@ -21,7 +24,12 @@ func NewDrop(columns []string) *Drop {
 	return &Drop{columns: set}
 }
 
-func (d *Drop) Open(_ *operator.Context) error { return nil }
+func (d *Drop) Open(_ *operator.Context) error {
+	if d.columns[operator.RowKindColumn] {
+		return fmt.Errorf("drop: cannot drop the row kind column %s", operator.RowKindColumn)
+	}
+	return nil
+}
 
 func (d *Drop) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	schema := batch.Schema()
@@ -42,6 +50,6 @@ func (d *Drop) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{result}, nil
 }
 
-func (d *Drop) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (d *Drop) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (d *Drop) Close() error                                              { return nil }
+func (d *Drop) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (d *Drop) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (d *Drop) Close() error                                                  { return nil }
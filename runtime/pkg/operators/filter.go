@@ -12,6 +12,8 @@ import (
 )
 
 // Filter evaluates a SQL condition against each batch and keeps only matching rows.
+// Kept rows keep their row kinds: a retraction passes exactly when the row it
+// retracts passed.
 type Filter struct {
 	conditionSQL string
 	eval         *expr.Evaluator
@@ -46,6 +48,6 @@ func (f *Filter) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{result}, nil
 }
 
-func (f *Filter) ProcessWatermark(_ operator.Watermark) error          { return nil }
-func (f *Filter) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (f *Filter) Close() error                                        { return nil }
+func (f *Filter) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (f *Filter) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (f *Filter) Close() error                                                  { return nil }
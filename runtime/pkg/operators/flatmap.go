@@ -143,6 +143,6 @@ func appendFromArray(bldr array.Builder, src arrow.Array, row int) {
 	}
 }
 
-func (f *FlatMap) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (f *FlatMap) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (f *FlatMap) Close() error                                              { return nil }
+func (f *FlatMap) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (f *FlatMap) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (f *FlatMap) Close() error                                                  { return nil }
@@ -13,7 +13,8 @@ import (
 )
 
 // Map evaluates column-level SQL expressions to produce a new RecordBatch.
-// Each entry in Columns maps output_name → SQL expression.
+// Each entry in Columns maps output_name → SQL expression. The row kind column
+// of a changelog batch is carried through unless Columns defines it.
 type Map struct {
 	columns map[string]string // output_name -> SQL expression
 	eval    *expr.Evaluator
@@ -55,6 +56,14 @@ func (m *Map) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 		fields = append(fields, arrow.Field{Name: name, Type: arr.DataType()})
 		arrays = append(arrays, arr)
 	}
+	if _, ok := m.columns[operator.RowKindColumn]; !ok {
+		if idx := batch.Schema().FieldIndices(operator.RowKindColumn); len(idx) > 0 {
+			kinds := batch.Column(idx[0])
+			kinds.Retain()
+			fields = append(fields, batch.Schema().Field(idx[0]))
+			arrays = append(arrays, kinds)
+		}
+	}
 
 	schema := arrow.NewSchema(fields, nil)
 	result := array.NewRecord(schema, arrays, batch.NumRows())
@@ -66,6 +75,6 @@ func (m *Map) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{result}, nil
 }
 
-func (m *Map) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (m *Map) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (m *Map) Close() error                                              { return nil }
+func (m *Map) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (m *Map) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (m *Map) Close() error                                                  { return nil }
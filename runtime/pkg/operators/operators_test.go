@@ -2,6 +2,9 @@ package operators
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/apache/arrow-go/v18/arrow"
@@ -350,6 +353,377 @@ func TestRoute(t *testing.T) {
 	}
 }
 
+func TestRouteSendsNothingWhenAConditionFails(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	batch := makeBatch(alloc, []string{"val"},
+		[]arrow.Array{makeInt64Arr(alloc, []int64{10, 50})})
+	defer batch.Release()
+
+	highCh := make(chan arrow.Record, 10)
+	r := NewRoute([]RouteBranch{
+		{ConditionSQL: "val > 30", Output: highCh},
+		{ConditionSQL: "missing > 1", Output: make(chan arrow.Record, 10)},
+	})
+	if err := r.Open(newCtx(alloc)); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.ProcessBatch(batch); err == nil {
+		t.Fatal("expected the second condition to fail")
+	}
+	select {
+	case routed := <-highCh:
+		routed.Release()
+		t.Error("expected no batch on highCh after a failed condition")
+	default:
+	}
+}
+
+// ── Aggregate tests ─────────────────────────────────────────────────
+
+// aggregateRows processes a batch of (user, amount) rows and returns its
+// output rows as "user kind count sum" strings.
+func aggregateRows(t *testing.T, alloc memory.Allocator, agg *Aggregate, users []string, amounts []int64) []string {
+	t.Helper()
+	batch := makeBatch(alloc, []string{"user", "amount"},
+		[]arrow.Array{makeStringArr(alloc, users), makeInt64Arr(alloc, amounts)})
+	defer batch.Release()
+
+	results, err := agg.ProcessBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for _, rec := range results {
+		schema := rec.Schema()
+		col := func(name string) arrow.Array { return rec.Column(schema.FieldIndices(name)[0]) }
+		for i := 0; i < int(rec.NumRows()); i++ {
+			kind := operator.Insert
+			if schema.HasField(operator.RowKindColumn) {
+				kind = operator.RowKind(col(operator.RowKindColumn).(*array.Int8).Value(i))
+			}
+			rows = append(rows, fmt.Sprintf("%s %s %d %d", col("user").(*array.String).Value(i), kind,
+				col("n").(*array.Int64).Value(i), col("total").(*array.Int64).Value(i)))
+		}
+		rec.Release()
+	}
+	return rows
+}
+
+func TestAggregateChangelogModes(t *testing.T) {
+	tests := []struct {
+		mode   EmitMode
+		second []string
+	}{
+		{EmitRetract, []string{"a -U 2 30", "a +U 3 35", "c +I 1 1"}},
+		{EmitUpsert, []string{"a +U 3 35", "c +I 1 1"}},
+		{EmitAppend, []string{"a +I 3 35", "c +I 1 1"}},
+	}
+	for _, tt := range tests {
+		alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+		agg, err := NewAggregate([]string{"user"}, map[string]string{"n": "COUNT(*)", "total": "SUM(amount)"}, tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := agg.Open(newCtx(alloc)); err != nil {
+			t.Fatal(err)
+		}
+
+		first := aggregateRows(t, alloc, agg, []string{"a", "b", "a"}, []int64{10, 7, 20})
+		if want := []string{"a +I 2 30", "b +I 1 7"}; !reflect.DeepEqual(first, want) {
+			t.Errorf("mode %d: first batch = %q, want %q", tt.mode, first, want)
+		}
+		second := aggregateRows(t, alloc, agg, []string{"a", "c"}, []int64{5, 1})
+		if !reflect.DeepEqual(second, tt.second) {
+			t.Errorf("mode %d: second batch = %q, want %q", tt.mode, second, tt.second)
+		}
+		agg.Close()
+		alloc.AssertSize(t, 0)
+	}
+}
+
+func TestAggregateFunctions(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	agg, err := NewAggregate(nil, map[string]string{
+		"n":       "count(*)",
+		"total":   "SUM(price)",
+		"lowest":  "MIN(price)",
+		"highest": "MAX(name)",
+		"mean":    "AVG(price)",
+		"names":   "COUNT(DISTINCT name)",
+		"first":   "FIRST_VALUE(name)",
+		"last":    "LAST_VALUE(name)",
+	}, EmitUpsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Open(newCtx(alloc)); err != nil {
+		t.Fatal(err)
+	}
+	defer agg.Close()
+
+	var last arrow.Record
+	for _, batch := range []struct {
+		names  []string
+		prices []float64
+	}{
+		{[]string{"b", "a", "c"}, []float64{3, 4, 5}},
+		{[]string{"a", "d"}, []float64{2, 3}},
+		{nil, nil},
+	} {
+		rec := makeBatch(alloc, []string{"name", "price"},
+			[]arrow.Array{makeStringArr(alloc, batch.names), makeFloat64Arr(alloc, batch.prices)})
+		results, err := agg.ProcessBatch(rec)
+		rec.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch.names) == 0 {
+			if len(results) != 0 {
+				t.Errorf("expected an empty batch to emit nothing, got %d batches", len(results))
+			}
+			continue
+		}
+		if len(results) != 1 || results[0].NumRows() != 1 {
+			t.Fatalf("expected one row per batch for a global aggregate, got %d batches", len(results))
+		}
+		if last != nil {
+			last.Release()
+		}
+		last = results[0]
+	}
+	defer last.Release()
+
+	want := map[string]string{
+		"n":       "5",
+		"total":   "17",
+		"lowest":  "2",
+		"highest": "d",
+		"mean":    "3.4",
+		"names":   "4",
+		"first":   "b",
+		"last":    "d",
+	}
+	for name, v := range want {
+		col := last.Column(last.Schema().FieldIndices(name)[0])
+		if got := col.ValueStr(0); got != v {
+			t.Errorf("%s = %s, want %s", name, got, v)
+		}
+	}
+	kind := last.Column(last.Schema().FieldIndices(operator.RowKindColumn)[0]).(*array.Int8)
+	if operator.RowKind(kind.Value(0)) != operator.UpdateAfter {
+		t.Errorf("expected an update, got %s", operator.RowKind(kind.Value(0)))
+	}
+}
+
+func TestAggregateSkipsUnchangedResults(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	agg, err := NewAggregate([]string{"user"}, map[string]string{"top": "MAX(amount)"}, EmitRetract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Open(newCtx(alloc)); err != nil {
+		t.Fatal(err)
+	}
+	defer agg.Close()
+
+	for i, amount := range []int64{10, 5} {
+		batch := makeBatch(alloc, []string{"user", "amount"},
+			[]arrow.Array{makeStringArr(alloc, []string{"a"}), makeInt64Arr(alloc, []int64{amount})})
+		results, err := agg.ProcessBatch(batch)
+		batch.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 - i; len(results) != want {
+			t.Errorf("amount %d: expected %d result batches, got %d", amount, want, len(results))
+		}
+		for _, r := range results {
+			r.Release()
+		}
+	}
+}
+
+func TestAggregateRejectsInvalidCalls(t *testing.T) {
+	for _, sql := range []string{"amount", "MEDIAN(amount)", "SUM(DISTINCT amount)", "SUM(*)", "COUNT()"} {
+		if _, err := NewAggregate([]string{"user"}, map[string]string{"x": sql}, EmitRetract); err == nil {
+			t.Errorf("%q: expected an error", sql)
+		}
+	}
+	if _, err := NewAggregate([]string{"user"}, map[string]string{"user": "COUNT(*)"}, EmitRetract); err == nil {
+		t.Error("expected an error for an output name shadowing a group key")
+	}
+}
+
+// TestAggregateUnsignedValues folds unsigned values above the int64 range.
+func TestAggregateUnsignedValues(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	agg, err := NewAggregate(nil, map[string]string{
+		"lowest": "MIN(v)", "highest": "MAX(v)", "total": "SUM(v)", "mean": "AVG(v)",
+	}, EmitAppend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Open(newCtx(alloc)); err != nil {
+		t.Fatal(err)
+	}
+	defer agg.Close()
+
+	bldr := array.NewUint64Builder(alloc)
+	bldr.AppendValues([]uint64{1<<63 + 6, 2, 4}, []bool{true, false, true})
+	batch := makeBatch(alloc, []string{"v"}, []arrow.Array{bldr.NewArray()})
+	bldr.Release()
+	defer batch.Release()
+	results, err := agg.ProcessBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer results[0].Release()
+
+	want := map[string]string{
+		"lowest":  "4",
+		"highest": "9223372036854775814",
+		"total":   "9223372036854775818",
+		"mean":    "4.611686018427388e+18",
+	}
+	for name, v := range want {
+		col := results[0].Column(results[0].Schema().FieldIndices(name)[0])
+		if got := col.ValueStr(0); got != v {
+			t.Errorf("%s = %s, want %s", name, got, v)
+		}
+	}
+}
+
+// TestAggregateRefusesStateOfOtherCalls restores accumulators into an
+// aggregate whose select gained a column.
+func TestAggregateRefusesStateOfOtherCalls(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	ctx := newCtx(alloc)
+	before, err := NewAggregate([]string{"user"}, map[string]string{"n": "COUNT(*)", "total": "SUM(amount)"}, EmitRetract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := before.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	aggregateRows(t, alloc, before, []string{"a"}, []int64{10})
+	before.Close()
+
+	after, err := NewAggregate([]string{"user"}, map[string]string{"n": "COUNT(*)", "top": "MAX(amount)", "total": "SUM(amount)"}, EmitRetract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := after.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer after.Close()
+	batch := makeBatch(alloc, []string{"user", "amount"},
+		[]arrow.Array{makeStringArr(alloc, []string{"a"}), makeInt64Arr(alloc, []int64{5})})
+	defer batch.Release()
+	if _, err := after.ProcessBatch(batch); err == nil || !strings.Contains(err.Error(), "state holds [n=COUNT total=SUM]") {
+		t.Errorf("expected the accumulators of another select to be refused, got %v", err)
+	}
+}
+
+// ── Changelog tests ─────────────────────────────────────────────────
+
+func makeInt8Arr(alloc memory.Allocator, vals []int8) arrow.Array {
+	bldr := array.NewInt8Builder(alloc)
+	defer bldr.Release()
+	bldr.AppendValues(vals, nil)
+	return bldr.NewArray()
+}
+
+// TestStatelessOperatorsKeepRowKinds runs a changelog batch through every
+// stateless operator and checks the row kinds that come out.
+func TestStatelessOperatorsKeepRowKinds(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	batch := makeBatch(alloc, []string{"id", "amount", operator.RowKindColumn},
+		[]arrow.Array{
+			makeInt64Arr(alloc, []int64{1, 1, 1, 2}),
+			makeInt64Arr(alloc, []int64{10, 10, 20, 5}),
+			makeInt8Arr(alloc, []int8{int8(operator.Insert), int8(operator.UpdateBefore), int8(operator.UpdateAfter), int8(operator.Delete)}),
+		})
+	defer batch.Release()
+
+	all := "+I -U +U -D"
+	tests := []struct {
+		name string
+		op   operator.Operator
+		want string
+	}{
+		{"filter", NewFilter("amount > 5"), "+I -U +U"},
+		{"map", NewMap(map[string]string{"double": "amount * 2"}), all},
+		{"cast", NewCast([]CastColumn{{Name: "amount", TargetType: arrow.PrimitiveTypes.Float64}}), all},
+		{"rename", NewRename(map[string]string{"amount": "total"}), all},
+		{"drop", NewDrop([]string{"id"}), all},
+	}
+	for _, tt := range tests {
+		if err := tt.op.Open(newCtx(alloc)); err != nil {
+			t.Fatal(err)
+		}
+		results, err := tt.op.ProcessBatch(batch)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, r := range results {
+			kinds, err := operator.RowKinds(r)
+			if err != nil || kinds == nil {
+				t.Errorf("%s: expected a row kind column, got %v", tt.name, err)
+			}
+			for row := 0; kinds != nil && row < kinds.Len(); row++ {
+				got = append(got, operator.RowKindAt(kinds, row).String())
+			}
+			r.Release()
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: row kinds %v, want %s", tt.name, got, tt.want)
+		}
+		tt.op.Close()
+	}
+
+	agg, err := NewAggregate([]string{"id"}, map[string]string{"n": "COUNT(*)"}, EmitRetract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Open(newCtx(alloc)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agg.ProcessBatch(batch); err == nil || !strings.Contains(err.Error(), "-U") {
+		t.Errorf("expected the aggregate to refuse retractions, got %v", err)
+	}
+}
+
+func TestRowKindColumnIsReserved(t *testing.T) {
+	alloc := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer alloc.AssertSize(t, 0)
+
+	for _, op := range []operator.Operator{
+		NewCast([]CastColumn{{Name: operator.RowKindColumn, TargetType: arrow.PrimitiveTypes.Int64}}),
+		NewRename(map[string]string{operator.RowKindColumn: "op"}),
+		NewRename(map[string]string{"kind": operator.RowKindColumn}),
+		NewDrop([]string{operator.RowKindColumn}),
+	} {
+		if err := op.Open(newCtx(alloc)); err == nil || !strings.Contains(err.Error(), operator.RowKindColumn) {
+			t.Errorf("%T: expected the row kind column to be refused, got %v", op, err)
+		}
+	}
+}
+
 // ── Varied batch size tests ─────────────────────────────────────────
 
 func TestFilterVariedSizes(t *testing.T) {
@@ -1,6 +1,8 @@
 package operators
 
 import (
+	"fmt"
+
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 
@@ -8,7 +10,8 @@ import (
 )
 
 // Rename creates a new RecordBatch with renamed columns.
-// Columns not in the rename map are kept with their original names.
+// Columns not in the rename map are kept with their original names. The row
+// kind column can be neither renamed nor replaced.
 type Rename struct {
 	columns map[string]string // old_name -> new_name
 }
@@ -18,7 +21,14 @@ func NewRename(columns map[string]string) *Rename {
 	return &Rename{columns: columns}
 }
 
-func (r *Rename) Open(_ *operator.Context) error { return nil }
+func (r *Rename) Open(_ *operator.Context) error {
+	for oldName, newName := range r.columns {
+		if oldName == operator.RowKindColumn || newName == operator.RowKindColumn {
+			return fmt.Errorf("rename: cannot rename %s to %s: %s is the row kind column", oldName, newName, operator.RowKindColumn)
+		}
+	}
+	return nil
+}
 
 func (r *Rename) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	schema := batch.Schema()
@@ -39,6 +49,6 @@ func (r *Rename) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{result}, nil
 }
 
-func (r *Rename) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (r *Rename) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (r *Rename) Close() error                                              { return nil }
+func (r *Rename) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (r *Rename) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (r *Rename) Close() error                                                  { return nil }
@@ -14,14 +14,17 @@ import (
 )
 
 // RouteBranch defines a condition and a target channel for the Route operator.
+// When Target is set, the engine supplies Output through SetOutput.
 type RouteBranch struct {
 	ConditionSQL string
+	Target       string // downstream operator ID
 	Output       chan<- arrow.Record
 }
 
 // Route evaluates branch conditions and splits the batch to different outputs.
 // Each row goes to the first matching branch. Unmatched rows are returned
 // from ProcessBatch (for the default output).
+// Route implements operator.MultiOutputOperator.
 type Route struct {
 	branches []RouteBranch
 	eval     *expr.Evaluator
@@ -33,6 +36,27 @@ func NewRoute(branches []RouteBranch) *Route {
 	return &Route{branches: branches}
 }
 
+// OutputTargets returns the target of each branch that has one, in branch
+// order. A target repeats when several branches share it.
+func (r *Route) OutputTargets() []string {
+	var targets []string
+	for _, b := range r.branches {
+		if b.Target != "" {
+			targets = append(targets, b.Target)
+		}
+	}
+	return targets
+}
+
+// SetOutput assigns out to every branch that targets the given operator.
+func (r *Route) SetOutput(target string, out chan<- arrow.Record) {
+	for i := range r.branches {
+		if r.branches[i].Target == target {
+			r.branches[i].Output = out
+		}
+	}
+}
+
 func (r *Route) Open(ctx *operator.Context) error {
 	r.eval = expr.NewEvaluator(ctx.Alloc)
 	r.alloc = ctx.Alloc
@@ -43,14 +67,37 @@ func (r *Route) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	ctx := context.Background()
 	numRows := int(batch.NumRows())
 
-	// Track which rows have been routed to a branch.
-	routed := make([]bool, numRows)
-
-	for _, branch := range r.branches {
+	// Evaluate every condition before sending anything, so that a failing
+	// condition does not leave earlier branches with part of the batch.
+	masks := make([]*array.Boolean, len(r.branches))
+	defer func() {
+		for _, mask := range masks {
+			if mask != nil {
+				mask.Release()
+			}
+		}
+	}()
+	for i, branch := range r.branches {
 		mask, err := r.eval.EvalBool(ctx, batch, branch.ConditionSQL)
 		if err != nil {
 			return nil, fmt.Errorf("route condition %q: %w", branch.ConditionSQL, err)
 		}
+		masks[i] = mask
+	}
+
+	// Track which rows have been routed to a branch.
+	routed := make([]bool, numRows)
+	outputs := make([]arrow.Record, len(r.branches))
+	release := func() {
+		for _, out := range outputs {
+			if out != nil {
+				out.Release()
+			}
+		}
+	}
+
+	for b, branch := range r.branches {
+		mask := masks[b]
 
 		// Build a mask that is true only for rows matching this branch AND not yet routed.
 		effectiveMask := array.NewBooleanBuilder(r.alloc)
@@ -63,7 +110,6 @@ func (r *Route) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 				anyMatch = true
 			}
 		}
-		mask.Release()
 		maskArr := effectiveMask.NewArray()
 		effectiveMask.Release()
 
@@ -71,10 +117,11 @@ func (r *Route) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 			filtered, err := helpers.Filter(ctx, batch, maskArr)
 			maskArr.Release()
 			if err != nil {
+				release()
 				return nil, err
 			}
 			if filtered.NumRows() > 0 {
-				branch.Output <- filtered
+				outputs[b] = filtered
 			} else {
 				filtered.Release()
 			}
@@ -92,31 +139,41 @@ func (r *Route) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 		}
 	}
 
-	if !anyUnmatched {
-		return nil, nil
-	}
+	var unmatched arrow.Record
+	if anyUnmatched {
+		// Build inverse mask.
+		unmatchedMask := array.NewBooleanBuilder(r.alloc)
+		for _, v := range routed {
+			unmatchedMask.Append(!v)
+		}
+		maskArr := unmatchedMask.NewArray()
+		unmatchedMask.Release()
 
-	// Build inverse mask.
-	unmatchedMask := array.NewBooleanBuilder(r.alloc)
-	for _, v := range routed {
-		unmatchedMask.Append(!v)
+		filtered, err := helpers.Filter(ctx, batch, maskArr)
+		maskArr.Release()
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if filtered.NumRows() > 0 {
+			unmatched = filtered
+		} else {
+			filtered.Release()
+		}
 	}
-	maskArr := unmatchedMask.NewArray()
-	unmatchedMask.Release()
 
-	filtered, err := helpers.Filter(ctx, batch, maskArr)
-	maskArr.Release()
-	if err != nil {
-		return nil, err
+	// Every part is built: only now hand the branches their rows.
+	for b, out := range outputs {
+		if out != nil {
+			r.branches[b].Output <- out
+		}
 	}
-
-	if filtered.NumRows() == 0 {
-		filtered.Release()
+	if unmatched == nil {
 		return nil, nil
 	}
-	return []arrow.Record{filtered}, nil
+	return []arrow.Record{unmatched}, nil
 }
 
-func (r *Route) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (r *Route) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (r *Route) Close() error                                              { return nil }
+func (r *Route) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (r *Route) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (r *Route) Close() error                                                  { return nil }
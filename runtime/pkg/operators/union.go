@@ -7,8 +7,8 @@ import (
 )
 
 // Union merges batches from multiple inputs in arrival order.
-// Since the engine feeds all input channels into the same operator goroutine,
-// Union simply passes each batch through unchanged.
+// Since the engine reads all input channels concurrently into the same operator
+// goroutine, Union simply passes each batch through unchanged.
 type Union struct{}
 
 // NewUnion creates a Union operator.
@@ -21,6 +21,6 @@ func (u *Union) ProcessBatch(batch arrow.Record) ([]arrow.Record, error) {
 	return []arrow.Record{batch}, nil
 }
 
-func (u *Union) ProcessWatermark(_ operator.Watermark) error                { return nil }
-func (u *Union) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error { return nil }
-func (u *Union) Close() error                                              { return nil }
+func (u *Union) ProcessWatermark(_ operator.Watermark) ([]arrow.Record, error) { return nil, nil }
+func (u *Union) ProcessCheckpointBarrier(_ operator.CheckpointBarrier) error   { return nil }
+func (u *Union) Close() error                                                  { return nil }
@@ -0,0 +1,199 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cockroachdb/pebble/v2"
+)
+
+// sharedFilesFile lists the shared files an incremental snapshot references.
+const sharedFilesFile = "files.json"
+
+// sharedFileList maps the name of each file of a snapshot that lives in a
+// shared directory to its path relative to the snapshot, so a checkpoint
+// directory can be moved as a whole.
+type sharedFileList struct {
+	Files map[string]string `json:"files"`
+}
+
+// SnapshotIncremental writes a Pebble checkpoint whose SST files, which
+// Pebble never modifies, are put in sharedDir the first time a snapshot
+// includes them and only referenced after that. Each snapshot therefore
+// costs the SSTs written since the previous one plus the small manifest,
+// options and WAL files, which are copied.
+func (b *PebbleBackend) SnapshotIncremental(dir, sharedDir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if sharedDir, err = filepath.Abs(sharedDir); err != nil {
+		return err
+	}
+
+	// Check the database out next to the working directory, where the check
+	// out hard-links its SSTs, then move what is new into sharedDir.
+	staging := b.dir + ".snapshot"
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	// Flushing first moves the memtable into an SST, leaving little in the
+	// WAL that has to be copied in full.
+	if err := b.db.Flush(); err != nil {
+		return err
+	}
+	if err := b.db.Checkpoint(staging, pebble.WithFlushedWAL()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(sharedDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return err
+	}
+
+	list := sharedFileList{Files: make(map[string]string)}
+	shared := make(map[string]string)
+	for _, entry := range entries {
+		src := filepath.Join(staging, entry.Name())
+		if filepath.Ext(entry.Name()) != ".sst" {
+			if err := copyFile(src, filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		path, ok := b.shared[entry.Name()]
+		if ok {
+			// Shared files no checkpoint references are swept, e.g. those
+			// of an aborted checkpoint; put the file back if it was.
+			_, err := os.Stat(path)
+			ok = err == nil
+		}
+		if !ok {
+			path = filepath.Join(sharedDir, b.session+"-"+entry.Name())
+			if err := linkOrCopy(src, path); err != nil {
+				return fmt.Errorf("share state file: %w", err)
+			}
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		list.Files[entry.Name()] = rel
+		shared[entry.Name()] = path
+	}
+	// SSTs compacted away are never shared again.
+	b.shared = shared
+	return writeSharedFileList(dir, list)
+}
+
+// restoreShared puts the shared files the incremental snapshot in dir
+// references into the working directory. It does nothing for a full
+// snapshot.
+func (b *PebbleBackend) restoreShared(dir string) error {
+	list, err := readSharedFileList(dir)
+	if err != nil || list == nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(b.dir, sharedFilesFile)); err != nil {
+		return err
+	}
+	for name, rel := range list.Files {
+		path, err := filepath.Abs(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		if err := linkOrCopy(path, filepath.Join(b.dir, name)); err != nil {
+			return err
+		}
+		// The restored files are already shared under these paths.
+		b.shared[name] = path
+	}
+	return nil
+}
+
+// SharedFiles returns the paths of the shared files that the store snapshot
+// in dir references, sorted. A full snapshot references none.
+func SharedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		backendDir := filepath.Join(dir, entry.Name())
+		list, err := readSharedFileList(backendDir)
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			continue
+		}
+		for _, rel := range list.Files {
+			paths = append(paths, filepath.Join(backendDir, rel))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readSharedFileList reads the shared file list of the snapshot in dir, or
+// returns nil if it has none.
+func readSharedFileList(dir string) (*sharedFileList, error) {
+	data, err := os.ReadFile(filepath.Join(dir, sharedFilesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := &sharedFileList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", sharedFilesFile, err)
+	}
+	return list, nil
+}
+
+func writeSharedFileList(dir string, list sharedFileList) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, sharedFilesFile), data, 0o644)
+}
+
+// linkOrCopy hard-links src to dst, copying it where the file system does
+// not allow a link. dst appears complete or not at all.
+func linkOrCopy(src, dst string) error {
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		if err := copyFile(src, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
+
+// newSession returns a random name that keeps the SSTs of one opening of a
+// database apart from those of another in a shared directory, as Pebble
+// numbers files anew from a restored snapshot.
+func newSession() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
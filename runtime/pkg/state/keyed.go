@@ -0,0 +1,336 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Codec converts state values to and from bytes.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// Codecs for common value types.
+var (
+	Int64   Codec[int64]   = int64Codec{}
+	Float64 Codec[float64] = float64Codec{}
+	String  Codec[string]  = stringCodec{}
+	Bytes   Codec[[]byte]  = bytesCodec{}
+)
+
+// JSON returns a codec encoding values as JSON.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type int64Codec struct{}
+
+func (int64Codec) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)), nil
+}
+
+func (int64Codec) Decode(data []byte) (int64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("decode int64: got %d bytes", len(data))
+	}
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+type float64Codec struct{}
+
+func (float64Codec) Encode(v float64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v)), nil
+}
+
+func (float64Codec) Decode(data []byte) (float64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("decode float64: got %d bytes", len(data))
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(v string) ([]byte, error)    { return []byte(v), nil }
+func (stringCodec) Decode(data []byte) (string, error) { return string(data), nil }
+
+type bytesCodec struct{}
+
+func (bytesCodec) Encode(v []byte) ([]byte, error)    { return v, nil }
+func (bytesCodec) Decode(data []byte) ([]byte, error) { return append([]byte(nil), data...), nil }
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Value is a single value per key.
+type Value[T any] struct {
+	store *Store
+	name  string
+	codec Codec[T]
+}
+
+// NewValue returns the value state of the given name in store.
+func NewValue[T any](store *Store, name string, codec Codec[T]) *Value[T] {
+	return &Value[T]{store: store, name: name, codec: codec}
+}
+
+// Get returns the value of the current key, if it has one.
+func (v *Value[T]) Get() (T, bool, error) {
+	var zero T
+	backend, err := v.store.backendOrOpen()
+	if err != nil {
+		return zero, false, err
+	}
+	data, ok, err := v.store.get(backend, v.store.prefix(kindValue, v.name))
+	if err != nil || !ok {
+		return zero, false, err
+	}
+	value, err := v.codec.Decode(data)
+	return value, err == nil, err
+}
+
+// Set sets the value of the current key, restarting its TTL.
+func (v *Value[T]) Set(value T) error {
+	backend, err := v.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	data, err := v.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return backend.Set(v.store.prefix(kindValue, v.name), v.store.wrap(data))
+}
+
+// Clear removes the value of the current key.
+func (v *Value[T]) Clear() error {
+	backend, err := v.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	return backend.Delete(v.store.prefix(kindValue, v.name))
+}
+
+// List is a list of values per key, stored as one entry that expires as a
+// whole.
+type List[T any] struct {
+	store *Store
+	name  string
+	codec Codec[T]
+}
+
+// NewList returns the list state of the given name in store.
+func NewList[T any](store *Store, name string, codec Codec[T]) *List[T] {
+	return &List[T]{store: store, name: name, codec: codec}
+}
+
+// Get returns the list of the current key, which is empty if it has none.
+func (l *List[T]) Get() ([]T, error) {
+	backend, err := l.store.backendOrOpen()
+	if err != nil {
+		return nil, err
+	}
+	data, ok, err := l.store.get(backend, l.store.prefix(kindList, l.name))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var values []T
+	for len(data) > 0 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, fmt.Errorf("decode list state %q: corrupt entry", l.name)
+		}
+		value, err := l.codec.Decode(data[size : size+int(n)])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		data = data[size+int(n):]
+	}
+	return values, nil
+}
+
+// Add appends a value to the list of the current key, restarting its TTL.
+func (l *List[T]) Add(value T) error {
+	backend, err := l.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	key := l.store.prefix(kindList, l.name)
+	data, _, err := l.store.get(backend, key)
+	if err != nil {
+		return err
+	}
+	data, err = l.append(l.store.wrap(data), value)
+	if err != nil {
+		return err
+	}
+	return backend.Set(key, data)
+}
+
+// Update replaces the list of the current key, restarting its TTL.
+func (l *List[T]) Update(values []T) error {
+	if len(values) == 0 {
+		return l.Clear()
+	}
+	backend, err := l.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	data := l.store.wrap(nil)
+	for _, value := range values {
+		if data, err = l.append(data, value); err != nil {
+			return err
+		}
+	}
+	return backend.Set(l.store.prefix(kindList, l.name), data)
+}
+
+func (l *List[T]) append(data []byte, value T) ([]byte, error) {
+	encoded, err := l.codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	data = binary.AppendUvarint(data, uint64(len(encoded)))
+	return append(data, encoded...), nil
+}
+
+// Clear removes the list of the current key.
+func (l *List[T]) Clear() error {
+	backend, err := l.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	return backend.Delete(l.store.prefix(kindList, l.name))
+}
+
+// Map is a map of values per key, with one entry per map key. Each entry
+// expires on its own.
+type Map[K, V any] struct {
+	store    *Store
+	name     string
+	keyCodec Codec[K]
+	codec    Codec[V]
+}
+
+// NewMap returns the map state of the given name in store.
+func NewMap[K, V any](store *Store, name string, keyCodec Codec[K], codec Codec[V]) *Map[K, V] {
+	return &Map[K, V]{store: store, name: name, keyCodec: keyCodec, codec: codec}
+}
+
+func (m *Map[K, V]) entryKey(key K) ([]byte, error) {
+	encoded, err := m.keyCodec.Encode(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(m.store.prefix(kindMap, m.name), encoded...), nil
+}
+
+// Get returns the value of a map key of the current key.
+func (m *Map[K, V]) Get(key K) (V, bool, error) {
+	var zero V
+	backend, err := m.store.backendOrOpen()
+	if err != nil {
+		return zero, false, err
+	}
+	entryKey, err := m.entryKey(key)
+	if err != nil {
+		return zero, false, err
+	}
+	data, ok, err := m.store.get(backend, entryKey)
+	if err != nil || !ok {
+		return zero, false, err
+	}
+	value, err := m.codec.Decode(data)
+	return value, err == nil, err
+}
+
+// Put sets the value of a map key of the current key, restarting its TTL.
+func (m *Map[K, V]) Put(key K, value V) error {
+	backend, err := m.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	entryKey, err := m.entryKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := m.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return backend.Set(entryKey, m.store.wrap(data))
+}
+
+// Remove removes a map key of the current key.
+func (m *Map[K, V]) Remove(key K) error {
+	backend, err := m.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	entryKey, err := m.entryKey(key)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(entryKey)
+}
+
+// Range calls fn for every live entry of the map of the current key, ordered
+// by encoded map key, until fn returns an error. Expired entries it passes
+// over are deleted.
+func (m *Map[K, V]) Range(fn func(key K, value V) error) error {
+	backend, err := m.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	prefix := m.store.prefix(kindMap, m.name)
+	var expired [][]byte
+	err = backend.Scan(prefix, func(entryKey, data []byte) error {
+		data, ok, err := m.store.live(data)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			expired = append(expired, append([]byte(nil), entryKey...))
+			return nil
+		}
+		key, err := m.keyCodec.Decode(entryKey[len(prefix):])
+		if err != nil {
+			return err
+		}
+		value, err := m.codec.Decode(data)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+	for _, entryKey := range expired {
+		if err != nil {
+			break
+		}
+		err = backend.Delete(entryKey)
+	}
+	if err == nil {
+		m.store.expired(len(expired))
+	}
+	return err
+}
+
+// Clear removes every entry of the map of the current key.
+func (m *Map[K, V]) Clear() error {
+	backend, err := m.store.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	return backend.DeletePrefix(m.store.prefix(kindMap, m.name))
+}
@@ -0,0 +1,158 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RaduBerinde/btreemap"
+)
+
+// memoryEntriesFile holds the entries of a memory backend snapshot.
+const memoryEntriesFile = "entries"
+
+// memoryBTreeDegree is the degree of the B-tree a memory backend keeps its
+// entries in.
+const memoryBTreeDegree = 16
+
+// MemoryBackend keeps entries in an ordered B-tree, so that a scan or prefix
+// delete visits only the entries it covers. It suits tests and small state.
+type MemoryBackend struct {
+	entries *btreemap.BTreeMap[string, []byte]
+}
+
+// NewMemoryBackend returns an empty memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: newMemoryEntries()}
+}
+
+func newMemoryEntries() *btreemap.BTreeMap[string, []byte] {
+	return btreemap.New[string, []byte](memoryBTreeDegree, strings.Compare)
+}
+
+func (b *MemoryBackend) Get(key []byte) ([]byte, bool, error) {
+	_, value, ok := b.entries.Get(string(key))
+	return value, ok, nil
+}
+
+func (b *MemoryBackend) Set(key, value []byte) error {
+	b.entries.ReplaceOrInsert(string(key), bytes.Clone(value))
+	return nil
+}
+
+func (b *MemoryBackend) Delete(key []byte) error {
+	b.entries.Delete(string(key))
+	return nil
+}
+
+// Scan calls fn for the entries starting with prefix in key order. fn may
+// modify the backend.
+func (b *MemoryBackend) Scan(prefix []byte, fn func(key, value []byte) error) error {
+	keys, values := b.prefixed(prefix)
+	for i, key := range keys {
+		if err := fn([]byte(key), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBackend) DeletePrefix(prefix []byte) error {
+	keys, _ := b.prefixed(prefix)
+	for _, key := range keys {
+		b.entries.Delete(key)
+	}
+	return nil
+}
+
+// prefixed returns the entries starting with prefix in key order, collected
+// first so that callers may modify the tree while visiting them.
+func (b *MemoryBackend) prefixed(prefix []byte) (keys []string, values [][]byte) {
+	for key, value := range b.entries.Ascend(btreemap.GE(string(prefix)), btreemap.Max[string]()) {
+		if !strings.HasPrefix(key, string(prefix)) {
+			break
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// Snapshot writes the entries as length-prefixed key and value pairs.
+func (b *MemoryBackend) Snapshot(dir string) error {
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, memoryEntriesFile))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for key, value := range b.entries.Ascend(btreemap.Min[string](), btreemap.Max[string]()) {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+		if _, err := w.Write(buf); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (b *MemoryBackend) Restore(dir string) error {
+	f, err := os.Open(filepath.Join(dir, memoryEntriesFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	entries := newMemoryEntries()
+	for {
+		key, err := readChunk(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read state snapshot: %w", err)
+		}
+		value, err := readChunk(r)
+		if err != nil {
+			return fmt.Errorf("read state snapshot: %w", err)
+		}
+		entries.ReplaceOrInsert(string(key), value)
+	}
+	b.entries = entries
+	return nil
+}
+
+func (b *MemoryBackend) Close() error {
+	b.entries = nil
+	return nil
+}
+
+// readChunk reads a length-prefixed byte string. It returns io.EOF only if r
+// ends before the chunk starts.
+func readChunk(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, n)
+	if _, err := io.ReadFull(r, chunk); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return chunk, nil
+}
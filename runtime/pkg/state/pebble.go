@@ -0,0 +1,371 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cockroachdb/pebble/v2"
+)
+
+// PebbleBackend keeps entries in an embedded Pebble LSM, so state can grow
+// beyond memory. Its working directory is scratch space: durable copies of
+// the state are its snapshots.
+//
+// Once ExpireInBackground is called, every compaction is followed by a sweep
+// of the key ranges it wrote that deletes expired entries, so state that is
+// never read again is still dropped, at the pace Pebble rewrites it anyway.
+type PebbleBackend struct {
+	dir string
+	db  *pebble.DB
+
+	// session names the SSTs this opening of the database shares with
+	// incremental snapshots; shared maps the name of every SST already in a
+	// shared directory to its path there.
+	session string
+	shared  map[string]string
+
+	// writeMu orders writes against the sweep, so it never deletes an entry
+	// rewritten after it was found expired.
+	writeMu sync.Mutex
+
+	// The sweep, if started: compactions queue the ranges they wrote and
+	// signal the sweeper, which runs until stop is closed.
+	clock     func() int64
+	expired   func(n int)
+	rangesMu  sync.Mutex
+	ranges    []keyRange
+	compacted chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// keyRange is a range of keys from start to end, inclusive.
+type keyRange struct {
+	start, end []byte
+}
+
+// OpenPebbleBackend opens an empty Pebble backend in dir.
+func OpenPebbleBackend(dir string) (*PebbleBackend, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	b := &PebbleBackend{dir: dir, shared: make(map[string]string)}
+	if err := b.openDB(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *PebbleBackend) openDB() error {
+	db, err := pebble.Open(b.dir, &pebble.Options{
+		Logger:        pebbleLogger{},
+		EventListener: &pebble.EventListener{CompactionEnd: b.compactionEnd},
+	})
+	if err != nil {
+		return err
+	}
+	b.db = db
+	b.session = newSession()
+	return nil
+}
+
+func (b *PebbleBackend) Get(key []byte) ([]byte, bool, error) {
+	value, closer, err := b.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer closer.Close()
+	// The value is only valid until the closer is closed.
+	return append([]byte(nil), value...), true, nil
+}
+
+func (b *PebbleBackend) Set(key, value []byte) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.db.Set(key, value, pebble.NoSync)
+}
+
+func (b *PebbleBackend) Delete(key []byte) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.db.Delete(key, pebble.NoSync)
+}
+
+func (b *PebbleBackend) Scan(prefix []byte, fn func(key, value []byte) error) error {
+	iter, err := b.db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixEnd(prefix)})
+	if err != nil {
+		return err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		if err := fn(iter.Key(), value); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+func (b *PebbleBackend) DeletePrefix(prefix []byte) error {
+	end := prefixEnd(prefix)
+	if end == nil {
+		// Only an all-0xff prefix has no end; delete it key by key.
+		var keys [][]byte
+		err := b.Scan(prefix, func(key, _ []byte) error {
+			keys = append(keys, append([]byte(nil), key...))
+			return nil
+		})
+		for _, key := range keys {
+			if err == nil {
+				err = b.Delete(key)
+			}
+		}
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.db.DeleteRange(prefix, end, pebble.NoSync)
+}
+
+// Snapshot writes a Pebble checkpoint, which hard-links the immutable SST
+// files where the file system allows.
+func (b *PebbleBackend) Snapshot(dir string) error {
+	return b.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
+
+// Restore reopens the backend on a copy of the checkpoint in dir, leaving
+// the checkpoint itself untouched. The SSTs of an incremental snapshot are
+// hard-linked from its shared directory where possible.
+func (b *PebbleBackend) Restore(dir string) error {
+	b.stopSweep()
+	if err := b.db.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(b.dir); err != nil {
+		return err
+	}
+	if err := copyDir(dir, b.dir); err != nil {
+		return fmt.Errorf("copy state snapshot: %w", err)
+	}
+	b.shared = make(map[string]string)
+	if err := b.restoreShared(dir); err != nil {
+		return fmt.Errorf("restore shared state files: %w", err)
+	}
+	if err := b.openDB(); err != nil {
+		return err
+	}
+	b.startSweep()
+	return nil
+}
+
+// Close closes the database and removes its working directory.
+func (b *PebbleBackend) Close() error {
+	b.stopSweep()
+	err := b.db.Close()
+	if rmErr := os.RemoveAll(b.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// ExpireInBackground starts sweeping compacted key ranges for entries that
+// expired by clock.
+func (b *PebbleBackend) ExpireInBackground(clock func() int64, expired func(n int)) {
+	b.clock, b.expired = clock, expired
+	b.startSweep()
+}
+
+func (b *PebbleBackend) startSweep() {
+	if b.clock == nil {
+		return
+	}
+	compacted := make(chan struct{}, 1)
+	b.stop = make(chan struct{})
+	b.stopped = make(chan struct{})
+	b.rangesMu.Lock()
+	b.compacted = compacted
+	b.rangesMu.Unlock()
+	go b.sweeper(compacted, b.stop, b.stopped)
+}
+
+func (b *PebbleBackend) stopSweep() {
+	if b.stop == nil {
+		return
+	}
+	b.rangesMu.Lock()
+	b.compacted, b.ranges = nil, nil
+	b.rangesMu.Unlock()
+	close(b.stop)
+	<-b.stopped
+	b.stop = nil
+}
+
+// compactionEnd queues the key ranges of the tables a compaction wrote.
+func (b *PebbleBackend) compactionEnd(info pebble.CompactionInfo) {
+	if info.Err != nil || len(info.Output.Tables) == 0 {
+		return
+	}
+	b.rangesMu.Lock()
+	defer b.rangesMu.Unlock()
+	if b.compacted == nil {
+		return
+	}
+	for _, table := range info.Output.Tables {
+		b.ranges = append(b.ranges, keyRange{
+			start: append([]byte(nil), table.Smallest.UserKey...),
+			end:   append([]byte(nil), table.Largest.UserKey...),
+		})
+	}
+	select {
+	case b.compacted <- struct{}{}:
+	default:
+	}
+}
+
+func (b *PebbleBackend) sweeper(compacted <-chan struct{}, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-compacted:
+		}
+		b.rangesMu.Lock()
+		ranges := b.ranges
+		b.ranges = nil
+		b.rangesMu.Unlock()
+		for _, r := range ranges {
+			n, err := b.sweep(r)
+			if err != nil {
+				slog.Warn("sweeping expired state failed", "component", "pebble", "error", err)
+			}
+			b.expired(n)
+		}
+	}
+}
+
+// sweep deletes the entries of r that have expired, returning how many.
+func (b *PebbleBackend) sweep(r keyRange) (int, error) {
+	now := b.clock()
+	var keys [][]byte
+	iter, err := b.db.NewIter(&pebble.IterOptions{LowerBound: r.start, UpperBound: append(r.end, 0)})
+	if err != nil {
+		return 0, err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		if len(value) >= expiryLen && expiresAt(value) <= now {
+			keys = append(keys, append([]byte(nil), iter.Key()...))
+		}
+	}
+	if err := iter.Close(); err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	// Entries written since the scan have a new expiry time, so check again
+	// with writes held off.
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	batch := b.db.NewBatch()
+	defer batch.Close()
+	for _, key := range keys {
+		value, closer, err := b.db.Get(key)
+		if err == pebble.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		live := len(value) < expiryLen || expiresAt(value) > now
+		closer.Close()
+		if live {
+			continue
+		}
+		if err := batch.Delete(key, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int(batch.Count()), batch.Commit(pebble.NoSync)
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// copyDir copies the regular files of src into a new directory dst.
+func copyDir(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// pebbleLogger routes Pebble's logging through slog, demoting its chatty
+// informational messages to debug.
+type pebbleLogger struct{}
+
+func (pebbleLogger) Infof(format string, args ...interface{}) {
+	slog.Debug(fmt.Sprintf(format, args...), "component", "pebble")
+}
+
+func (pebbleLogger) Errorf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...), "component", "pebble")
+}
+
+func (pebbleLogger) Fatalf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...), "component", "pebble")
+	os.Exit(1)
+}
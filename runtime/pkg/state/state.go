@@ -0,0 +1,218 @@
+// Package state provides keyed state for operators: value, list and map
+// state scoped to the current key of an operator instance, stored in a
+// pluggable Backend and snapshotted on checkpoint barriers.
+//
+// Every entry is stored under [key group | kind | state name | key | map key],
+// so the state of one key stays together and the key group leaves room for
+// redistributing keys when parallelism changes. Its value starts with the
+// time the entry expires at; see TTL.
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Backend names, as in StateConfig.backend.
+const (
+	BackendMemory = "memory"
+	BackendPebble = "pebble"
+)
+
+// MaxKeyGroups is the number of key groups keys are hashed into.
+const MaxKeyGroups = 128
+
+// Backend stores the state entries of one operator instance. It is not safe
+// for concurrent use.
+type Backend interface {
+	// Get returns the value of key. The value is only valid until the next
+	// call on the backend.
+	Get(key []byte) ([]byte, bool, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Scan calls fn for every entry whose key starts with prefix, in key order.
+	Scan(prefix []byte, fn func(key, value []byte) error) error
+	// DeletePrefix deletes every entry whose key starts with prefix.
+	DeletePrefix(prefix []byte) error
+
+	// Snapshot writes every entry to dir, which does not exist yet.
+	Snapshot(dir string) error
+	// Restore replaces every entry with those of a snapshot in dir.
+	Restore(dir string) error
+	Close() error
+}
+
+// IncrementalBackend is implemented by backends whose snapshots can share
+// files with earlier ones instead of copying all their entries every time.
+type IncrementalBackend interface {
+	Backend
+	// SnapshotIncremental is Snapshot, except that immutable files go into
+	// sharedDir, each only once, and dir only references them. Files in
+	// sharedDir must outlive every snapshot referencing them; see SharedFiles.
+	SnapshotIncremental(dir, sharedDir string) error
+}
+
+// Open opens a backend by name. Backends that keep entries on disk use dir
+// as their working directory, discarding whatever is in it.
+func Open(backend, dir string) (Backend, error) {
+	switch backend {
+	case "", BackendMemory:
+		return NewMemoryBackend(), nil
+	case BackendPebble:
+		return OpenPebbleBackend(dir)
+	default:
+		return nil, fmt.Errorf("unknown state backend %q, expected %q or %q", backend, BackendPebble, BackendMemory)
+	}
+}
+
+// ValidBackend reports whether Open accepts a backend name.
+func ValidBackend(backend string) bool {
+	return backend == "" || backend == BackendMemory || backend == BackendPebble
+}
+
+// Store is the keyed state of one operator instance. Its backend is opened
+// on first use, so instances that keep no state cost nothing.
+type Store struct {
+	name    string
+	open    func() (Backend, error)
+	backend Backend
+
+	key   []byte
+	group uint16
+
+	ttl       TTL
+	timestamp int64
+	watermark atomic.Int64
+	now       func() time.Time
+}
+
+// NewStore returns a store whose backend, named by backend, is opened by open
+// on first use.
+func NewStore(backend string, open func() (Backend, error)) *Store {
+	if backend == "" {
+		backend = BackendMemory
+	}
+	s := &Store{name: backend, open: open, now: time.Now}
+	s.watermark.Store(math.MinInt64)
+	return s
+}
+
+// NewMemoryStore returns a store backed by memory.
+func NewMemoryStore() *Store {
+	return NewStore(BackendMemory, func() (Backend, error) { return NewMemoryBackend(), nil })
+}
+
+// SetCurrentKey scopes every state handle of the store to key until the
+// next call. A nil key scopes state to the operator instance as a whole.
+func (s *Store) SetCurrentKey(key []byte) {
+	s.key = append(s.key[:0], key...)
+	s.group = KeyGroup(key)
+}
+
+// CurrentKey returns the key state is currently scoped to.
+func (s *Store) CurrentKey() []byte {
+	return s.key
+}
+
+// KeyGroup returns the key group of key.
+func KeyGroup(key []byte) uint16 {
+	h := fnv.New32a()
+	h.Write(key)
+	return uint16(h.Sum32() % MaxKeyGroups)
+}
+
+func (s *Store) backendOrOpen() (Backend, error) {
+	if s.backend == nil {
+		backend, err := s.open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s state backend: %w", s.name, err)
+		}
+		s.backend = backend
+		if expirer, ok := backend.(Expirer); ok && s.ttl.Duration > 0 {
+			expirer.ExpireInBackground(s.clock, s.expired)
+		}
+	}
+	return s.backend, nil
+}
+
+// Snapshot writes the store's entries into dir. A store that was never used
+// writes nothing.
+func (s *Store) Snapshot(dir string) error {
+	if s.backend == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return s.backend.Snapshot(filepath.Join(dir, s.name))
+}
+
+// SnapshotIncremental is Snapshot, but shares immutable files with earlier
+// snapshots through sharedDir if the backend supports it.
+func (s *Store) SnapshotIncremental(dir, sharedDir string) error {
+	incremental, ok := s.backend.(IncrementalBackend)
+	if !ok {
+		return s.Snapshot(dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return incremental.SnapshotIncremental(filepath.Join(dir, s.name), sharedDir)
+}
+
+// Restore replaces the store's entries with a snapshot written by Snapshot
+// or SnapshotIncremental.
+func (s *Store) Restore(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != s.name {
+			return fmt.Errorf("state was snapshotted by the %s backend, not %s", entry.Name(), s.name)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	backend, err := s.backendOrOpen()
+	if err != nil {
+		return err
+	}
+	return backend.Restore(filepath.Join(dir, s.name))
+}
+
+// Close closes the backend, if it was opened.
+func (s *Store) Close() error {
+	if s.backend == nil {
+		return nil
+	}
+	err := s.backend.Close()
+	s.backend = nil
+	return err
+}
+
+// Kinds of state, which keep state of the same name but different kinds apart.
+const (
+	kindValue byte = 'v'
+	kindList  byte = 'l'
+	kindMap   byte = 'm'
+)
+
+// prefix returns the key of the state named name of the current key.
+// Map entries append their map key to it.
+func (s *Store) prefix(kind byte, name string) []byte {
+	buf := make([]byte, 0, 3+2*binary.MaxVarintLen64+len(name)+len(s.key))
+	buf = binary.BigEndian.AppendUint16(buf, s.group)
+	buf = append(buf, kind)
+	buf = binary.AppendUvarint(buf, uint64(len(name)))
+	buf = append(buf, name...)
+	buf = binary.AppendUvarint(buf, uint64(len(s.key)))
+	return append(buf, s.key...)
+}
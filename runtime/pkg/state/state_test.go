@@ -0,0 +1,371 @@
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stores returns a fresh store of every backend.
+func stores(t *testing.T) map[string]*Store {
+	t.Helper()
+	dir := t.TempDir()
+	open := func(backend string) *Store {
+		return NewStore(backend, func() (Backend, error) {
+			return Open(backend, filepath.Join(dir, backend))
+		})
+	}
+	return map[string]*Store{
+		BackendMemory: open(BackendMemory),
+		BackendPebble: open(BackendPebble),
+	}
+}
+
+func TestKeyedStateIsScopedToCurrentKey(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(backend, func(t *testing.T) {
+			defer store.Close()
+			count := NewValue(store, "count", Int64)
+			seen := NewList(store, "seen", String)
+			totals := NewMap(store, "totals", String, Float64)
+
+			for _, key := range []string{"a", "ab", "b", "a"} {
+				store.SetCurrentKey([]byte(key))
+				n, _, err := count.Get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				must(t, count.Set(n+1))
+				must(t, seen.Add(key+"!"))
+				must(t, totals.Put("x", float64(len(key))))
+				must(t, totals.Put("y", 1))
+			}
+
+			store.SetCurrentKey([]byte("a"))
+			if n, ok, err := count.Get(); err != nil || !ok || n != 2 {
+				t.Errorf("expected count 2 for a, got %d, %v, %v", n, ok, err)
+			}
+			if values, err := seen.Get(); err != nil || !slices.Equal(values, []string{"a!", "a!"}) {
+				t.Errorf("expected a's list, got %v, %v", values, err)
+			}
+			var keys []string
+			must(t, totals.Range(func(key string, value float64) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			if !slices.Equal(keys, []string{"x", "y"}) {
+				t.Errorf("expected map keys x and y, got %v", keys)
+			}
+
+			must(t, totals.Clear())
+			must(t, seen.Update([]string{"z"}))
+			store.SetCurrentKey([]byte("ab"))
+			if v, ok, err := totals.Get("x"); err != nil || !ok || v != 2 {
+				t.Errorf("expected ab's map to survive a's clear, got %v, %v, %v", v, ok, err)
+			}
+			must(t, count.Clear())
+			if _, ok, err := count.Get(); err != nil || ok {
+				t.Errorf("expected a cleared value, got %v, %v", ok, err)
+			}
+
+			store.SetCurrentKey([]byte("c"))
+			if values, err := seen.Get(); err != nil || len(values) != 0 {
+				t.Errorf("expected an empty list for a new key, got %v, %v", values, err)
+			}
+		})
+	}
+}
+
+func TestKeyedStateSnapshotRestore(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(backend, func(t *testing.T) {
+			count := NewValue(store, "count", Int64)
+			for i, key := range []string{"a", "b", "c"} {
+				store.SetCurrentKey([]byte(key))
+				must(t, count.Set(int64(i)))
+			}
+			snapshot := filepath.Join(t.TempDir(), "chk-1")
+			must(t, store.Snapshot(snapshot))
+
+			// Changes after the snapshot are not part of it.
+			store.SetCurrentKey([]byte("a"))
+			must(t, count.Set(100))
+			store.SetCurrentKey([]byte("d"))
+			must(t, count.Set(100))
+			must(t, store.Restore(snapshot))
+			for i, key := range []string{"a", "b", "c"} {
+				store.SetCurrentKey([]byte(key))
+				if n, ok, err := count.Get(); err != nil || !ok || n != int64(i) {
+					t.Errorf("expected %s=%d after restore, got %d, %v, %v", key, i, n, ok, err)
+				}
+			}
+			store.SetCurrentKey([]byte("d"))
+			if _, ok, err := count.Get(); err != nil || ok {
+				t.Errorf("expected d to be gone after restore, got %v, %v", ok, err)
+			}
+			must(t, store.Close())
+
+			// A store of another backend cannot restore the snapshot.
+			other := NewMemoryStore()
+			if backend == BackendMemory {
+				other = NewStore(BackendPebble, func() (Backend, error) {
+					return OpenPebbleBackend(filepath.Join(t.TempDir(), "db"))
+				})
+			}
+			if err := other.Restore(snapshot); err == nil || !strings.Contains(err.Error(), backend) {
+				t.Errorf("expected a backend mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUnusedStoreSnapshotsNothing(t *testing.T) {
+	store := NewStore(BackendPebble, func() (Backend, error) {
+		t.Fatal("backend opened")
+		return nil, nil
+	})
+	dir := filepath.Join(t.TempDir(), "state")
+	must(t, store.Snapshot(dir))
+	must(t, store.Close())
+	if _, err := Open("rocksdb", ""); err == nil {
+		t.Error("expected an unknown backend to be rejected")
+	}
+}
+
+func TestMemoryBackendScansPrefixInOrder(t *testing.T) {
+	backend := NewMemoryBackend()
+	for _, key := range []string{"b/2", "a", "b/1", "b", "c", "b/3"} {
+		must(t, backend.Set([]byte(key), []byte(key)))
+	}
+
+	// Entries may be deleted while they are visited.
+	var seen []string
+	must(t, backend.Scan([]byte("b/"), func(key, value []byte) error {
+		seen = append(seen, string(value))
+		return backend.Delete(key)
+	}))
+	if want := []string{"b/1", "b/2", "b/3"}; !slices.Equal(seen, want) {
+		t.Errorf("expected %v, got %v", want, seen)
+	}
+
+	must(t, backend.DeletePrefix([]byte("b")))
+	seen = nil
+	must(t, backend.Scan(nil, func(key, _ []byte) error {
+		seen = append(seen, string(key))
+		return nil
+	}))
+	if want := []string{"a", "c"}; !slices.Equal(seen, want) {
+		t.Errorf("expected %v to remain, got %v", want, seen)
+	}
+}
+
+func TestStateTTL(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(backend, func(t *testing.T) {
+			defer store.Close()
+			now := time.UnixMilli(1_000_000)
+			store.now = func() time.Time { return now }
+			var expired int
+			store.SetTTL(TTL{Duration: time.Minute, Expired: func(n int) { expired += n }})
+			count := NewValue(store, "count", Int64)
+			seen := NewList(store, "seen", String)
+			totals := NewMap(store, "totals", String, Int64)
+
+			store.SetCurrentKey([]byte("a"))
+			must(t, count.Set(1))
+			must(t, seen.Add("x"))
+			must(t, totals.Put("old", 1))
+			now = now.Add(40 * time.Second)
+			must(t, totals.Put("new", 2))
+			// Writing restarts the TTL; reading does not.
+			must(t, seen.Add("y"))
+			if _, ok, err := count.Get(); err != nil || !ok {
+				t.Fatalf("expected a live value, got %v, %v", ok, err)
+			}
+
+			now = now.Add(30 * time.Second)
+			if _, ok, err := count.Get(); err != nil || ok {
+				t.Errorf("expected the value to have expired, got %v, %v", ok, err)
+			}
+			if values, err := seen.Get(); err != nil || !slices.Equal(values, []string{"x", "y"}) {
+				t.Errorf("expected the rewritten list to live, got %v, %v", values, err)
+			}
+			var keys []string
+			must(t, totals.Range(func(key string, _ int64) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			if !slices.Equal(keys, []string{"new"}) {
+				t.Errorf("expected only the new map entry to live, got %v", keys)
+			}
+			if expired != 2 {
+				t.Errorf("expected 2 expired entries, got %d", expired)
+			}
+
+			// Expired entries were deleted, so reading again counts nothing.
+			store.SetTTL(TTL{})
+			if _, ok, err := count.Get(); err != nil || ok {
+				t.Errorf("expected the expired value to be gone, got %v, %v", ok, err)
+			}
+			must(t, count.Set(2))
+			now = now.Add(24 * time.Hour)
+			if n, ok, err := count.Get(); err != nil || !ok || n != 2 {
+				t.Errorf("expected a value written without a TTL to live, got %d, %v, %v", n, ok, err)
+			}
+		})
+	}
+}
+
+func TestEventTimeTTL(t *testing.T) {
+	store := NewMemoryStore()
+	store.SetTTL(TTL{Duration: time.Second, Domain: EventTime})
+	seen := NewMap(store, "seen", String, Int64)
+
+	// Before any event time, entries cannot expire.
+	must(t, seen.Put("early", 0))
+	store.SetCurrentTimestamp(10_000)
+	must(t, seen.Put("a", 1))
+	store.SetCurrentTimestamp(0)
+	store.AdvanceWatermark(10_500)
+	must(t, seen.Put("b", 2))
+
+	check := func(want ...string) {
+		t.Helper()
+		var keys []string
+		must(t, seen.Range(func(key string, _ int64) error {
+			keys = append(keys, key)
+			return nil
+		}))
+		if !slices.Equal(keys, want) {
+			t.Errorf("expected %v, got %v", want, keys)
+		}
+	}
+	check("a", "b", "early")
+	store.AdvanceWatermark(11_000)
+	check("b", "early")
+	store.AdvanceWatermark(10_000)
+	store.AdvanceWatermark(11_500)
+	check("early")
+}
+
+func TestPebbleSweepsExpiredEntriesOnCompaction(t *testing.T) {
+	backend, err := OpenPebbleBackend(filepath.Join(t.TempDir(), "db"))
+	must(t, err)
+	store := NewStore(BackendPebble, func() (Backend, error) { return backend, nil })
+	defer store.Close()
+	var expired atomic.Int64
+	store.SetTTL(TTL{Duration: time.Second, Domain: EventTime, Expired: func(n int) { expired.Add(int64(n)) }})
+	count := NewValue(store, "count", Int64)
+
+	store.SetCurrentTimestamp(1_000)
+	for i := range 100 {
+		store.SetCurrentKey([]byte{byte(i)})
+		must(t, count.Set(int64(i)))
+	}
+	store.SetCurrentTimestamp(5_000)
+	store.SetCurrentKey([]byte("live"))
+	must(t, count.Set(1))
+	store.AdvanceWatermark(3_000)
+
+	// Nothing reads the expired entries; the sweep after compaction drops them.
+	must(t, backend.db.Flush())
+	must(t, backend.db.Compact(context.Background(), []byte{0}, []byte{0xff, 0xff}, false))
+	deadline := time.Now().Add(5 * time.Second)
+	for expired.Load() < 100 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := expired.Load(); n != 100 {
+		t.Fatalf("expected 100 swept entries, got %d", n)
+	}
+	var left int
+	must(t, backend.Scan(nil, func(_, _ []byte) error {
+		left++
+		return nil
+	}))
+	if left != 1 {
+		t.Errorf("expected only the live entry to remain, got %d entries", left)
+	}
+}
+
+func TestPebbleIncrementalSnapshots(t *testing.T) {
+	root := t.TempDir()
+	shared := filepath.Join(root, "shared")
+	open := func(name string) *Store {
+		return NewStore(BackendPebble, func() (Backend, error) {
+			return OpenPebbleBackend(filepath.Join(root, name))
+		})
+	}
+	sharedCount := func() int {
+		entries, err := os.ReadDir(shared)
+		must(t, err)
+		return len(entries)
+	}
+	store := open("db")
+	count := NewValue(store, "count", Int64)
+	write := func(keys ...string) {
+		for _, key := range keys {
+			store.SetCurrentKey([]byte(key))
+			must(t, count.Set(int64(len(key))))
+		}
+	}
+
+	write("a", "bb")
+	chk1 := filepath.Join(root, "chk-1", "state")
+	must(t, store.SnapshotIncremental(chk1, shared))
+	files1, err := SharedFiles(chk1)
+	must(t, err)
+	if len(files1) == 0 || sharedCount() != len(files1) {
+		t.Fatalf("expected the first snapshot to share its SSTs, got %v", files1)
+	}
+
+	// The second snapshot adds only the SST flushed since the first.
+	write("ccc")
+	chk2 := filepath.Join(root, "chk-2", "state")
+	must(t, store.SnapshotIncremental(chk2, shared))
+	files2, err := SharedFiles(chk2)
+	must(t, err)
+	for _, file := range files1 {
+		if !slices.Contains(files2, file) {
+			t.Errorf("expected the second snapshot to reuse %s, got %v", file, files2)
+		}
+	}
+	if sharedCount() != len(files1)+1 {
+		t.Errorf("expected one new shared file, got %d for %d", sharedCount(), len(files1))
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, "chk-*", "state", "*", "*.sst"))
+	if len(matches) != 0 {
+		t.Errorf("expected no SSTs in the snapshots themselves, got %v", matches)
+	}
+	must(t, store.Close())
+
+	// A restored store sees the state and keeps sharing the restored files.
+	store = open("restored")
+	defer store.Close()
+	count = NewValue(store, "count", Int64)
+	must(t, store.Restore(chk2))
+	for _, key := range []string{"a", "bb", "ccc"} {
+		store.SetCurrentKey([]byte(key))
+		if n, ok, err := count.Get(); err != nil || !ok || n != int64(len(key)) {
+			t.Errorf("expected %s=%d after restore, got %d, %v, %v", key, len(key), n, ok, err)
+		}
+	}
+	chk3 := filepath.Join(root, "chk-3", "state")
+	must(t, store.SnapshotIncremental(chk3, shared))
+	files3, err := SharedFiles(chk3)
+	must(t, err)
+	if !slices.Equal(files3, files2) || sharedCount() != len(files2) {
+		t.Errorf("expected the restored store to reuse %v, got %v", files2, files3)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
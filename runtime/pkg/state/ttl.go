@@ -0,0 +1,162 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TimeDomain is the clock state TTLs are measured against.
+type TimeDomain int
+
+const (
+	// ProcessingTime expires an entry a TTL after it was last written, by
+	// wall-clock time.
+	ProcessingTime TimeDomain = iota
+	// EventTime expires an entry once the watermark passes the event time it
+	// was last written at plus the TTL.
+	EventTime
+)
+
+func (d TimeDomain) String() string {
+	if d == EventTime {
+		return "event"
+	}
+	return "processing"
+}
+
+// ParseTimeDomain parses "processing" or "event".
+func ParseTimeDomain(s string) (TimeDomain, error) {
+	switch s {
+	case "", "processing":
+		return ProcessingTime, nil
+	case "event":
+		return EventTime, nil
+	default:
+		return 0, fmt.Errorf("unknown time domain %q, expected \"processing\" or \"event\"", s)
+	}
+}
+
+// TTL configures how long state entries live. The zero TTL keeps them forever.
+type TTL struct {
+	Duration time.Duration
+	Domain   TimeDomain
+	// Expired, if set, is called with the number of entries dropped because
+	// they expired. Background cleanup calls it from its own goroutine.
+	Expired func(n int)
+}
+
+// Every stored value starts with the time it expires at, in milliseconds
+// since the epoch, so expiry needs no second lookup and survives changes to
+// the TTL. Entries written without a TTL never expire.
+const (
+	expiryLen   = 8
+	neverExpire = math.MaxInt64
+)
+
+// SetTTL sets how long the store's entries live from their last write. It
+// applies to entries written from then on.
+func (s *Store) SetTTL(ttl TTL) {
+	s.ttl = ttl
+}
+
+// SetCurrentTimestamp sets the event time, in milliseconds since the epoch,
+// of the record being processed. Under an event-time TTL, entries written
+// from then on expire relative to it; until it is set, relative to the
+// watermark. The engine and the built-in operators never set it, so their
+// entries expire relative to the watermark at the time of the write.
+func (s *Store) SetCurrentTimestamp(ts int64) {
+	s.timestamp = ts
+}
+
+// AdvanceWatermark moves the clock of an event-time TTL to wm, in
+// milliseconds since the epoch.
+func (s *Store) AdvanceWatermark(wm int64) {
+	if wm > s.watermark.Load() {
+		s.watermark.Store(wm)
+	}
+}
+
+// clock returns the current time entries expire against.
+func (s *Store) clock() int64 {
+	if s.ttl.Domain == EventTime {
+		return s.watermark.Load()
+	}
+	return s.now().UnixMilli()
+}
+
+// expiry returns the expiry time of an entry written now.
+func (s *Store) expiry() int64 {
+	if s.ttl.Duration <= 0 {
+		return neverExpire
+	}
+	base := s.now().UnixMilli()
+	if s.ttl.Domain == EventTime {
+		base = s.timestamp
+		if base == 0 {
+			base = s.watermark.Load()
+		}
+		if base == math.MinInt64 {
+			// No event time yet to measure the TTL from.
+			return neverExpire
+		}
+	}
+	return base + s.ttl.Duration.Milliseconds()
+}
+
+// wrap prefixes an encoded value with its expiry time.
+func (s *Store) wrap(value []byte) []byte {
+	data := make([]byte, expiryLen, expiryLen+len(value))
+	binary.BigEndian.PutUint64(data, uint64(s.expiry()))
+	return append(data, value...)
+}
+
+// live strips the expiry time off a stored value, reporting false if the
+// value has expired.
+func (s *Store) live(data []byte) ([]byte, bool, error) {
+	if len(data) < expiryLen {
+		return nil, false, fmt.Errorf("corrupt state entry: %d bytes", len(data))
+	}
+	if expiresAt(data) <= s.clock() {
+		return nil, false, nil
+	}
+	return data[expiryLen:], true, nil
+}
+
+// get returns the live value of key, deleting it if it has expired.
+func (s *Store) get(backend Backend, key []byte) ([]byte, bool, error) {
+	data, ok, err := backend.Get(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	value, ok, err := s.live(data)
+	if err != nil || ok {
+		return value, ok, err
+	}
+	if err := backend.Delete(key); err != nil {
+		return nil, false, err
+	}
+	s.expired(1)
+	return nil, false, nil
+}
+
+// expired counts n expired entries.
+func (s *Store) expired(n int) {
+	if n > 0 && s.ttl.Expired != nil {
+		s.ttl.Expired(n)
+	}
+}
+
+func expiresAt(data []byte) int64 {
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+// Expirer is implemented by backends that also drop expired entries in the
+// background, so entries that are never read again do not pile up. A store
+// with a TTL starts the cleanup when it opens the backend.
+type Expirer interface {
+	// ExpireInBackground deletes entries that expired by clock, which may be
+	// called from another goroutine, and reports how many through expired.
+	ExpireInBackground(clock func() int64, expired func(n int))
+}
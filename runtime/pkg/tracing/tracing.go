@@ -0,0 +1,61 @@
+// Package tracing sets up OpenTelemetry tracing for the Isotope runtime.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName is the service spans are reported under.
+const ServiceName = "isotope-runtime"
+
+// NewTracerProvider creates a tracer provider exporting spans as given by spec:
+//
+//	stdout                 spans as JSON on stdout
+//	otlp                   OTLP over HTTP to the collector named by the
+//	                       OTEL_EXPORTER_OTLP_* variables, localhost:4318 by default
+//	otlp://<host:port>     OTLP over HTTP to the given collector
+//
+// A fraction sampleRatio of source batches start a trace. Shut the provider
+// down to flush the spans still buffered.
+func NewTracerProvider(ctx context.Context, spec string, sampleRatio float64, pipeline string) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch {
+	case spec == "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case spec == "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case strings.HasPrefix(spec, "otlp://"):
+		exporter, err = otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(strings.TrimPrefix(spec, "otlp://")),
+			otlptracehttp.WithInsecure(),
+		)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected stdout, otlp or otlp://<host:port>", spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("trace exporter: %w", err)
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("trace sample ratio %v is not between 0 and 1", sampleRatio)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", ServiceName),
+		attribute.String("isotope.pipeline", pipeline),
+	)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	), nil
+}